@@ -0,0 +1,243 @@
+package batch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+)
+
+type Status int
+
+const (
+	StatusUpdated Status = iota
+	StatusUpToDate
+	StatusNotFound
+	StatusFailed
+	StatusCreated
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusUpdated:
+		return "updated"
+	case StatusUpToDate:
+		return "up-to-date"
+	case StatusNotFound:
+		return "not-found-upstream"
+	case StatusFailed:
+		return "failed"
+	case StatusCreated:
+		return "created"
+	default:
+		return "unknown"
+	}
+}
+
+// Index holds the current packages of the upstream repositories.
+type Index struct {
+	CRAN         []recipe.Package
+	Bioconductor []recipe.Package
+}
+
+// Result records what happened to a single recipe. Recipe is the name of the
+// recipe directory, Name the upstream package name it was mapped to.
+type Result struct {
+	Path    string
+	Recipe  string
+	Name    string
+	Version string
+	Status  Status
+	Err     error
+}
+
+type Summary []Result
+
+// FindRecipes returns the paths of every R recipe in the Spack repository
+// rooted at root.
+func FindRecipes(root string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(root, "packages", "r-*", "package.py"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// Options configures a batch run. Concurrency is the number of recipes that
+// are processed at once, defaulting to one per CPU. Recursive makes Create
+// follow dependencies.
+type Options struct {
+	DryRun      bool
+	Concurrency int
+	Recursive   bool
+}
+
+// job is the state of updating a single recipe, which one worker takes from
+// parsing through to writing it back.
+type job struct {
+	result   Result
+	recipe   recipe.Recipe
+	packages []recipe.Package
+}
+
+// Update updates every R recipe in the Spack repository at root from the
+// index using a pool of workers, each of which parses, looks up, updates and
+// writes back one recipe at a time. Nothing is written if opts.DryRun is set.
+func Update(root string, index Index, opts Options) (Summary, error) {
+	paths, err := FindRecipes(root)
+	if err != nil {
+		return nil, err
+	}
+	workers := opts.Concurrency
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	summary := make(Summary, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				summary[i] = index.process(paths[i], opts.DryRun)
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return summary, nil
+}
+
+func (i Index) process(path string, dryRun bool) Result {
+	j := job{result: Result{Path: path, Recipe: filepath.Base(filepath.Dir(path))}}
+	if j.parse() && j.find(i) && j.update() {
+		j.render(dryRun)
+	}
+	return j.result
+}
+
+func (j *job) parse() bool {
+	r, err := recipe.ParseFile(j.result.Path)
+	if err != nil {
+		return j.fail(err)
+	}
+	j.recipe = r
+	return true
+}
+
+func (j *job) find(i Index) bool {
+	packages, pkg, ok := i.lookup(j.recipe, j.result.Recipe)
+	if !ok {
+		j.result.Status = StatusNotFound
+		return false
+	}
+	j.packages = packages
+	j.result.Name, j.result.Version = pkg.Name, pkg.Version
+	j.recipe.Name = pkg.Name
+	return true
+}
+
+func (j *job) update() bool {
+	if !j.recipe.Update(j.packages) {
+		j.result.Status = StatusUpToDate
+		return false
+	}
+	return true
+}
+
+func (j *job) render(dryRun bool) {
+	if !dryRun {
+		info, err := os.Stat(j.result.Path)
+		if err != nil {
+			j.fail(err)
+			return
+		}
+		if err := os.WriteFile(j.result.Path, []byte(j.recipe.String()), info.Mode().Perm()); err != nil {
+			j.fail(err)
+			return
+		}
+	}
+	j.result.Status = StatusUpdated
+}
+
+func (j *job) fail(err error) bool {
+	j.result.Status, j.result.Err = StatusFailed, err
+	return false
+}
+
+// lookup finds the upstream package for a recipe, using its cran or bioc
+// attribute if it has one, and otherwise mapping the recipe directory name
+// back to a package name.
+func (i Index) lookup(r recipe.Recipe, dir string) ([]recipe.Package, recipe.Package, bool) {
+	repo, name := r.Repo()
+	var match func(recipe.Package) bool
+	if name != "" {
+		match = func(p recipe.Package) bool { return p.Name == name }
+	} else {
+		match = func(p recipe.Package) bool { return recipe.SpackName(p.Name) == dir }
+	}
+	for _, packages := range [...]struct {
+		repo     string
+		packages []recipe.Package
+	}{
+		{"cran", i.CRAN},
+		{"bioc", i.Bioconductor},
+	} {
+		if repo != "" && repo != packages.repo {
+			continue
+		}
+		if n := slices.IndexFunc(packages.packages, match); n >= 0 {
+			return packages.packages, packages.packages[n], true
+		}
+	}
+	return nil, recipe.Package{}, false
+}
+
+func (s Summary) Failed() int {
+	var failed int
+	for _, r := range s {
+		if r.Status == StatusFailed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// String renders the summary as a table, grouped by status.
+func (s Summary) String() string {
+	results := slices.Clone(s)
+	slices.SortStableFunc(results, func(a, b Result) int {
+		if a.Status != b.Status {
+			return int(a.Status - b.Status)
+		}
+		return strings.Compare(a.Recipe, b.Recipe)
+	})
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RECIPE\tSTATUS\tUPSTREAM\tVERSION\tREASON")
+	counts := make(map[Status]int)
+	for _, r := range results {
+		counts[r.Status]++
+		var reason string
+		if r.Err != nil {
+			reason = r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Recipe, r.Status, r.Name, r.Version, reason)
+	}
+	w.Flush()
+	fmt.Fprintf(&sb, "\n%d updated, %d up-to-date, %d not found upstream, %d failed\n",
+		counts[StatusUpdated], counts[StatusUpToDate], counts[StatusNotFound], counts[StatusFailed])
+	return sb.String()
+}
@@ -0,0 +1,176 @@
+package batch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+)
+
+const dataTableRecipe = `from spack.package import *
+
+
+class RDataTable(RPackage):
+	version("1.14.0", md5="00000000000000000000000000000000")
+
+	depends_on("r@3.1:", type=("build", "run"))
+`
+
+func writeRepo(t *testing.T, recipes map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, contents := range recipes {
+		path := filepath.Join(root, "packages", name, "package.py")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestFindRecipes(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"r-abcrf":    testdata.TestCran1,
+		"r-a3":       dataTableRecipe,
+		"nextdenovo": testdata.TestRecipe1,
+	})
+	paths, err := FindRecipes(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join(root, "packages", "r-a3", "package.py"),
+		filepath.Join(root, "packages", "r-abcrf", "package.py"),
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"r-abcrf":        testdata.TestCran1,
+		"r-arraymvout":   testdata.TestBioc1,
+		"r-data-table":   dataTableRecipe,
+		"r-missing":      strings.Replace(testdata.TestCran1, `cran = "abcrf"`, `cran = "missing"`, 1),
+		"r-broken":       "from spack.package import *\n\n\nclass RBroken(RPackage):\n\tversion(1.0)\n",
+		"py-ignored-pkg": testdata.TestRecipe1,
+	})
+	index := Index{
+		CRAN: []recipe.Package{
+			{Name: "abcrf", Version: "2.0", MD5sum: "11111111111111111111111111111111"},
+			{Name: "data.table", Version: "1.14.0"},
+		},
+		Bioconductor: []recipe.Package{
+			{Name: "arrayMvout", Version: "1.60.0"},
+		},
+	}
+
+	summary, err := Update(root, index, Options{Concurrency: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(map[string]Status)
+	names := make(map[string]string)
+	for _, r := range summary {
+		statuses[r.Recipe] = r.Status
+		names[r.Recipe] = r.Name
+		if r.Status == StatusFailed && r.Err == nil {
+			t.Errorf("%s: failed without a reason", r.Recipe)
+		}
+	}
+	expected := map[string]Status{
+		"r-abcrf":      StatusUpdated,
+		"r-arraymvout": StatusUpToDate,
+		"r-data-table": StatusUpToDate,
+		"r-missing":    StatusNotFound,
+		"r-broken":     StatusFailed,
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("expected statuses %v, got %v", expected, statuses)
+	}
+	if names["r-data-table"] != "data.table" {
+		t.Errorf("expected r-data-table to map to data.table, got %q", names["r-data-table"])
+	}
+	if summary.Failed() != 1 {
+		t.Errorf("expected 1 failure, got %d", summary.Failed())
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "packages", "r-abcrf", "package.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\tversion(\"2.0\", md5=\"11111111111111111111111111111111\")\n\tversion(\"1.9\"") {
+		t.Errorf("recipe not updated:\n%s", data)
+	}
+
+	table := summary.String()
+	for _, line := range []string{"RECIPE", "r-abcrf", "updated", "not-found-upstream", "expected string", "1 updated, 2 up-to-date, 1 not found upstream, 1 failed"} {
+		if !strings.Contains(table, line) {
+			t.Errorf("expected summary to contain %q, got:\n%s", line, table)
+		}
+	}
+	if strings.Index(table, "r-abcrf") > strings.Index(table, "r-broken") {
+		t.Errorf("expected updated recipes before failed ones:\n%s", table)
+	}
+}
+
+func TestUpdateDryRun(t *testing.T) {
+	root := writeRepo(t, map[string]string{"r-abcrf": testdata.TestCran1})
+	index := Index{CRAN: []recipe.Package{{Name: "abcrf", Version: "2.0"}}}
+
+	summary, err := Update(root, index, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary[0].Status != StatusUpdated {
+		t.Errorf("expected updated, got %s", summary[0].Status)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "packages", "r-abcrf", "package.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != testdata.TestCran1 {
+		t.Error("dry run modified the recipe")
+	}
+}
+
+func TestUpdateConcurrency(t *testing.T) {
+	recipes := make(map[string]string)
+	var index Index
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("pkg%02d", i)
+		recipes["r-"+name] = strings.Replace(testdata.TestCran1, `cran = "abcrf"`, `cran = "`+name+`"`, 1)
+		index.CRAN = append(index.CRAN, recipe.Package{Name: name, Version: "2.0"})
+	}
+	root := writeRepo(t, recipes)
+	paths, err := FindRecipes(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := Update(root, index, Options{Concurrency: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary) != len(paths) {
+		t.Fatalf("expected %d results, got %d", len(paths), len(summary))
+	}
+	for i, r := range summary {
+		if r.Path != paths[i] {
+			t.Errorf("result %d: expected %s, got %s", i, paths[i], r.Path)
+		}
+		if r.Status != StatusUpdated {
+			t.Errorf("%s: expected updated, got %s (%v)", r.Recipe, r.Status, r.Err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package batch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+)
+
+// creation is the state of a Create run: the recipes the repository has, and
+// the packages visited so far.
+type creation struct {
+	root     string
+	index    Index
+	opts     Options
+	existing map[string]bool
+	visited  map[string]bool
+	summary  Summary
+}
+
+// Create writes recipes for the named packages that the Spack repository at
+// root doesn't have yet, and with opts.Recursive for every package they
+// depend on transitively, dependencies first. Names are upstream package
+// names or recipe names. It returns the recipes it created in the order it
+// created them, along with any dependencies that aren't in the index.
+func Create(root string, names []string, index Index, opts Options) (Summary, error) {
+	paths, err := FindRecipes(root)
+	if err != nil {
+		return nil, err
+	}
+	c := creation{root: root, index: index, opts: opts, existing: make(map[string]bool), visited: make(map[string]bool)}
+	for _, path := range paths {
+		c.existing[filepath.Base(filepath.Dir(path))] = true
+	}
+	for _, name := range names {
+		if _, _, ok := index.find(name); !ok {
+			return nil, fmt.Errorf("unknown package: %q", name)
+		}
+	}
+	for _, name := range names {
+		c.visit(name)
+	}
+	return c.summary, nil
+}
+
+func (c *creation) visit(name string) {
+	repo, pkg, ok := c.index.find(name)
+	dir := recipe.SpackName(pkg.Name)
+	if !ok {
+		dir = recipe.SpackName(name)
+	}
+	if c.visited[dir] {
+		return
+	}
+	c.visited[dir] = true
+	if !ok {
+		c.summary = append(c.summary, Result{Recipe: dir, Name: name, Status: StatusNotFound})
+		return
+	}
+	if c.opts.Recursive {
+		for _, dep := range slices.Concat(pkg.Depends, pkg.LinkingTo) {
+			if !recipe.IsBasePackage(dep.Name) {
+				c.visit(dep.Name)
+			}
+		}
+	}
+	if c.existing[dir] {
+		return
+	}
+
+	result := Result{
+		Path:    filepath.Join(c.root, "packages", dir, "package.py"),
+		Recipe:  dir,
+		Name:    pkg.Name,
+		Version: pkg.Version,
+		Status:  StatusCreated,
+	}
+	if err := c.write(result.Path, pkg, repo); err != nil {
+		result.Status, result.Err = StatusFailed, err
+	}
+	c.summary = append(c.summary, result)
+}
+
+func (c *creation) write(path string, pkg recipe.Package, repo string) error {
+	r, err := pkg.Recipe(repo)
+	if err != nil || c.opts.DryRun {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(r.String()), 0644)
+}
+
+// find looks a package up by its upstream or recipe name, returning the
+// repository it's from.
+func (i Index) find(name string) (string, recipe.Package, bool) {
+	match := func(p recipe.Package) bool { return p.Name == name || recipe.SpackName(p.Name) == name }
+	for _, packages := range [...]struct {
+		repo     string
+		packages []recipe.Package
+	}{
+		{"cran", i.CRAN},
+		{"bioc", i.Bioconductor},
+	} {
+		if n := slices.IndexFunc(packages.packages, match); n >= 0 {
+			return packages.repo, packages.packages[n], true
+		}
+	}
+	return "", recipe.Package{}, false
+}
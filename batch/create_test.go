@@ -0,0 +1,141 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+)
+
+func TestCreate(t *testing.T) {
+	index := Index{
+		CRAN: []recipe.Package{
+			{Name: "abcrf", Version: "1.9", Depends: []recipe.Dependency{{Name: "R"}, {Name: "ranger"}, {Name: "RcppArmadillo"}, {Name: "stats"}}},
+			{Name: "ranger", Version: "0.16.0", Depends: []recipe.Dependency{{Name: "Rcpp", Version: recipe.VersionRange{Min: "0.11.2"}}, {Name: "Matrix"}}},
+			{Name: "RcppArmadillo", Version: "0.12.8.1.0", MD5sum: "11111111111111111111111111111111", Depends: []recipe.Dependency{{Name: "Rcpp"}}},
+			{Name: "Rcpp", Version: "1.0.12"},
+			{Name: "Matrix", Version: "1.6-5", Depends: []recipe.Dependency{{Name: "lattice"}}},
+		},
+		Bioconductor: []recipe.Package{
+			{Name: "arrayMvout", Version: "1.60.0", Depends: []recipe.Dependency{{Name: "ranger"}}},
+		},
+	}
+
+	for _, test := range [...]struct {
+		name     string
+		existing []string
+		packages []string
+		opts     Options
+		created  []string
+		missing  []string
+	}{
+		{
+			name:     "named only",
+			packages: []string{"abcrf"},
+			created:  []string{"r-abcrf"},
+		},
+		{
+			name:     "recursive",
+			existing: []string{"r-rcpp"},
+			packages: []string{"r-abcrf"},
+			opts:     Options{Recursive: true},
+			created:  []string{"r-matrix", "r-ranger", "r-rcpparmadillo", "r-abcrf"},
+			missing:  []string{"r-lattice"},
+		},
+		{
+			name:     "shared dependencies",
+			existing: []string{"r-abcrf", "r-matrix"},
+			packages: []string{"arrayMvout", "abcrf"},
+			opts:     Options{Recursive: true},
+			created:  []string{"r-rcpp", "r-ranger", "r-arraymvout", "r-rcpparmadillo"},
+			missing:  []string{"r-lattice"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			recipes := make(map[string]string)
+			for _, name := range test.existing {
+				recipes[name] = dataTableRecipe
+			}
+			root := writeRepo(t, recipes)
+
+			summary, err := Create(root, test.packages, index, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var created, missing []string
+			for _, r := range summary {
+				switch r.Status {
+				case StatusCreated:
+					created = append(created, r.Recipe)
+				case StatusNotFound:
+					missing = append(missing, r.Recipe)
+				default:
+					t.Errorf("%s: unexpected status %s (%v)", r.Recipe, r.Status, r.Err)
+				}
+			}
+			if !reflect.DeepEqual(created, test.created) {
+				t.Errorf("expected to create %v, got %v", test.created, created)
+			}
+			if !reflect.DeepEqual(missing, test.missing) {
+				t.Errorf("expected %v to be missing, got %v", test.missing, missing)
+			}
+			for _, name := range test.existing {
+				data, err := os.ReadFile(filepath.Join(root, "packages", name, "package.py"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != dataTableRecipe {
+					t.Errorf("%s: existing recipe was modified", name)
+				}
+			}
+		})
+	}
+
+	root := writeRepo(t, nil)
+	if _, err := Create(root, []string{"abcrf"}, index, Options{Recursive: true}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "packages", "r-rcpparmadillo", "package.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"class RRcppArmadillo(RPackage):\n\tcran = \"RcppArmadillo\"\n",
+		"\tversion(\"0.12.8.1.0\", md5=\"11111111111111111111111111111111\")\n",
+		"\tdepends_on(\"r-rcpp\", type=(\"build\", \"run\"))\n",
+	} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("expected recipe to contain %q, got:\n%s", line, data)
+		}
+	}
+	data, err = os.ReadFile(filepath.Join(root, "packages", "r-abcrf", "package.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "r-stats") || !strings.Contains(string(data), "depends_on(\"r\", type=(\"build\", \"run\"))") {
+		t.Errorf("expected r but not its base packages as dependencies, got:\n%s", data)
+	}
+	if r, err := recipe.ParseFile(filepath.Join(root, "packages", "r-abcrf", "package.py")); err != nil || r.Name != "abcrf" {
+		t.Errorf("expected a recipe for abcrf, got %q (%v)", r.Name, err)
+	}
+
+	if _, err := Create(root, []string{"missing"}, index, Options{}); err == nil {
+		t.Error("expected an error for an unknown package")
+	}
+
+	root = writeRepo(t, map[string]string{"r-abcrf": testdata.TestCran1})
+	summary, err := Create(root, []string{"abcrf"}, index, Options{Recursive: true, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary) != 5 {
+		t.Errorf("expected 5 results, got %+v", summary)
+	}
+	if paths, err := FindRecipes(root); err != nil || len(paths) != 1 {
+		t.Errorf("dry run wrote recipes: %v (%v)", paths, err)
+	}
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+)
+
+func runAudit(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("audit", "package.py...", stderr)
+	asJSON := fs.Bool("json", false, "output the report as JSON")
+	upstreams := upstreamFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no recipes given")
+	}
+
+	reports := []*recipe.AuditReport{}
+	drift := false
+	for _, path := range fs.Args() {
+		r, err := recipe.ParseFile(path)
+		if err != nil {
+			return err
+		}
+		up, err := upstreams.forRecipe(r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		report, err := r.Audit(up)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		drift = drift || report.HasDrift()
+		reports = append(reports, report)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	} else {
+		for _, report := range reports {
+			fmt.Fprint(stdout, report)
+		}
+	}
+
+	if drift {
+		return errFindings
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+)
+
+func writeRecipe(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, name, "package.py")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAudit(t *testing.T) {
+	server := testdata.ServeFiles(t, map[string][]byte{
+		"/abcrf_1.9.tar.gz": testdata.Tarball(t, "abcrf", "Package: abcrf\nVersion: 1.9\nDepends: R (>= 3.1)\nImports: readr, MASS\n"),
+	})
+	path := writeRecipe(t, t.TempDir(), "r-abcrf", testdata.TestCran1)
+
+	var stdout, stderr bytes.Buffer
+	code := Execute([]string{"audit", "-cran", server.URL, path}, &stdout, &stderr)
+	if code != 1 {
+		t.Fatalf("expected exit code 1, got %d: %s", code, stderr.String())
+	}
+	for _, line := range []string{
+		"abcrf:",
+		"  1.9:",
+		"    md5 checksum mismatch: expected ",
+		"    unexpected dependency: r-matrixstats",
+	} {
+		if !strings.Contains(stdout.String(), line) {
+			t.Errorf("expected output to contain %q, got:\n%s", line, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	Execute([]string{"audit", "-json", "-cran", server.URL, path}, &stdout, &stderr)
+	var reports []struct {
+		Name     string
+		Versions []struct {
+			Version  string
+			Problems []struct{ Kind, Name string }
+		}
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &reports); err != nil {
+		t.Fatalf("invalid JSON: %s\n%s", err, stdout.String())
+	}
+	if len(reports) != 1 || reports[0].Name != "abcrf" || reports[0].Versions[0].Problems[0].Kind != "checksum_mismatch" {
+		t.Errorf("unexpected report: %+v", reports)
+	}
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != testdata.TestCran1 {
+		t.Error("audit modified the recipe")
+	}
+}
+
+func TestAuditSyntaxError(t *testing.T) {
+	path := writeRecipe(t, t.TempDir(), "r-abcrf", strings.Replace(testdata.TestCran1, `version("1.9",`, `version("1.9"`, 1))
+
+	var stdout, stderr bytes.Buffer
+	if code := Execute([]string{"audit", path}, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit code 1, got %d", code)
+	}
+	expected := "audit: " + path + ":20:16: failed to parse version: expected ','\n"
+	if stderr.String() != expected {
+		t.Errorf("expected error %q, got %q", expected, stderr.String())
+	}
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/batch"
+)
+
+func runCreate(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("create", "spack-repo package...", stderr)
+	recursive := fs.Bool("recursive", false, "also create recipes for every missing dependency, transitively")
+	dryRun := fs.Bool("n", false, "report what would be created without writing any recipes")
+	upstreams := upstreamFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("expected a Spack repository and packages to create")
+	}
+
+	index, err := upstreams.index()
+	if err != nil {
+		return err
+	}
+	summary, err := batch.Create(fs.Arg(0), fs.Args()[1:], index, batch.Options{DryRun: *dryRun, Recursive: *recursive})
+	if err != nil {
+		return err
+	}
+	var created, missing int
+	for _, r := range summary {
+		switch r.Status {
+		case batch.StatusCreated:
+			created++
+			fmt.Fprintf(stdout, "created %s (%s %s)\n", r.Recipe, r.Name, r.Version)
+		case batch.StatusNotFound:
+			missing++
+			fmt.Fprintf(stdout, "%s: not found upstream\n", r.Recipe)
+		case batch.StatusFailed:
+			fmt.Fprintf(stdout, "%s: %s\n", r.Recipe, r.Err)
+		}
+	}
+	fmt.Fprintf(stdout, "\n%d created, %d not found upstream, %d failed\n", created, missing, summary.Failed())
+	if failed := summary.Failed(); failed > 0 {
+		return fmt.Errorf("%d recipes failed", failed)
+	}
+	if missing > 0 {
+		return errFindings
+	}
+	return nil
+}
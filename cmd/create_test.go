@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+)
+
+func TestCreate(t *testing.T) {
+	cran := testdata.ServeFiles(t, map[string][]byte{
+		"/PACKAGES": []byte("Package: abcrf\nVersion: 1.9\nDepends: R (>= 3.1)\nImports: ranger, stats\n\n" +
+			"Package: ranger\nVersion: 0.16.0\nImports: Rcpp (>= 0.11.2)\nMD5sum: 11111111111111111111111111111111\n\n" +
+			"Package: Rcpp\nVersion: 1.0.12\n"),
+	})
+	bioc := testdata.ServeFiles(t, map[string][]byte{"/PACKAGES": []byte("Package: arrayMvout\nVersion: 1.60.0\n")})
+	root := t.TempDir()
+	writeRecipe(t, filepath.Join(root, "packages"), "r-rcpp", testdata.TestCran1)
+
+	var stdout, stderr bytes.Buffer
+	if code := Execute([]string{"create", "-cran", cran.URL, "-bioc", bioc.URL, "--recursive", root, "abcrf"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if expected := "created r-ranger (ranger 0.16.0)\ncreated r-abcrf (abcrf 1.9)\n\n2 created, 0 not found upstream, 0 failed\n"; stdout.String() != expected {
+		t.Errorf("expected %q, got %q", expected, stdout.String())
+	}
+	for _, name := range []string{"r-abcrf", "r-ranger"} {
+		if _, err := os.Stat(filepath.Join(root, "packages", name, "package.py")); err != nil {
+			t.Error(err)
+		}
+	}
+
+	stdout.Reset()
+	if code := Execute([]string{"create", "-cran", cran.URL, "-bioc", bioc.URL, root, "arrayMvout"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	data, err := os.ReadFile(filepath.Join(root, "packages", "r-arraymvout", "package.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("\tbioc = \"arrayMvout\"\n")) {
+		t.Errorf("expected a Bioconductor recipe, got:\n%s", data)
+	}
+
+	for _, args := range [][]string{{root}, {root, "missing"}} {
+		if code := Execute(append([]string{"create", "-cran", cran.URL, "-bioc", bioc.URL}, args...), &stdout, &stderr); code != 1 {
+			t.Errorf("expected exit code 1 for %q, got %d", args, code)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+)
+
+func runDiff(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("diff", "old.py new.py", stderr)
+	asJSON := fs.Bool("json", false, "output the changes as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected two recipes")
+	}
+	a, err := recipe.ParseFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := recipe.ParseFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	diff := recipe.Diff(a, b)
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(diff); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprint(stdout, diff.String())
+	}
+
+	if !diff.Empty() {
+		return errFindings
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+)
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	old := writeRecipe(t, dir, "old", testdata.TestCran1)
+	updated := strings.NewReplacer(
+		"\tversion(\"1.9\"", "\tversion(\"1.10\", md5=\"11111111111111111111111111111111\")\n\tversion(\"1.9\"",
+		"depends_on(\"r-mass\", type=(\"build\", \"run\"))", "depends_on(\"r-mass\", type=(\"build\", \"run\"), when=\"@:1.9\")",
+	).Replace(testdata.TestCran1)
+	new := writeRecipe(t, dir, "new", updated)
+
+	var stdout, stderr bytes.Buffer
+	if code := Execute([]string{"diff", old, new}, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit code 1, got %d: %s", code, stderr.String())
+	}
+	if expected := "added version 1.10 (md5 11111111111111111111111111111111)\n" +
+		"dropped r-mass for @1.10:\n"; stdout.String() != expected {
+		t.Errorf("expected %q, got %q", expected, stdout.String())
+	}
+
+	stdout.Reset()
+	if code := Execute([]string{"diff", "-json", old, new}, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit code 1, got %d: %s", code, stderr.String())
+	}
+	var diff recipe.RecipeDiff
+	if err := json.Unmarshal(stdout.Bytes(), &diff); err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Versions) != 1 || diff.Versions[0].Kind != recipe.ChangeAdded || diff.Versions[0].Name != "1.10" {
+		t.Errorf("expected version 1.10 to be added, got %+v", diff.Versions)
+	}
+
+	stdout.Reset()
+	if code := Execute([]string{"diff", old, old}, &stdout, &stderr); code != 0 || stdout.Len() != 0 {
+		t.Errorf("expected exit code 0 and no output, got %d: %s", code, stdout.String())
+	}
+	if code := Execute([]string{"diff", old}, &stdout, &stderr); code != 1 {
+		t.Errorf("expected exit code 1 for a single recipe, got %d", code)
+	}
+}
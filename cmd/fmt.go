@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+)
+
+func runFmt(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("fmt", "package.py...", stderr)
+	indent := fs.String("indent", "4", `indentation of one level: a number of spaces or "tab"`)
+	quote := fs.String("quote", `"`, "quote character for strings")
+	width := fs.Int("width", 99, "width to wrap docstrings to, or 0 to leave them")
+	list := fs.Bool("l", false, "list the recipes whose formatting differs, exiting non-zero if there are any")
+	write := fs.Bool("w", false, "write the formatted recipes back instead of printing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no recipes given")
+	}
+	style := recipe.Style{Width: *width}
+	if *indent == "tab" {
+		style.Indent = "\t"
+	} else if n, err := strconv.Atoi(*indent); err == nil && n > 0 {
+		style.Indent = strings.Repeat(" ", n)
+	} else {
+		return fmt.Errorf("invalid indentation: %q", *indent)
+	}
+	if *quote != `"` && *quote != "'" {
+		return fmt.Errorf("invalid quote character: %q", *quote)
+	}
+	style.Quote = (*quote)[0]
+
+	differ := false
+	for _, path := range fs.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		r, err := recipe.ParseFile(path)
+		if err != nil {
+			return err
+		}
+		if err := r.Format(style); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		formatted := r.String()
+		switch {
+		case *list:
+			if formatted != string(data) {
+				fmt.Fprintln(stdout, path)
+				differ = true
+			}
+		case *write:
+			if formatted != string(data) {
+				if err := saveRecipe(path, r); err != nil {
+					return err
+				}
+			}
+		default:
+			fmt.Fprint(stdout, formatted)
+		}
+	}
+
+	if differ {
+		return errFindings
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+)
+
+func TestFmt(t *testing.T) {
+	dir := t.TempDir()
+	bioc := writeRecipe(t, dir, "r-arraymvout", testdata.TestBioc1)
+	cran := writeRecipe(t, dir, "r-abcrf", testdata.TestCran1)
+
+	var stdout, stderr bytes.Buffer
+	if code := Execute([]string{"fmt", "-indent", "tab", "-width", "0", bioc}, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	for _, line := range []string{
+		"\n\tbioc = \"arrayMvout\"\n",
+		"\n\tdepends_on(\"r@2.6:\", type=(\"build\", \"run\"))\n\tdepends_on(\"r-affy\", type=(\"build\", \"run\"))\n",
+	} {
+		if !strings.Contains(stdout.String(), line) {
+			t.Errorf("expected output to contain %q, got:\n%s", line, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	if code := Execute([]string{"fmt", "-l", bioc, cran}, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit code 1, got %d: %s", code, stderr.String())
+	}
+	if expected := bioc + "\n" + cran + "\n"; stdout.String() != expected {
+		t.Errorf("expected %q, got %q", expected, stdout.String())
+	}
+
+	stdout.Reset()
+	if code := Execute([]string{"fmt", "-w", bioc, cran}, &stdout, &stderr); code != 0 || stdout.Len() != 0 {
+		t.Fatalf("expected exit code 0 and no output, got %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	if code := Execute([]string{"fmt", "-l", bioc, cran}, &stdout, &stderr); code != 0 || stdout.Len() != 0 {
+		t.Errorf("expected formatting to be stable, got exit code %d: %s", code, stdout.String())
+	}
+	data, err := os.ReadFile(cran)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\n    cran = \"abcrf\"\n") {
+		t.Errorf("expected the recipe to be indented with spaces, got:\n%s", data)
+	}
+
+	for _, args := range [][]string{{"-indent", "x"}, {"-quote", "`"}} {
+		if code := Execute(append(append([]string{"fmt"}, args...), cran), &stdout, &stderr); code != 1 {
+			t.Errorf("expected exit code 1 for %q, got %d", args, code)
+		}
+	}
+}
+
+func TestFmtKeepsComments(t *testing.T) {
+	input := "class RA(RPackage):\n" +
+		"    cran = 'a'  # on CRAN\n\n" +
+		"    # Old, but kept for reproducibility.\n" +
+		"    version('1.0', md5='" + strings.Repeat("a", 32) + "')\n" +
+		"    version('2.0', md5='" + strings.Repeat("b", 32) + "')\n\n" +
+		"    depends_on('r-b')\n" +
+		"    # Needed since 3.0.\n" +
+		"    depends_on('r@3:')\n"
+	expected := "class RA(RPackage):\n" +
+		"\tcran = \"a\"  # on CRAN\n\n" +
+		"\tversion(\"2.0\", md5=\"" + strings.Repeat("b", 32) + "\")\n" +
+		"\t# Old, but kept for reproducibility.\n" +
+		"\tversion(\"1.0\", md5=\"" + strings.Repeat("a", 32) + "\")\n\n" +
+		"\t# Needed since 3.0.\n" +
+		"\tdepends_on(\"r@3:\")\n" +
+		"\tdepends_on(\"r-b\")\n"
+	path := writeRecipe(t, t.TempDir(), "r-a", input)
+
+	var stdout, stderr bytes.Buffer
+	if code := Execute([]string{"fmt", "-w", "-indent", "tab", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, data)
+	}
+	if code := Execute([]string{"fmt", "-l", "-indent", "tab", path}, &stdout, &stderr); code != 0 || stdout.Len() != 0 {
+		t.Errorf("expected formatting to be stable, got exit code %d: %s", code, stdout.String())
+	}
+}
+
+func TestFmtKeepsCommentsInsideCalls(t *testing.T) {
+	input := "class RA(RPackage):\n" +
+		"    version('1.0', md5='" + strings.Repeat("a", 32) + "')\n" +
+		"    version(\n" +
+		"        '1.1.0',\n" +
+		"        md5='" + strings.Repeat("b", 32) + "',  # from the archive\n" +
+		"    )\n"
+	expected := "class RA(RPackage):\n" +
+		"\tversion(\n" +
+		"\t\t\"1.1.0\",\n" +
+		"\t\tmd5=\"" + strings.Repeat("b", 32) + "\",  # from the archive\n" +
+		"\t)\n" +
+		"\tversion(\"1.0\", md5=\"" + strings.Repeat("a", 32) + "\")\n"
+	path := writeRecipe(t, t.TempDir(), "r-a", input)
+
+	var stdout, stderr bytes.Buffer
+	if code := Execute([]string{"fmt", "-indent", "tab", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if stdout.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, stdout.String())
+	}
+
+	stdout.Reset()
+	if code := Execute([]string{"fmt", "-w", "-indent", "tab", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, data)
+	}
+	if code := Execute([]string{"fmt", "-l", "-indent", "tab", path}, &stdout, &stderr); code != 0 || stdout.Len() != 0 {
+		t.Errorf("expected formatting to be stable, got exit code %d: %s", code, stdout.String())
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/lint"
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+// lintReport is the result of linting a single recipe. Fixed holds the
+// problems that were fixed when fixing was asked for.
+type lintReport struct {
+	Path     string         `json:"path"`
+	Problems []lint.Problem `json:"problems"`
+	Fixed    []lint.Problem `json:"fixed,omitempty"`
+}
+
+func runLint(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("lint", "package.py...", stderr)
+	asJSON := fs.Bool("json", false, "output the problems as JSON")
+	fix := fs.Bool("fix", false, "fix the problems that can be fixed safely, rewriting the recipes")
+	names := fs.String("rules", "", "comma-separated names of the rules to check (default all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no recipes given")
+	}
+	rules := lint.Rules
+	if *names != "" {
+		rules = nil
+		for _, name := range strings.Split(*names, ",") {
+			rule, ok := lint.Lookup(name)
+			if !ok {
+				return fmt.Errorf("unknown rule: %q", name)
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	reports := []lintReport{}
+	found := false
+	for _, path := range fs.Args() {
+		report := lintReport{Path: path}
+		r, err := recipe.ParseFile(path)
+		var parseErr *recipe.ParseError
+		if errors.As(err, &parseErr) {
+			report.Problems = lint.ParseErrors(parseErr.Diagnostics, rules)
+			found = true
+			reports = append(reports, sortProblems(report))
+			continue
+		} else if err != nil {
+			return err
+		}
+		if *fix {
+			if report.Fixed = lint.Fix(&r, rules); len(report.Fixed) > 0 {
+				if err := saveRecipe(path, r); err != nil {
+					return err
+				}
+				// The fixes moved things around, so the recipe is read back
+				// for the positions of what's left.
+				if r, err = recipe.ParseFile(path); err != nil {
+					return err
+				}
+			}
+		}
+		report.Problems = lint.Lint(r, rules)
+		if report.Problems == nil {
+			report.Problems = []lint.Problem{}
+		}
+		found = found || len(report.Problems) > 0
+		reports = append(reports, sortProblems(report))
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	} else {
+		for _, report := range reports {
+			for _, p := range report.Fixed {
+				fmt.Fprintf(stdout, "%s: fixed %s\n", report.Path, p)
+			}
+			for _, p := range report.Problems {
+				fmt.Fprintf(stdout, "%s: %s\n", location(report.Path, p.Pos), p)
+			}
+		}
+	}
+
+	if found {
+		return errFindings
+	}
+	return nil
+}
+
+// sortProblems orders the problems in a report by where they are in the file.
+func sortProblems(report lintReport) lintReport {
+	slices.SortStableFunc(report.Problems, func(a, b lint.Problem) int {
+		return a.Pos.Offset - b.Pos.Offset
+	})
+	return report
+}
+
+// location prefixes a path with the line and column of a position, when it has
+// one.
+func location(path string, pos tokeniser.Position) string {
+	if pos.Line == 0 {
+		return path
+	}
+	return fmt.Sprintf("%s:%d:%d", path, pos.Line, pos.Column)
+}
+
+// saveRecipe renders a recipe over the file it was read from, keeping its
+// permissions.
+func saveRecipe(path string, r recipe.Recipe) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(r.String()), info.Mode().Perm())
+}
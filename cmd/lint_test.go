@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+)
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	clean := writeRecipe(t, dir, "r-abcrf", testdata.TestCran1)
+	input := strings.Replace(testdata.TestCran1, "class RAbcrf", "class RAbc", 1)
+	input = strings.Replace(input, "\tdepends_on(\"r@3.1:\", type=(\"build\", \"run\"))\n", "", 1)
+	input = strings.Replace(input, "\tdepends_on(\"r-rcpp\"", "\tdepends_on(\"r@3.1:\", type=(\"build\", \"run\"))\n\tdepends_on(\"r-rcpp\"", 1)
+	path := writeRecipe(t, dir, "r-abc", input)
+
+	var stdout, stderr bytes.Buffer
+	if code := Execute([]string{"lint", clean}, &stdout, &stderr); code != 0 || stdout.Len() != 0 {
+		t.Errorf("expected no problems, got exit code %d: %s%s", code, stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	if code := Execute([]string{"lint", path}, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit code 1, got %d: %s", code, stderr.String())
+	}
+	line := func(s string) int { return strings.Count(input[:strings.Index(input, s)], "\n") + 1 }
+	expected := fmt.Sprintf("%s:%d:1: ", path, line("class RAbc")) + `class-name: class RAbc should be named RAbcrf after cran = "abcrf"` + "\n" +
+		fmt.Sprintf("%s:%d:2: ", path, line("\tdepends_on(\"r@3.1:\"")) + `r-first: depends_on("r@3.1:", type=("build", "run")) should come before the other dependencies` + "\n"
+	if stdout.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, stdout.String())
+	}
+
+	stdout.Reset()
+	if code := Execute([]string{"lint", "-json", "-fix", "-rules", "r-first,class-name", path}, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit code 1, got %d: %s", code, stderr.String())
+	}
+	var reports []struct {
+		Path            string
+		Problems, Fixed []struct {
+			Rule, Message string
+			Position      struct{ Line, Column int }
+			Fixable       bool
+		}
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &reports); err != nil {
+		t.Fatalf("invalid JSON: %s\n%s", err, stdout.String())
+	}
+	if len(reports) != 1 || len(reports[0].Fixed) != 1 || reports[0].Fixed[0].Rule != "r-first" ||
+		len(reports[0].Problems) != 1 || reports[0].Problems[0].Rule != "class-name" || reports[0].Problems[0].Fixable ||
+		reports[0].Problems[0].Position.Line != line("class RAbc") || reports[0].Problems[0].Position.Column != 1 {
+		t.Errorf("unexpected report: %+v", reports)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixed := strings.Replace(testdata.TestCran1, "class RAbcrf", "class RAbc", 1); string(data) != fixed {
+		t.Errorf("expected the dependency on r to be moved first, got:\n%s", data)
+	}
+
+	if code := Execute([]string{"lint", "-rules", "missing", path}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), `unknown rule: "missing"`) {
+		t.Errorf("expected an unknown rule error, got exit code %d: %s", code, stderr.String())
+	}
+}
+
+func TestLintFixKeepsLayout(t *testing.T) {
+	input := "class RA(RPackage):\n" +
+		"\tcran = \"a\"\n\n" +
+		"\tversion(\"1.0\", md5=\"" + strings.Repeat("a", 32) + "\")\n\n" +
+		"\t# Needs the newer compiler.\n" +
+		"\tdepends_on(\"r-b\")\n" +
+		"\tdepends_on(\"r@3:\")  # R itself\n\n" +
+		"\tdef install(self, spec, prefix):\n" +
+		"\t\tpass\n\n" +
+		"\tversion(\"2.0\", md5=\"" + strings.Repeat("b", 32) + "\")\n"
+	path := writeRecipe(t, t.TempDir(), "r-a", input)
+
+	var stdout, stderr bytes.Buffer
+	if code := Execute([]string{"lint", "-fix", "-rules", "r-first", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(input,
+		"\t# Needs the newer compiler.\n\tdepends_on(\"r-b\")\n\tdepends_on(\"r@3:\")  # R itself\n",
+		"\tdepends_on(\"r@3:\")  # R itself\n\t# Needs the newer compiler.\n\tdepends_on(\"r-b\")\n", 1)
+	if string(data) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, data)
+	}
+}
+
+func TestLintFixRereadsPositions(t *testing.T) {
+	md5 := strings.Repeat("a", 32)
+	input := "class RA(RPackage):\n" +
+		"\tcran = \"a\"\n\n" +
+		"\tversion(\"2.0\", md5=\"" + md5 + "\")\n" +
+		"\tversion(\"2.0\", md5=\"" + md5 + "\")\n\n" +
+		"\tdepends_on(\"r-b\")\n" +
+		"\tdepends_on(\"r-b@2:\")\n"
+	path := writeRecipe(t, t.TempDir(), "r-a", input)
+
+	var stdout, stderr bytes.Buffer
+	if code := Execute([]string{"lint", "-fix", "-rules", "version-order,duplicate-dependency", path}, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit code 1, got %d: %s", code, stderr.String())
+	}
+	expected := path + ": fixed version-order: version 2.0 is declared more than once\n" +
+		path + ":7:2: duplicate-dependency: depends_on(\"r-b@2:\") overlaps depends_on(\"r-b\")\n"
+	if stdout.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, stdout.String())
+	}
+}
+
+func TestLintParseErrors(t *testing.T) {
+	input := "class RA(RPackage):\n" +
+		"\tcran = \"a\"\n\n" +
+		"\tversion(\"1.0\"\n" +
+		"\tdepends_on(\"r-b\", type=\"rnu\")\n"
+	path := writeRecipe(t, t.TempDir(), "r-a", input)
+
+	var stdout, stderr bytes.Buffer
+	if code := Execute([]string{"lint", path}, &stdout, &stderr); code != 1 {
+		t.Fatalf("expected exit code 1, got %d: %s", code, stderr.String())
+	}
+	expected := path + ":4:9: parse-error: unmatched bracket\n" +
+		path + `:5:25: parse-error: failed to parse depends_on: invalid dependency type "rnu"` + "\n"
+	if stdout.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, stdout.String())
+	}
+}
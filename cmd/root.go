@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, stdout, stderr io.Writer) error
+}
+
+var commands = [...]command{
+	{"audit", "report drift between recipes and their upstream metadata", runAudit},
+	{"create", "create recipes for packages missing from a Spack repository", runCreate},
+	{"update", "update every R recipe in a Spack repository", runUpdate},
+	{"lint", "check recipes against the review rules", runLint},
+	{"fmt", "lay out recipes in a canonical style", runFmt},
+	{"diff", "describe what changed between two recipes", runDiff},
+}
+
+// errFindings is returned by commands that completed but found something to
+// report, such as lint problems, differences or audit failures, so that the
+// process exits non-zero without printing a further error.
+var errFindings = errors.New("findings")
+
+func Execute(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+		err := c.run(args[1:], stdout, stderr)
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, errFindings):
+			return 1
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		}
+		fmt.Fprintf(stderr, "%s: %s\n", c.name, err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "unknown command: %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: uber-recipe-creator <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: uber-recipe-creator %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
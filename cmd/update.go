@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/batch"
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+)
+
+func runUpdate(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("update", "spack-repo", stderr)
+	dryRun := fs.Bool("n", false, "report what would be updated without writing any recipes")
+	concurrency := fs.Int("j", runtime.NumCPU(), "number of recipes to process concurrently")
+	upstreams := upstreamFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected a single Spack repository")
+	}
+
+	index, err := upstreams.index()
+	if err != nil {
+		return err
+	}
+	summary, err := batch.Update(fs.Arg(0), index, batch.Options{DryRun: *dryRun, Concurrency: *concurrency})
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(stdout, summary)
+	if failed := summary.Failed(); failed > 0 {
+		return fmt.Errorf("%d recipes failed", failed)
+	}
+	return nil
+}
+
+func (u *upstreams) index() (batch.Index, error) {
+	var index batch.Index
+	var err error
+	if index.CRAN, err = recipe.Database(u.cran); err != nil {
+		return index, err
+	}
+	if index.Bioconductor, err = recipe.Database(u.bioc); err != nil {
+		return index, err
+	}
+	return index, nil
+}
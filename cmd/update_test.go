@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+)
+
+func TestUpdate(t *testing.T) {
+	cran := testdata.ServeFiles(t, map[string][]byte{
+		"/PACKAGES": []byte("Package: abcrf\nVersion: 2.0\nDepends: R (>= 3.1)\nImports: readr\nMD5sum: 11111111111111111111111111111111\n"),
+	})
+	bioc := testdata.ServeFiles(t, map[string][]byte{
+		"/PACKAGES": []byte("Package: arrayMvout\nVersion: 1.60.0\n"),
+	})
+	root := t.TempDir()
+	path := writeRecipe(t, filepath.Join(root, "packages"), "r-abcrf", testdata.TestCran1)
+	writeRecipe(t, filepath.Join(root, "packages"), "r-arraymvout", testdata.TestBioc1)
+
+	var stdout, stderr bytes.Buffer
+	if code := Execute([]string{"update", "-cran", cran.URL, "-bioc", bioc.URL, root}, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "1 updated, 1 up-to-date, 0 not found upstream, 0 failed") {
+		t.Errorf("unexpected summary:\n%s", stdout.String())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `version("2.0", md5="11111111111111111111111111111111")`) {
+		t.Errorf("recipe not updated:\n%s", data)
+	}
+}
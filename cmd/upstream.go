@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+)
+
+type upstreams struct {
+	cran, bioc string
+}
+
+func upstreamFlags(fs *flag.FlagSet) *upstreams {
+	var u upstreams
+	fs.StringVar(&u.cran, "cran", recipe.CRANURL, "base URL of the CRAN source repository")
+	fs.StringVar(&u.bioc, "bioc", recipe.BioconductorURL, "base URL of the Bioconductor source repository")
+	return &u
+}
+
+func (u *upstreams) forRecipe(r recipe.Recipe) (recipe.Upstream, error) {
+	switch repo, _ := r.Repo(); repo {
+	case "cran":
+		return recipe.Repository{URL: u.cran}, nil
+	case "bioc":
+		return recipe.Repository{URL: u.bioc}, nil
+	}
+	return nil, errors.New("recipe has no cran or bioc attribute")
+}
@@ -1,7 +1,5 @@
 module github.com/wtsi-hgi/uber-recipe-creator
 
-go 1.21.6
+go 1.23
 
-require (
-	github.com/iancoleman/strcase v0.3.0
-)
+require github.com/iancoleman/strcase v0.3.0
@@ -0,0 +1,48 @@
+package testdata
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Tarball returns a gzipped tarball of a package source holding only its
+// DESCRIPTION file, as a repository serves it.
+func Tarball(t testing.TB, name, description string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: name + "/DESCRIPTION", Mode: 0644, Size: int64(len(description))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(description)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// ServeFiles starts a server for the duration of a test that serves the
+// given files by path, and 404s for anything else.
+func ServeFiles(t testing.TB, files map[string][]byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
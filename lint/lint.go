@@ -0,0 +1,99 @@
+package lint
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/parser"
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+// Rule checks a recipe for one kind of problem. Name identifies it in
+// reports, such as "version-order".
+type Rule interface {
+	Name() string
+	Check(r recipe.Recipe) []Problem
+}
+
+// Fixer is a Rule that can fix the problems it reports as Fixable without
+// changing what the recipe means.
+type Fixer interface {
+	Rule
+	Fix(r *recipe.Recipe)
+}
+
+// Problem is something a rule found wrong with a recipe. Pos is where in the
+// recipe's file the directive or class it's about is, if it was parsed.
+type Problem struct {
+	Rule    string             `json:"rule"`
+	Pos     tokeniser.Position `json:"position"`
+	Msg     string             `json:"message"`
+	Fixable bool               `json:"fixable"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Rule, p.Msg)
+}
+
+// Rules are the built-in rules, in the order their problems are reported.
+var Rules = []Rule{parseWarning{}, versionOrder{}, duplicateDependency{}, rFirst{}, className{}}
+
+// Lookup returns the built-in rule with the given name.
+func Lookup(name string) (Rule, bool) {
+	i := slices.IndexFunc(Rules, func(rule Rule) bool { return rule.Name() == name })
+	if i < 0 {
+		return nil, false
+	}
+	return Rules[i], true
+}
+
+// Lint checks the recipe against each of the rules.
+func Lint(r recipe.Recipe, rules []Rule) []Problem {
+	var problems []Problem
+	for _, rule := range rules {
+		for _, p := range rule.Check(r) {
+			p.Rule = rule.Name()
+			problems = append(problems, p)
+		}
+	}
+	return problems
+}
+
+// ParseErrors returns the problems found parsing a recipe that has syntax
+// errors, and so can't be checked against the rules: each error, under the
+// parse-error rule, along with the warnings if parse-warning is one of the
+// rules.
+func ParseErrors(ds parser.Diagnostics, rules []Rule) []Problem {
+	warnings := slices.ContainsFunc(rules, func(rule Rule) bool { return rule.Name() == parseWarning{}.Name() })
+	var problems []Problem
+	for _, d := range ds {
+		switch {
+		case d.Severity == parser.SeverityError:
+			problems = append(problems, Problem{Rule: "parse-error", Pos: d.Pos, Msg: d.Msg})
+		case warnings:
+			problems = append(problems, Problem{Rule: parseWarning{}.Name(), Pos: d.Pos, Msg: d.Msg})
+		}
+	}
+	return problems
+}
+
+// Fix applies the fixes of the rules that found fixable problems, returning
+// the problems that were fixed, at the positions they were found at.
+func Fix(r *recipe.Recipe, rules []Rule) []Problem {
+	before := Lint(*r, rules)
+	for _, rule := range rules {
+		fixer, ok := rule.(Fixer)
+		if ok && slices.ContainsFunc(before, func(p Problem) bool { return p.Rule == rule.Name() && p.Fixable }) {
+			fixer.Fix(r)
+		}
+	}
+	after := Lint(*r, rules)
+	var fixed []Problem
+	for _, p := range before {
+		if p.Fixable && !slices.ContainsFunc(after, func(q Problem) bool { return q.Rule == p.Rule && q.Msg == p.Msg }) {
+			fixed = append(fixed, p)
+		}
+	}
+	return fixed
+}
@@ -0,0 +1,102 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+	"github.com/wtsi-hgi/uber-recipe-creator/parser"
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+// parse reads a recipe from the given source.
+func parse(t *testing.T, source string) recipe.Recipe {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "package.py")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := recipe.ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestLintTestdata(t *testing.T) {
+	for n, input := range [...]string{testdata.TestRecipe1, testdata.TestCran1, testdata.TestBioc1} {
+		if problems := Lint(parse(t, input), Rules); problems != nil {
+			t.Errorf("Test %d: expected no problems, got %+v", n+1, problems)
+		}
+	}
+}
+
+// position returns the position of the first occurrence of substr in source.
+func position(source, substr string) tokeniser.Position {
+	offset := strings.Index(source, substr)
+	line := strings.Count(source[:offset], "\n") + 1
+	return tokeniser.Position{Offset: offset, Line: line, Column: offset - strings.LastIndex(source[:offset], "\n")}
+}
+
+func TestLint(t *testing.T) {
+	input := "class RB(RPackage):\n\tcran = \"a\"\n\n" +
+		"\tversion(\"1.0\", md5=\"" + md5a + "\")\n\tversion(\"2.0\", md5=\"" + md5b + "\")\n\n" +
+		"\tdepends_on(\"r-b\")\n\tdepends_on(\"r@3:\")\n"
+	r := parse(t, input)
+	expected := []Problem{
+		{Rule: "version-order", Pos: position(input, `version("2.0"`), Msg: "version 2.0 should come before 1.0", Fixable: true},
+		{Rule: "r-first", Pos: position(input, `depends_on("r@3:")`), Msg: `depends_on("r@3:") should come before the other dependencies`, Fixable: true},
+		{Rule: "class-name", Pos: position(input, "class"), Msg: `class RB should be named RA after cran = "a"`},
+	}
+	if problems := Lint(r, Rules); !reflect.DeepEqual(problems, expected) {
+		t.Fatalf("expected problems %+v, got %+v", expected, problems)
+	}
+
+	fixed := Fix(&r, Rules)
+	if !reflect.DeepEqual(fixed, expected[:2]) {
+		t.Errorf("expected fixed problems %+v, got %+v", expected[:2], fixed)
+	}
+	if problems := Lint(r, Rules); !reflect.DeepEqual(problems, expected[2:]) {
+		t.Errorf("expected problems %+v after fixing, got %+v", expected[2:], problems)
+	}
+	if r.Versions[0].Version != "2.0" || r.Dependencies[0].Spec.Name != "r" {
+		t.Errorf("expected the recipe to be fixed, got %+v", r)
+	}
+
+	if fixed := Fix(&r, []Rule{className{}}); fixed != nil {
+		t.Errorf("expected nothing to be fixed, got %+v", fixed)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, rule := range Rules {
+		if found, ok := Lookup(rule.Name()); !ok || found != rule {
+			t.Errorf("expected to find rule %s", rule.Name())
+		}
+	}
+	if _, ok := Lookup("missing"); ok {
+		t.Error("expected no rule named missing")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	_, diagnostics := parser.Parse("class A(RPackage):\n" +
+		"\tversion(\"1.0\", commit=\"abc1234\")\n" +
+		"\tversion(\"2.0\"\n" +
+		"\tdepends_on(\"r-b\", type=\"rnu\")\n")
+	errs := []Problem{
+		{Rule: "parse-error", Pos: tokeniser.Position{Offset: 61, Line: 3, Column: 9}, Msg: "unmatched bracket"},
+		{Rule: "parse-error", Pos: tokeniser.Position{Offset: 92, Line: 4, Column: 25}, Msg: `failed to parse depends_on: invalid dependency type "rnu"`},
+	}
+	warning := Problem{Rule: "parse-warning", Pos: tokeniser.Position{Offset: 42, Line: 2, Column: 24}, Msg: "abbreviated commit hash"}
+	if got := ParseErrors(diagnostics, Rules); !reflect.DeepEqual(got, append([]Problem{warning}, errs...)) {
+		t.Errorf("expected every problem, got %+v", got)
+	}
+	if got := ParseErrors(diagnostics, []Rule{rFirst{}}); !reflect.DeepEqual(got, errs) {
+		t.Errorf("expected only the errors, got %+v", got)
+	}
+}
@@ -0,0 +1,182 @@
+package lint
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/recipe"
+	"github.com/wtsi-hgi/uber-recipe-creator/spec"
+)
+
+// parseWarning reports the problems found when parsing the recipe that
+// didn't stop it being parsed, such as abbreviated commit hashes.
+type parseWarning struct{}
+
+func (parseWarning) Name() string {
+	return "parse-warning"
+}
+
+func (parseWarning) Check(r recipe.Recipe) []Problem {
+	var problems []Problem
+	for _, d := range r.Warnings() {
+		problems = append(problems, Problem{Pos: d.Pos, Msg: d.Msg})
+	}
+	return problems
+}
+
+// versionOrder checks that versions are newest first and that none is
+// declared twice. Only duplicates identical to an earlier version are fixable.
+type versionOrder struct{}
+
+func (versionOrder) Name() string {
+	return "version-order"
+}
+
+func (versionOrder) Check(r recipe.Recipe) []Problem {
+	var problems []Problem
+	positions := r.Positions().Versions
+	for i, v := range r.Versions {
+		if j := slices.IndexFunc(r.Versions[:i], func(w recipe.Version) bool { return w.Version == v.Version }); j >= 0 {
+			problems = append(problems, Problem{
+				Pos:     positions[i],
+				Msg:     fmt.Sprintf("version %s is declared more than once", v.Version),
+				Fixable: reflect.DeepEqual(r.Versions[j], v),
+			})
+		} else if i > 0 && spec.CompareVersions(r.Versions[i-1].Version, v.Version) < 0 {
+			problems = append(problems, Problem{
+				Pos:     positions[i],
+				Msg:     fmt.Sprintf("version %s should come before %s", v.Version, r.Versions[i-1].Version),
+				Fixable: true,
+			})
+		}
+	}
+	return problems
+}
+
+func (versionOrder) Fix(r *recipe.Recipe) {
+	var versions []recipe.Version
+	for _, v := range r.Versions {
+		if !slices.ContainsFunc(versions, func(w recipe.Version) bool { return reflect.DeepEqual(w, v) }) {
+			versions = append(versions, v)
+		}
+	}
+	r.Versions = versions
+	r.SortVersions()
+}
+
+// duplicateDependency checks that no package is depended on twice for the
+// same version of the recipe, taking the blocks the directives are in into
+// account. Only directives identical to an earlier one are fixable.
+type duplicateDependency struct{}
+
+func (duplicateDependency) Name() string {
+	return "duplicate-dependency"
+}
+
+func (duplicateDependency) Check(r recipe.Recipe) []Problem {
+	var problems []Problem
+	positions := r.Positions().Dependencies
+	resolved := resolveDependencies(r.Dependencies)
+	for i, d := range resolved {
+		if d == nil {
+			continue
+		}
+		for _, e := range resolved[:i] {
+			if e == nil || e.Spec.Name != d.Spec.Name {
+				continue
+			}
+			if _, err := e.When.Constrain(d.When); err == nil {
+				problems = append(problems, Problem{
+					Pos:     positions[i],
+					Msg:     fmt.Sprintf("%s overlaps %s", d, e),
+					Fixable: reflect.DeepEqual(d, e),
+				})
+				break
+			}
+		}
+	}
+	return problems
+}
+
+func (duplicateDependency) Fix(r *recipe.Recipe) {
+	resolved := resolveDependencies(r.Dependencies)
+	var dependencies []recipe.DependsOn
+	for i, d := range r.Dependencies {
+		if resolved[i] == nil || !slices.ContainsFunc(resolved[:i], func(e *recipe.DependsOn) bool { return reflect.DeepEqual(e, resolved[i]) }) {
+			dependencies = append(dependencies, d)
+		}
+	}
+	r.Dependencies = dependencies
+}
+
+// resolveDependencies resolves each dependency, leaving nil for those whose
+// blocks contradict them, as they never apply.
+func resolveDependencies(dependencies []recipe.DependsOn) []*recipe.DependsOn {
+	resolved := make([]*recipe.DependsOn, len(dependencies))
+	for i, d := range dependencies {
+		if r, err := d.Resolve(); err == nil {
+			resolved[i] = &r
+		}
+	}
+	return resolved
+}
+
+// rFirst checks that the dependencies on R come before any others.
+type rFirst struct{}
+
+func (rFirst) Name() string {
+	return "r-first"
+}
+
+func (rFirst) Check(r recipe.Recipe) []Problem {
+	var problems []Problem
+	positions := r.Positions().Dependencies
+	var other bool
+	for i, d := range r.Dependencies {
+		if d.Spec.Name != "r" {
+			other = true
+		} else if other {
+			problems = append(problems, Problem{
+				Pos:     positions[i],
+				Msg:     fmt.Sprintf("%s should come before the other dependencies", d),
+				Fixable: true,
+			})
+		}
+	}
+	return problems
+}
+
+func (rFirst) Fix(r *recipe.Recipe) {
+	slices.SortStableFunc(r.Dependencies, func(a, b recipe.DependsOn) int {
+		switch {
+		case a.Spec.Name == "r" && b.Spec.Name != "r":
+			return -1
+		case a.Spec.Name != "r" && b.Spec.Name == "r":
+			return 1
+		}
+		return 0
+	})
+}
+
+// className checks that the class is named after the cran attribute, as New
+// names it.
+type className struct{}
+
+func (className) Name() string {
+	return "class-name"
+}
+
+func (className) Check(r recipe.Recipe) []Problem {
+	repo, name := r.Repo()
+	if repo != "cran" || r.Class.Name == "" {
+		return nil
+	}
+	if expected := recipe.ClassName(name); r.Class.Name != expected {
+		return []Problem{{
+			Pos: r.Positions().Class,
+			Msg: fmt.Sprintf("class %s should be named %s after cran = %q", r.Class.Name, expected, name),
+		}}
+	}
+	return nil
+}
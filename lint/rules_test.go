@@ -0,0 +1,133 @@
+package lint
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+const (
+	md5a = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	md5b = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+// at returns a position without its offset, which the expectations leave out.
+func at(line, column int) tokeniser.Position {
+	return tokeniser.Position{Line: line, Column: column}
+}
+
+func TestRules(t *testing.T) {
+	for n, test := range [...]struct {
+		rule     Rule
+		input    string
+		expected []Problem
+	}{
+		{
+			parseWarning{},
+			"\tversion(\"2.0\", commit=\"abc1234\")\n\tversion(\"1.0\", md5=\"" + md5a + "\")\n",
+			[]Problem{{Pos: at(2, 24), Msg: "abbreviated commit hash"}},
+		},
+		{
+			parseWarning{},
+			"\tversion(\"1.0\", md5=\"" + md5a + "\")\n",
+			nil,
+		},
+		{
+			versionOrder{},
+			"\tversion(\"2.0\", md5=\"" + md5a + "\")\n\tversion(\"1.10\", md5=\"" + md5a + "\")\n\tversion(\"1.9\", md5=\"" + md5a + "\")\n\tversion(\"develop\", branch=\"main\")\n",
+			[]Problem{{Pos: at(5, 2), Msg: "version develop should come before 1.9", Fixable: true}},
+		},
+		{
+			versionOrder{},
+			"\tversion(\"2.0\", md5=\"" + md5a + "\")\n\tversion(\"1.0\", md5=\"" + md5a + "\")\n\tversion(\"2.0\", md5=\"" + md5a + "\")\n\tversion(\"1.0\", md5=\"" + md5b + "\")\n",
+			[]Problem{
+				{Pos: at(4, 2), Msg: "version 2.0 is declared more than once", Fixable: true},
+				{Pos: at(5, 2), Msg: "version 1.0 is declared more than once"},
+			},
+		},
+		{
+			duplicateDependency{},
+			"\tdepends_on(\"r-a\", when=\"@:1\")\n\tdepends_on(\"r-a@2:\", when=\"@2:\")\n\tdepends_on(\"r-b\", when=\"+x\")\n\tdepends_on(\"r-b\", when=\"~x\")\n",
+			nil,
+		},
+		{
+			duplicateDependency{},
+			"\tdepends_on(\"r-a\", type=(\"build\", \"run\"))\n\twith when(\"@2:\"):\n\t\tdepends_on(\"r-a@1:\", type=(\"build\", \"run\"))\n\twith default_args(type=\"run\"):\n\t\tdepends_on(\"r-b\")\n\tdepends_on(\"r-b\", type=\"run\")\n",
+			[]Problem{
+				{Pos: at(4, 3), Msg: `depends_on("r-a@1:", type=("build", "run"), when="@2:") overlaps depends_on("r-a", type=("build", "run"))`},
+				{Pos: at(7, 2), Msg: `depends_on("r-b", type="run") overlaps depends_on("r-b", type="run")`, Fixable: true},
+			},
+		},
+		{
+			duplicateDependency{},
+			"\twith when(\"@2:\"):\n\t\tdepends_on(\"r-a\", when=\"@:1\")\n\tdepends_on(\"r-a\")\n",
+			nil,
+		},
+		{
+			rFirst{},
+			"\tdepends_on(\"r@3.5:\", when=\"@2:\")\n\tdepends_on(\"r@3:\", when=\"@:1\")\n\tdepends_on(\"r-a\")\n",
+			nil,
+		},
+		{
+			rFirst{},
+			"\tdepends_on(\"r-a\")\n\tdepends_on(\"r@3:\")\n\tdepends_on(\"rb\")\n",
+			[]Problem{{Pos: at(3, 2), Msg: `depends_on("r@3:") should come before the other dependencies`, Fixable: true}},
+		},
+		{
+			className{},
+			"\tcran = \"data.table\"\n",
+			[]Problem{{Pos: at(1, 1), Msg: `class RA should be named RDataTable after cran = "data.table"`}},
+		},
+		{
+			className{},
+			"\tcran = \"a\"\n",
+			nil,
+		},
+		{
+			className{},
+			"\tbioc = \"aB\"\n",
+			nil,
+		},
+	} {
+		problems := test.rule.Check(parse(t, "class RA(RPackage):\n"+test.input))
+		for i := range problems {
+			problems[i].Pos.Offset = 0
+		}
+		if !reflect.DeepEqual(problems, test.expected) {
+			t.Errorf("Test %d: expected problems %+v, got %+v", n+1, test.expected, problems)
+		}
+	}
+}
+
+func TestFixes(t *testing.T) {
+	for n, test := range [...]struct {
+		rule            Fixer
+		input, expected string
+	}{
+		{
+			versionOrder{},
+			"\tversion(\"1.0\", md5=\"" + md5a + "\")\n\tversion(\"2.0\", md5=\"" + md5a + "\")\n\tversion(\"1.0\", md5=\"" + md5a + "\")\n\tversion(\"1.0\", md5=\"" + md5b + "\")\n",
+			"\n\tversion(\"2.0\", md5=\"" + md5a + "\")\n\tversion(\"1.0\", md5=\"" + md5a + "\")\n\tversion(\"1.0\", md5=\"" + md5b + "\")\n",
+		},
+		{
+			duplicateDependency{},
+			"\tdepends_on(\"r-a\", type=\"run\")\n\twith default_args(type=\"run\"):\n\t\tdepends_on(\"r-a\")\n\t\tdepends_on(\"r-b\")\n\tdepends_on(\"r-b\", when=\"@2:\")\n",
+			"\n\tdepends_on(\"r-a\", type=\"run\")\n\twith default_args(type=\"run\"):\n\t\tdepends_on(\"r-b\")\n\tdepends_on(\"r-b\", when=\"@2:\")\n",
+		},
+		{
+			rFirst{},
+			"\tdepends_on(\"r-a\")\n\twith when(\"@2:\"):\n\t\tdepends_on(\"r-b\")\n\t\tdepends_on(\"r@4:\")\n\tdepends_on(\"r@3:\", when=\"@:1\")\n",
+			"\n\tdepends_on(\"r@3:\", when=\"@:1\")\n\twith when(\"@2:\"):\n\t\tdepends_on(\"r@4:\")\n\t\tdepends_on(\"r-b\")\n\tdepends_on(\"r-a\")\n",
+		},
+	} {
+		r := parse(t, "class RA(RPackage):\n"+test.input)
+		test.rule.Fix(&r)
+		if got, expected := r.String(), "class RA(RPackage):"+test.expected; got != expected {
+			t.Errorf("Test %d: expected %q, got %q", n+1, expected, got)
+		}
+		if problems := Lint(r, []Rule{test.rule}); problems != nil && problems[0].Fixable {
+			t.Errorf("Test %d: expected no fixable problems, got %+v", n+1, problems)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/cmd"
+)
+
+func main() {
+	os.Exit(cmd.Execute(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -0,0 +1,184 @@
+package parser
+
+import (
+	"github.com/wtsi-hgi/uber-recipe-creator/phraser"
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+// Block is a with statement whose context managers are all Spack's when(...)
+// or default_args(...), and which apply to the directives in its body.
+type Block struct {
+	Parent   *Block
+	Contexts []Context
+	Node     *Compound
+}
+
+// Context is a when(...) or default_args(...) context manager. When holds the
+// spec of a when(...), or the when= argument of a default_args(...), whose
+// type= argument is in Type and other arguments in Extra.
+type Context struct {
+	Name  tokeniser.Token
+	When  *tokeniser.Token
+	Type  []tokeniser.Token
+	Extra []Argument
+}
+
+// parseWith parses the context managers of a with statement. It returns nil,
+// without an error, if any of them aren't when(...) or default_args(...), or
+// if the statement's body is on the same line.
+func parseWith(phrase phraser.Phrase) ([]Context, error) {
+	tokens := phrase.Tokens
+	i := skipSpace(tokens, 0)
+	for i < len(tokens) && tokens[i].Type == tokeniser.TokenNewline {
+		i = skipSpace(tokens, i+1)
+	}
+	var contexts []Context
+	for {
+		i = skipSpace(tokens, i+1)
+		if i == len(tokens) || (tokens[i].Val != "when" && tokens[i].Val != "default_args") || tokens[i].Type != tokeniser.TokenIdentifier {
+			return nil, nil
+		}
+		name := tokens[i]
+		args, end, err := callArgumentsAt(tokens, i)
+		if err != nil {
+			return nil, err
+		}
+		context, err := parseContext(name, args)
+		if err != nil {
+			return nil, err
+		}
+		contexts = append(contexts, context)
+		i = skipSpace(tokens, end)
+		if i < len(tokens) && tokens[i].Is(tokeniser.TokenDelimiter, ",") {
+			continue
+		}
+		if i == len(tokens) || !tokens[i].Is(tokeniser.TokenDelimiter, ":") || skipSpace(tokens, i+1) != len(tokens) {
+			return nil, nil
+		}
+		return contexts, nil
+	}
+}
+
+func parseContext(name tokeniser.Token, args []Argument) (Context, error) {
+	context := Context{Name: name}
+	if name.Val == "when" {
+		if len(args) != 1 {
+			return context, errorAt(name, "expected one argument")
+		}
+		when, err := stringArgument(args[0])
+		if err != nil {
+			return context, err
+		}
+		context.When = &when
+		return context, nil
+	}
+	for _, arg := range args {
+		if arg.Keyword == nil {
+			return context, errorAt(arg.Value[0], "expected keyword argument")
+		}
+		switch arg.Keyword.Val {
+		case "when":
+			when, err := stringArgument(arg)
+			if err != nil {
+				return context, err
+			}
+			context.When = &when
+		case "type":
+			types, err := typeArgument(arg)
+			if err != nil {
+				return context, err
+			}
+			context.Type = types
+		default:
+			context.Extra = append(context.Extra, arg)
+		}
+	}
+	return context, nil
+}
+
+// stringArgument returns the string literal that is an argument's value.
+func stringArgument(arg Argument) (tokeniser.Token, error) {
+	value, err := parseExpr(arg.Value)
+	if err != nil {
+		return tokeniser.Token{}, err
+	}
+	return stringValue(value)
+}
+
+// stringValue returns the string literal that is an expression, checking that
+// it has a constant value.
+func stringValue(e Expr) (tokeniser.Token, error) {
+	s, ok := unparen(e).(*String)
+	if !ok || len(s.Tokens) != 1 {
+		return tokeniser.Token{}, exprError(e, "expected string")
+	}
+	return s.Tokens[0], checkString(s.Tokens[0])
+}
+
+// stringsArgument returns the string literals of an argument whose value is a
+// string or a list or tuple of them.
+func stringsArgument(arg Argument) ([]tokeniser.Token, error) {
+	value, err := parseExpr(arg.Value)
+	if err != nil {
+		return nil, err
+	}
+	elements := []Expr{value}
+	switch v := unparen(value).(type) {
+	case *Tuple:
+		elements = v.Elements
+	case *List:
+		elements = v.Elements
+	}
+	var tokens []tokeniser.Token
+	for _, e := range elements {
+		token, err := stringValue(e)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// blockEnd returns the index of the first phrase after the body of the
+// compound statement phrases[i], which is made up of the phrases indented
+// further than it, along with any comments among them. Comments after the
+// body that are indented no further than the statement belong to what
+// follows it.
+func blockEnd(phrases []phraser.Phrase, i int) int {
+	start, column := i, phrases[i].Pos().Column
+	for i++; i < len(phrases); i++ {
+		if phrases[i].Type != phraser.PhraseTop && phrases[i].Pos().Column <= column {
+			break
+		}
+	}
+	for i > start+1 && phrases[i-1].Type == phraser.PhraseTop && phrases[i-1].Pos().Column <= column {
+		i--
+	}
+	return i
+}
+
+// modelled reports whether the body of a with statement only holds
+// directives that the parser models, comments and nested with statements of
+// its own, so that it can be taken apart.
+func modelled(body []Node) bool {
+	for _, node := range body {
+		switch phraseOf(node).Type {
+		case phraser.PhraseTop, phraser.PhraseVersion, phraser.PhraseVariant, phraser.PhraseDependsOn:
+			if _, ok := node.(*Compound); ok {
+				return false
+			}
+		case phraser.PhraseWith:
+			compound, ok := node.(*Compound)
+			if !ok {
+				return false
+			}
+			if contexts, err := parseWith(compound.Phrase); err == nil && (contexts == nil || !modelled(compound.Body)) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return len(body) > 0
+}
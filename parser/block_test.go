@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestBlocks(t *testing.T) {
+	input := "class A(Package):\n" +
+		"\twith when(\"@2:\"), default_args(type=(\"build\", \"run\"), sticky=True):\n" +
+		"\t\tdepends_on(\"b\")\n" +
+		"\t\t# a comment\n" +
+		"\t\twith default_args(when=\"+x11\"):\n" +
+		"\t\t\tdepends_on(\"c\")\n" +
+		"\tdepends_on(\"d\")\n"
+	recipe, err := DoParse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipe.Depends) != 3 {
+		t.Fatalf("expected 3 dependencies, got %d", len(recipe.Depends))
+	}
+	outer, inner := recipe.Depends[0].Block, recipe.Depends[1].Block
+	if outer == nil || outer.Parent != nil || len(outer.Contexts) != 2 {
+		t.Fatalf("unexpected outer block: %+v", outer)
+	}
+	when, defaults := outer.Contexts[0], outer.Contexts[1]
+	if when.Name.Val != "when" || when.When == nil || when.When.Val != "\"@2:\"" {
+		t.Errorf("unexpected when context: %+v", when)
+	}
+	if defaults.Name.Val != "default_args" || joinVals(defaults.Type) != "\"build\"\"run\"" ||
+		len(defaults.Extra) != 1 || defaults.Extra[0].Keyword.Val != "sticky" {
+		t.Errorf("unexpected default_args context: %+v", defaults)
+	}
+	if inner == nil || inner.Parent != outer || inner.Contexts[0].When.Val != "\"+x11\"" {
+		t.Errorf("unexpected inner block: %+v", inner)
+	}
+	if recipe.Depends[2].Block != nil {
+		t.Errorf("expected the last dependency outside any block")
+	}
+	if recipe.Indent != "\t" {
+		t.Errorf("expected indent %q, got %q", "\t", recipe.Indent)
+	}
+}
+
+func TestOpaqueBlocks(t *testing.T) {
+	for n, body := range [...]string{
+		"\twith when(\"@2:\"):\n\t\tdepends_on(\"b\")\n\t\tpatch(\"fix.patch\")\n",
+		"\twith when(\"@2:\"): depends_on(\"b\")\n",
+		"\twith when(\"@2:\"):\n\t\twith open(\"x\") as f:\n\t\t\tdepends_on(\"b\")\n",
+		"\tdef install(self, spec, prefix):\n\t\twith working_dir(\"src\"):\n\t\t\tmake()\n",
+	} {
+		recipe, err := DoParse("class A(Package):\n" + body)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+			continue
+		}
+		if len(recipe.Depends) != 0 {
+			t.Errorf("Test %d: expected the block to be kept as text, got %+v", n+1, recipe.Depends)
+		}
+		if got, expected := recipe.Header, "class A(Package):\n"+body[:len(body)-1]; got != expected {
+			t.Errorf("Test %d: expected header %q, got %q", n+1, expected, got)
+		}
+	}
+}
+
+func TestBlockErrors(t *testing.T) {
+	for n, test := range [...]struct {
+		input    string
+		expected string
+	}{
+		{"\twith when(spec):\n\t\tdepends_on(\"b\")\n", "2:12: failed to parse with statement: expected string"},
+		{"\twith when(\"@2:\", \"+x\"):\n\t\tdepends_on(\"b\")\n", "2:7: failed to parse with statement: expected one argument"},
+		{"\twith default_args(\"build\"):\n\t\tdepends_on(\"b\")\n", "2:20: failed to parse with statement: expected keyword argument"},
+		{"\twith default_args(type=1):\n\t\tdepends_on(\"b\")\n", "2:25: failed to parse with statement: expected string"},
+		{"\twith when(\"@2:\"):\n\t\tdepends_on(b)\n", "3:14: failed to parse depends_on: expected string"},
+	} {
+		_, err := DoParse("class A(Package):\n" + test.input)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Test %d: expected error %q, got %v", n+1, test.expected, err)
+		}
+	}
+}
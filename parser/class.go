@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+// Class is the class statement of a recipe. Bases holds the base classes,
+// such as RPackage and any mixins, as names or attributes. Docstring holds
+// the string literals of the docstring, if the body starts with one.
+// Attributes holds the assignments in the body, such as homepage = "...".
+type Class struct {
+	Name       tokeniser.Token
+	Bases      []Expr
+	Docstring  []tokeniser.Token
+	Attributes []KeywordArgument
+	Node       *Compound
+}
+
+// parseClass parses the line of a class statement and finds its docstring.
+func parseClass(node *Compound) (Class, error) {
+	var c Class
+	p := exprParser{tokens: significant(node.Phrase.Tokens), pos: 1}
+	if name := p.peek(); name.Type == tokeniser.TokenIdentifier {
+		c.Name = name
+		p.pos++
+	} else {
+		return c, errorAt(name, "expected class name")
+	}
+	if p.accept("(") {
+		args, err := p.arguments()
+		if err != nil {
+			return c, err
+		}
+		for _, arg := range args {
+			if arg.Keyword != nil {
+				return c, errorAt(*arg.Keyword, "unexpected keyword argument")
+			} else if !dottedName(arg.Value) {
+				return c, exprError(arg.Value, "expected base class")
+			}
+			c.Bases = append(c.Bases, arg.Value)
+		}
+	}
+	if err := p.expect(":"); err != nil {
+		return c, err
+	}
+	c.Docstring = docstring(node.Body)
+	c.Attributes = attributes(node.Body)
+	c.Node = node
+	return c, nil
+}
+
+// dottedName reports whether an expression is a name, possibly with
+// attributes, such as spack.pkg.builtin.r_x.RX.
+func dottedName(e Expr) bool {
+	for {
+		switch x := e.(type) {
+		case *Name:
+			return true
+		case *Attribute:
+			e = x.X
+		default:
+			return false
+		}
+	}
+}
+
+// docstring returns the string literals of the first statement of a body if
+// that is all it is, as Python does, ignoring f-strings.
+func docstring(body []Node) []tokeniser.Token {
+	for _, node := range body {
+		if _, ok := node.(*Comment); ok {
+			continue
+		}
+		statement, ok := node.(*Statement)
+		if !ok {
+			return nil
+		}
+		e, err := parseExpr(statement.Phrase.Tokens)
+		if err != nil {
+			return nil
+		}
+		s, ok := e.(*String)
+		if !ok {
+			return nil
+		}
+		for _, token := range s.Tokens {
+			if _, err := tokeniser.Unquote(token.Val); hasNoValue(err) {
+				return nil
+			}
+		}
+		return s.Tokens
+	}
+	return nil
+}
+
+// attributes returns the assignments to a single name in a class body, as
+// keyword arguments, skipping any other statements and those whose values
+// don't parse.
+func attributes(body []Node) []KeywordArgument {
+	var attrs []KeywordArgument
+	for _, node := range body {
+		statement, ok := node.(*Statement)
+		if !ok {
+			continue
+		}
+		tokens := significant(statement.Phrase.Tokens)
+		if len(tokens) < 3 || tokens[0].Type != tokeniser.TokenIdentifier || !tokens[1].Is(tokeniser.TokenDelimiter, "=") {
+			continue
+		}
+		if value, err := parseExpr(tokens[2:]); err == nil {
+			attrs = append(attrs, KeywordArgument{Keyword: tokens[0], Value: value})
+		}
+	}
+	return attrs
+}
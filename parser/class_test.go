@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+)
+
+func TestClass(t *testing.T) {
+	for n, test := range [...]struct {
+		input     string
+		name      string
+		bases     []string
+		docstring string
+	}{
+		{testdata.TestRecipe1, "Nextdenovo", []string{"MakefilePackage"}, `"""NextDenovo is a string graph-based de novo assembler for long reads.` + "\n\tidk\n"},
+		{testdata.TestCran1, "RAbcrf", []string{"RPackage"}, `"""Approximate Bayesian Computation via Random Forests` + "\n\n"},
+		{"class A(RPackage, CudaPackage, spack.pkg.builtin.b.B):\n\t# comment\n\t'doc' \"string\"\n\tversion('1')\n", "A", []string{"RPackage", "CudaPackage", "spack.pkg.builtin.b.B"}, `'doc' "string"`},
+		{"class A:\n\tversion('1')\n\t'not a docstring'\n", "A", nil, ""},
+		{"class A(Package):\n\tf'{x}'\n", "A", []string{"Package"}, ""},
+		{"class A(Package):\n\t\"\"\"doc\"\"\".strip()\n", "A", []string{"Package"}, ""},
+	} {
+		recipe, err := DoParse(test.input)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+			continue
+		} else if recipe.Class == nil {
+			t.Errorf("Test %d: expected a class", n+1)
+			continue
+		}
+		var bases []string
+		for _, base := range recipe.Class.Bases {
+			bases = append(bases, Format(base))
+		}
+		if recipe.Class.Name.Val != test.name || !reflect.DeepEqual(bases, test.bases) {
+			t.Errorf("Test %d: expected class %s(%q), got %s(%q)", n+1, test.name, test.bases, recipe.Class.Name.Val, bases)
+		}
+		docstring := strings.Join(vals(recipe.Class.Docstring), " ")
+		if !strings.HasPrefix(docstring, test.docstring) || (docstring == "") != (test.docstring == "") {
+			t.Errorf("Test %d: expected docstring %q, got %q", n+1, test.docstring, docstring)
+		}
+	}
+}
+
+func TestClassAttributes(t *testing.T) {
+	recipe, err := DoParse("class A(Package):\n" +
+		"\t\"\"\"Doc.\"\"\"\n" +
+		"\thomepage = 'https://example.com'\n" +
+		"\turls = [\n\t\t'https://a',\n\t]\n" +
+		"\tversion('1.0')\n" +
+		"\ta, b = 1, 2\n" +
+		"\tx += 1\n" +
+		"\tmaintainers('me')\n" +
+		"\tlicense = 'MIT'  # comment\n\n" +
+		"\tdef install(self):\n" +
+		"\t\ty = 1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, attr := range recipe.Class.Attributes {
+		got = append(got, attr.Keyword.Val+"="+Format(attr.Value))
+	}
+	expected := []string{"homepage='https://example.com'", "urls=['https://a']", "license='MIT'"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected attributes %q, got %q", expected, got)
+	}
+}
+
+func TestClassErrors(t *testing.T) {
+	for n, test := range [...]struct {
+		input, expected string
+	}{
+		{"class (Package):\n\tpass\n", "1:7: failed to parse class: expected class name"},
+		{"class A(metaclass=M):\n\tpass\n", "1:9: failed to parse class: unexpected keyword argument"},
+		{"class A(f(x)):\n\tpass\n", "1:9: failed to parse class: expected base class"},
+		{"class A(B) C:\n\tpass\n", "1:12: failed to parse class: expected ':'"},
+	} {
+		_, err := DoParse(test.input)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Test %d: expected error %q, got %v", n+1, test.expected, err)
+		}
+	}
+}
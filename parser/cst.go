@@ -0,0 +1,306 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/phraser"
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+// Node is a node in the concrete syntax tree of a recipe: a File, one of its
+// statements, or an expression in a directive.
+type Node interface {
+	Pos() tokeniser.Position
+}
+
+// File is the concrete syntax tree of a whole recipe. Every token of the
+// input is kept in its statements, with the newlines after the last one in
+// Trailer, so that printing the tree gives back the input.
+type File struct {
+	Body    []Node
+	Trailer string
+}
+
+// Comment is a run of comment lines, along with the newlines and indentation
+// that follow them.
+type Comment struct {
+	Phrase phraser.Phrase
+}
+
+// Statement is a simple statement that isn't a directive, such as an import,
+// an assignment or a docstring, along with the newlines and indentation
+// before it.
+type Statement struct {
+	Phrase phraser.Phrase
+}
+
+// Directive is a statement that calls one of Spack's directives, such as
+// version(...) or depends_on(...).
+type Directive struct {
+	Phrase phraser.Phrase
+	Call   *Call
+}
+
+// Compound is a statement with an indented body, such as a class, a def or a
+// with statement. Phrase is the line that ends with a colon.
+type Compound struct {
+	Phrase phraser.Phrase
+	Body   []Node
+}
+
+func (f *File) Pos() tokeniser.Position {
+	if len(f.Body) == 0 {
+		return tokeniser.Position{Line: 1, Column: 1}
+	}
+	return f.Body[0].Pos()
+}
+
+func (c *Comment) Pos() tokeniser.Position   { return c.Phrase.Pos() }
+func (s *Statement) Pos() tokeniser.Position { return s.Phrase.Pos() }
+func (d *Directive) Pos() tokeniser.Position { return d.Phrase.Pos() }
+func (c *Compound) Pos() tokeniser.Position  { return c.Phrase.Pos() }
+
+// String returns the text of the recipe.
+func (f *File) String() string {
+	return Source(f)
+}
+
+// ParseFile parses a recipe into its concrete syntax tree. As with DoParse,
+// syntax errors that the tokeniser can recover from are tolerated, and the
+// statements containing them are kept as text.
+func ParseFile(input string) (*File, error) {
+	file, _, err := parseFile(input)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// parseFile builds the concrete syntax tree from the phrases of the input,
+// also returning the tokeniser's diagnostics and any error that stopped the
+// phraser, in which case the tree only holds the phrases before it. A bracket
+// left open is closed at the next directive at its line's indentation, so
+// that the directives after it are still parsed.
+func parseFile(input string) (*File, []*tokeniser.Error, error) {
+	var cuts []int
+	for {
+		t := tokeniser.New(input, tokeniser.Tolerant)
+		t.CloseBracketsAt(cuts...)
+		p := phraser.New(t)
+
+		var phrases []phraser.Phrase
+		var phraseErr error
+		end := 0
+		for phrase, err := range p.All() {
+			if err != nil {
+				phraseErr = diagnosticBefore(t.Diagnostics(), err)
+				break
+			}
+			if len(phrase.Tokens) > 0 {
+				end = phrase.Tokens[len(phrase.Tokens)-1].End().Offset
+			}
+			phrases = append(phrases, phrase)
+		}
+		if pos, ok := t.Unclosed(); ok {
+			if cut := resyncPoint(input, pos); cut >= 0 && (len(cuts) == 0 || cut > cuts[len(cuts)-1]) {
+				cuts = append(cuts, cut)
+				continue
+			}
+		}
+		return &File{Body: buildNodes(phrases), Trailer: input[end:]}, t.Diagnostics(), phraseErr
+	}
+}
+
+// resyncPoint returns the offset of the line ending before the first line
+// after pos that starts, at the indentation of pos's line, with a call to one
+// of the directives the phraser knows, or -1 if there isn't one.
+func resyncPoint(input string, pos tokeniser.Position) int {
+	line := input[pos.Offset-pos.Column+1:]
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	for i := pos.Offset; ; {
+		n := strings.IndexAny(input[i:], "\r\n")
+		if n < 0 {
+			return -1
+		}
+		cut := i + n
+		if i = cut + 1; strings.HasPrefix(input[cut:], "\r\n") {
+			i++
+		}
+		rest, ok := strings.CutPrefix(input[i:], indent)
+		if !ok {
+			continue
+		}
+		name := rest[:len(rest)-len(strings.TrimLeft(rest, "abcdefghijklmnopqrstuvwxyz_"))]
+		if phraser.IsDirective(name) && strings.HasPrefix(strings.TrimLeft(rest[len(name):], " \t"), "(") {
+			return cut
+		}
+	}
+}
+
+// buildNodes groups phrases into statements, giving each compound statement
+// the phrases of its body.
+func buildNodes(phrases []phraser.Phrase) []Node {
+	var nodes []Node
+	for i := 0; i < len(phrases); i++ {
+		phrase := phrases[i]
+		switch {
+		case phrase.Type == phraser.PhraseTop:
+			nodes = append(nodes, &Comment{Phrase: phrase})
+		case opensBlock(phrase):
+			end := blockEnd(phrases, i)
+			nodes = append(nodes, &Compound{Phrase: phrase, Body: buildNodes(phrases[i+1 : end])})
+			i = end - 1
+		default:
+			if call := directiveCall(phrase); call != nil {
+				nodes = append(nodes, &Directive{Phrase: phrase, Call: call})
+			} else {
+				nodes = append(nodes, &Statement{Phrase: phrase})
+			}
+		}
+	}
+	return nodes
+}
+
+// opensBlock reports whether the phrase ends with a colon, and so has its
+// body on the lines that follow.
+func opensBlock(phrase phraser.Phrase) bool {
+	sig := significant(phrase.Tokens)
+	return len(sig) > 1 && sig[len(sig)-1].Is(tokeniser.TokenDelimiter, ":")
+}
+
+// directiveCall returns the call that makes up a directive's phrase, or nil
+// if the phrase isn't a directive or is something other than a call, such as
+// an assignment to url.
+func directiveCall(phrase phraser.Phrase) *Call {
+	if phrase.Type < phraser.PhraseHomepage || phrase.Type > phraser.PhraseRequires {
+		return nil
+	}
+	e, err := parseExpr(phrase.Tokens)
+	if err != nil {
+		return nil
+	}
+	call, ok := e.(*Call)
+	if !ok {
+		return nil
+	}
+	if _, ok := call.Func.(*Name); !ok {
+		return nil
+	}
+	return call
+}
+
+// phraseOf returns the phrase of a statement.
+func phraseOf(node Node) phraser.Phrase {
+	switch node := node.(type) {
+	case *Comment:
+		return node.Phrase
+	case *Statement:
+		return node.Phrase
+	case *Directive:
+		return node.Phrase
+	case *Compound:
+		return node.Phrase
+	}
+	return phraser.Phrase{}
+}
+
+// Source returns the text of a file or statement, including that of any
+// changes made to the tokens of its phrases, or the Python source of an
+// expression as given by Format.
+func Source(node Node) string {
+	var sb strings.Builder
+	writeSource(&sb, node)
+	return sb.String()
+}
+
+func writeSource(sb *strings.Builder, node Node) {
+	switch node := node.(type) {
+	case *File:
+		for _, n := range node.Body {
+			writeSource(sb, n)
+		}
+		sb.WriteString(node.Trailer)
+	case *Compound:
+		joinTokens(node.Phrase.Tokens, sb)
+		for _, n := range node.Body {
+			writeSource(sb, n)
+		}
+	case *Comment, *Statement, *Directive:
+		joinTokens(phraseOf(node).Tokens, sb)
+	default:
+		format(sb, node)
+	}
+}
+
+// A Visitor's Visit method is called for each node found by Walk. If it
+// returns a Visitor, Walk visits each of the node's children with it, and
+// then calls its Visit method with nil.
+type Visitor interface {
+	Visit(node Node) Visitor
+}
+
+// Walk traverses a syntax tree in depth-first order, from the statements of
+// a file down to the expressions in its directives.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	var children []Node
+	switch n := node.(type) {
+	case *File:
+		children = n.Body
+	case *Compound:
+		children = n.Body
+	case *Directive:
+		children = []Node{n.Call}
+	case *Attribute:
+		children = []Node{n.X}
+	case *Call:
+		children = []Node{n.Func}
+		for _, arg := range n.Args {
+			children = append(children, arg.Value)
+		}
+	case *Tuple:
+		children = exprNodes(n.Elements)
+	case *List:
+		children = exprNodes(n.Elements)
+	case *Dict:
+		for i := range n.Keys {
+			children = append(children, n.Keys[i], n.Values[i])
+		}
+	case *Paren:
+		children = []Node{n.X}
+	case *Unary:
+		children = []Node{n.X}
+	case *Binary:
+		children = []Node{n.X, n.Y}
+	}
+	for _, child := range children {
+		Walk(v, child)
+	}
+	v.Visit(nil)
+}
+
+func exprNodes(exprs []Expr) []Node {
+	nodes := make([]Node, len(exprs))
+	for i, e := range exprs {
+		nodes[i] = e
+	}
+	return nodes
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a syntax tree in depth-first order, calling f for each
+// node, and then with nil once its children are done. The children are
+// skipped if f returns false.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
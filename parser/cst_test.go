@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+func TestParseFileRoundTrip(t *testing.T) {
+	for n, input := range [...]string{
+		testdata.TestRecipe1,
+		testdata.TestCran1,
+		testdata.TestBioc1,
+		"",
+		"\n\n",
+		"# comment\nclass A(Package):\n    pass",
+		"class A(Package):\r\n\tversion('1.0')\r\n\r\n",
+		"class A(Package):\n\t\"\"\"Doc\n\tstring.\"\"\"\n\n\t# a comment\n\n\tversion('1.0')  # trailing\n\n\n",
+		"class A(Package):\n\tdef install(self):\n\t\tx = $y\n\t\tz = 'w\n\n  \tversion('1')\n",
+		"class A(\n\tPackage,\n):\n\twith when('@2:'):\n\t\tdepends_on('b',\n\t\t\ttype='run')\n\tif True: pass\n",
+	} {
+		file, err := ParseFile(input)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+			continue
+		}
+		if got := file.String(); got != input {
+			t.Errorf("Test %d: expected %q, got %q", n+1, input, got)
+		}
+	}
+}
+
+// describeNodes returns a line for each statement in the tree, indented by its
+// depth, with its type and first token.
+func describeNodes(file *File) []string {
+	var lines []string
+	depth := -1
+	Inspect(file, func(node Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+		depth++
+		switch node.(type) {
+		case *File:
+			return true
+		case *Comment, *Statement, *Directive, *Compound:
+			var first string
+			for _, token := range phraseOf(node).Tokens {
+				if token.Pos == node.Pos() {
+					first = token.Val
+				}
+			}
+			lines = append(lines, fmt.Sprintf("%s%T %s", strings.Repeat(" ", depth-1), node, first))
+			_, compound := node.(*Compound)
+			if !compound {
+				depth--
+			}
+			return compound
+		}
+		return false
+	})
+	return lines
+}
+
+func TestParseFileStructure(t *testing.T) {
+	file, err := ParseFile("from spack.package import *\n\n" +
+		"class A(Package):\n" +
+		"\t\"\"\"Docstring.\"\"\"\n\n" +
+		"\thomepage = 'https://example.com'\n" +
+		"\tversion('1.0', sha256='abc0000000000000000000000000000000000000000000000000000000000000')\n" +
+		"\t# dependencies\n" +
+		"\twith when('@1:'):\n" +
+		"\t\tdepends_on('b')\n\n" +
+		"\tdef install(self, spec, prefix):\n" +
+		"\t\tversion('2.0')\n" +
+		"\t\tif spec.satisfies('+x'):\n" +
+		"\t\t\tmake()\n" +
+		"\t# before variant\n" +
+		"\tvariant('x', default=True)\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"*parser.Statement from",
+		"*parser.Compound class",
+		" *parser.Statement \"\"\"Docstring.\"\"\"",
+		" *parser.Statement homepage",
+		" *parser.Directive version",
+		" *parser.Comment # dependencies",
+		" *parser.Compound with",
+		"  *parser.Directive depends_on",
+		" *parser.Compound def",
+		"  *parser.Directive version",
+		"  *parser.Compound if",
+		"   *parser.Statement make",
+		" *parser.Comment # before variant",
+		" *parser.Directive variant",
+	}
+	if got := describeNodes(file); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestWalkExpressions(t *testing.T) {
+	file, err := ParseFile("class A(Package):\n\tdepends_on('b', type=('build', 'run'), patches=patch(url + '/a.patch'))\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var strs, names []string
+	Inspect(file, func(node Node) bool {
+		switch node := node.(type) {
+		case *String:
+			strs = append(strs, node.Tokens[0].Val)
+		case *Name:
+			names = append(names, node.Token.Val)
+		}
+		return true
+	})
+	if expected := []string{"'b'", "'build'", "'run'", "'/a.patch'"}; !reflect.DeepEqual(strs, expected) {
+		t.Errorf("expected strings %q, got %q", expected, strs)
+	}
+	if expected := []string{"depends_on", "patch", "url"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected names %q, got %q", expected, names)
+	}
+}
+
+func TestParseFileModified(t *testing.T) {
+	file, err := ParseFile("class A(Package):\n\tversion('1.0')\n\tversion('0.9')\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Inspect(file, func(node Node) bool {
+		if s, ok := node.(*String); ok && s.Tokens[0].Val == "'0.9'" {
+			directive := file.Body[0].(*Compound).Body[1].(*Directive)
+			for i, token := range directive.Phrase.Tokens {
+				if token.Pos == s.Pos() {
+					directive.Phrase.Tokens[i] = tokeniser.Token{Val: "'0.9.1'", Type: tokeniser.TokenString, Pos: token.Pos}
+				}
+			}
+		}
+		return true
+	})
+	if got, expected := file.String(), "class A(Package):\n\tversion('1.0')\n\tversion('0.9.1')\n"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestParseFileErrors(t *testing.T) {
+	if _, err := ParseFile("def f():\n\tpass\n"); err == nil || err.Error() != "1:1: unexpected Keyword \"def\"" {
+		t.Errorf("expected an error for a def before the class, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+// Severity is how serious a Diagnostic is. Errors are problems that stopped
+// a statement from being parsed, while warnings are ones that didn't.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "unknown"
+	}
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Diagnostic is a problem found while parsing a recipe.
+type Diagnostic struct {
+	Pos      tokeniser.Position
+	Severity Severity
+	Msg      string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Msg)
+}
+
+// Diagnostics is a list of problems, in the order they appear in the input.
+type Diagnostics []Diagnostic
+
+// Err returns the first error, as a *tokeniser.Error, or nil if there are only
+// warnings.
+func (ds Diagnostics) Err() error {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return &tokeniser.Error{Pos: d.Pos, Msg: d.Msg}
+		}
+	}
+	return nil
+}
+
+// add records a problem, taking its position from it if it's a
+// *tokeniser.Error.
+func (ds *Diagnostics) add(err error, severity Severity) {
+	d := Diagnostic{Severity: severity, Msg: err.Error()}
+	var e *tokeniser.Error
+	if errors.As(err, &e) {
+		d.Pos, d.Msg = e.Pos, e.Msg
+	}
+	*ds = append(*ds, d)
+}
+
+// sort puts the problems in the order they appear in the input.
+func (ds Diagnostics) sort() {
+	slices.SortStableFunc(ds, func(a, b Diagnostic) int {
+		return a.Pos.Offset - b.Pos.Offset
+	})
+}
@@ -0,0 +1,141 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	input := "class A(Package):\n" +
+		"\tversion(\"2.0\" md5=\"abc00000000000000000000000000000\")\n" +
+		"\tversion(\"1.0\", md5=\"abc00000000000000000000000000000\")\n" +
+		"\tdepends_on(r, type=\"run\")\n" +
+		"\twith when(spec):\n" +
+		"\t\tdepends_on(\"b\")\n" +
+		"\tdepends_on(\"c\", when=\"@1:\")\n\n" +
+		"\tdef install(self):\n" +
+		"\t\tx = $y\n"
+	recipe, diagnostics := Parse(input)
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.String())
+	}
+	expected := []string{
+		"2:16: error: failed to parse version: expected ','",
+		"4:13: error: failed to parse depends_on: expected string",
+		"5:12: error: failed to parse with statement: expected string",
+		"10:7: warning: invalid delimiter",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected diagnostics %q, got %q", expected, got)
+	}
+	if len(recipe.Versions) != 1 || recipe.Versions[0].Version.Val != `"1.0"` {
+		t.Errorf("expected version 1.0, got %+v", recipe.Versions)
+	}
+	if len(recipe.Depends) != 1 || recipe.Depends[0].Spec.Val != `"c"` {
+		t.Errorf("expected a dependency on c, got %+v", recipe.Depends)
+	}
+	expectedFooter := "\n\tversion(\"2.0\" md5=\"abc00000000000000000000000000000\")" +
+		"\n\tdepends_on(r, type=\"run\")" +
+		"\n\twith when(spec):\n\t\tdepends_on(\"b\")" +
+		"\n\n\tdef install(self):\n\t\tx = $y"
+	if recipe.Footer != expectedFooter {
+		t.Errorf("expected footer %q, got %q", expectedFooter, recipe.Footer)
+	}
+	if err := diagnostics.Err(); err == nil || err.Error() != "2:16: failed to parse version: expected ','" {
+		t.Errorf("expected the first error, got %v", err)
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	recipe, diagnostics := Parse("class A(Package):\n\tversion(\"1.0\")\n\n\tdef install(self):\n\t\tz = 'w\n")
+	if len(diagnostics) != 1 || diagnostics[0].Severity != SeverityWarning {
+		t.Fatalf("expected a warning, got %v", diagnostics)
+	}
+	if err := diagnostics.Err(); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+	if _, err := DoParse("class A(Package):\n\tversion(\"1.0\")\n\n\tdef install(self):\n\t\tz = 'w\n"); err != nil {
+		t.Errorf("expected DoParse to ignore warnings, got %s", err)
+	}
+	if len(recipe.Versions) != 1 {
+		t.Errorf("expected a version, got %+v", recipe.Versions)
+	}
+}
+
+func TestParseRecoversFromUnclosedBracket(t *testing.T) {
+	input := "class A(Package):\n" +
+		"    version(\"1.0\", md5=\"abc00000000000000000000000000000\"\n" +
+		"    version(\"2.0\")\n\n" +
+		"    variant(\"x\", default=True, multi=5)\n" +
+		"    depends_on(\"b\", type=\"rnu\")\n" +
+		"    depends_on(\"c\",\n" +
+		"    when=\"@1:\")\n\n" +
+		"    def install(self):\n" +
+		"        pass\n"
+	recipe, diagnostics := Parse(input)
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.String())
+	}
+	expected := []string{
+		"2:12: error: unmatched bracket",
+		"5:38: error: failed to parse variant: expected 'True' or 'False'",
+		"6:26: error: failed to parse depends_on: invalid dependency type \"rnu\"",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected diagnostics %q, got %q", expected, got)
+	}
+	if len(recipe.Versions) != 1 || recipe.Versions[0].Version.Val != `"2.0"` {
+		t.Errorf("expected version 2.0, got %+v", recipe.Versions)
+	}
+	if len(recipe.Depends) != 1 || recipe.Depends[0].Spec.Val != `"c"` {
+		t.Errorf("expected a dependency on c, got %+v", recipe.Depends)
+	}
+	if got := recipe.File.String(); got != input {
+		t.Errorf("expected the tree to print the input, got %q", got)
+	}
+}
+
+func TestParseStopsAtPhraseError(t *testing.T) {
+	_, diagnostics := Parse("import os\nx = 1\nclass A(Package):\n\tversion(\"1.0\")\n")
+	if len(diagnostics) != 1 || diagnostics[0].String() != "2:1: error: unexpected Identifier \"x\"" {
+		t.Errorf("expected an error for the statement before the class, got %v", diagnostics)
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	sha1 := "0123456789abcdef0123456789abcdef01234567"
+	for n, test := range [...]struct {
+		version  string
+		expected []string
+	}{
+		{`version("1", md5="0123456789abcdef0123456789ABCDEF")`, nil},
+		{`version("1", sha256="` + sha1 + sha1[:24] + `")`, nil},
+		{`version("1", sha256="` + sha1 + `")`, []string{"2:22: error: invalid sha256 checksum: expected 64 hexadecimal digits"}},
+		{`version("1", md5="0123456789abcdef0123456789abcdeg")`, []string{"2:19: error: invalid md5 checksum: expected 32 hexadecimal digits"}},
+		{`version("1", "0123456789abcdef0123456789abcdeg")`, []string{"2:15: error: invalid md5 checksum: expected 32 hexadecimal digits"}},
+		{`version("1", commit="` + sha1 + `")`, nil},
+		{`version("1", commit="abc123")`, []string{"2:22: warning: abbreviated commit hash"}},
+		{`version("1", commit="abc")`, []string{"2:22: error: invalid commit hash: expected 40 hexadecimal digits"}},
+		{`version("1", commit="v1.0")`, []string{"2:22: error: invalid commit hash: expected 40 hexadecimal digits"}},
+		{`version("1", tag="v1.0")`, nil},
+		{`version("1", tag="v1.0", commit="abc")`, []string{"2:34: error: invalid commit hash: expected 40 hexadecimal digits"}},
+		{`version("1", "0123456789abcdef0123456789abcdef", sha256="` + sha1 + sha1[:24] + `")`, []string{"2:51: warning: conflicting checksums: md5 and sha256"}},
+	} {
+		input := "class A(Package):\n\t" + test.version + "\n"
+		invalid := len(test.expected) > 0 && strings.Contains(test.expected[0], ": error: ")
+		if _, err := DoParse(input); (err != nil) != invalid {
+			t.Errorf("Test %d: expected an error %t, got %v", n+1, invalid, err)
+		}
+		_, diagnostics := Parse(input)
+		var got []string
+		for _, d := range diagnostics {
+			got = append(got, d.String())
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Test %d: expected diagnostics %q, got %q", n+1, test.expected, got)
+		}
+	}
+}
@@ -3,82 +3,309 @@ package parser
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/wtsi-hgi/uber-recipe-creator/phraser"
 	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
 )
 
+// Recipe is the part of a recipe's syntax tree that is modelled: its class
+// and the directives that were parsed. File is the whole tree, and each
+// directive, block and class holds the node it was parsed from.
 type Recipe struct {
+	File     *File
+	Class    *Class
 	Header   string
 	Indent   string
 	Versions []Version
+	Variants []Variant
 	Depends  []Dependency
 	Footer   string
 }
 
+// Version is a version(...) directive. HashType and Hash are its checksum, if
+// it has one, and Tag, Branch and Commit the git references it is fetched at.
+// Args holds the other keyword arguments, in order, along with any checksum
+// after the first.
 type Version struct {
 	Version   tokeniser.Token
 	HashType  tokeniser.Token
 	Hash      tokeniser.Token
+	Tag       *tokeniser.Token
+	Branch    *tokeniser.Token
+	Commit    *tokeniser.Token
 	URLType   *tokeniser.Token
 	URL       *tokeniser.Token
 	Preferred *tokeniser.Token
+	Args      []KeywordArgument
+	Block     *Block
+	Node      *Directive
 }
 
+// Dependency is a depends_on(...) directive. Args holds its keyword arguments
+// other than type= and when=, such as patches=, in order.
 type Dependency struct {
-	Spec tokeniser.Token
-	Type []tokeniser.Token
-	When *tokeniser.Token
+	Spec  tokeniser.Token
+	Type  []tokeniser.Token
+	When  *tokeniser.Token
+	Args  []KeywordArgument
+	Block *Block
+	Node  *Directive
 }
 
+// DoParse parses a recipe, returning the first error Parse finds. Syntax
+// errors outside the version, variant and depends_on directives are tolerated,
+// and the text containing them is kept in the header or footer, so that
+// recipes with code the tokeniser doesn't understand can still be updated.
 func DoParse(input string) (*Recipe, error) {
-	phrases, err := phraser.DoPhrase(input)
-	if err != nil {
+	recipe, diagnostics := Parse(input)
+	if err := diagnostics.Err(); err != nil {
 		return nil, err
 	}
+	return recipe, nil
+}
 
-	var header, footer, indent strings.Builder
-	var seenVersionOrDepends bool
-	var versions []Version
-	var depends []Dependency
+// Parse parses a recipe, carrying on after an error with the next statement,
+// and returns as much of the recipe as it could parse along with every problem
+// it found. A statement that fails to parse is kept as text. Syntax errors
+// that the tokeniser recovered from outside the directives are warnings.
+func Parse(input string) (*Recipe, Diagnostics) {
+	file, tokenErrs, phraseErr := parseFile(input)
 
-	for _, phrase := range phrases {
-		switch phrase.Type {
-		case phraser.PhraseVersion:
-			seenVersionOrDepends = true
-			setIndent(&phrase, &indent)
-			version, err := parseVersion(phrase)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse version: %w", err)
-			}
-			versions = append(versions, version)
-		case phraser.PhraseDependsOn:
-			seenVersionOrDepends = true
-			setIndent(&phrase, &indent)
-			dependency, err := parseDependency(phrase)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse depends_on: %w", err)
-			}
-			depends = append(depends, dependency)
+	rp := recipeParser{tokenErrs: tokenErrs, reported: make(map[*tokeniser.Error]bool)}
+	rp.parse(file.Body, nil)
+	if phraseErr != nil {
+		var e *tokeniser.Error
+		if errors.As(phraseErr, &e) {
+			rp.reported[e] = true
+		}
+		rp.diagnostics.add(phraseErr, SeverityError)
+	}
+	for _, e := range tokenErrs {
+		if !rp.reported[e] {
+			rp.diagnostics.add(e, SeverityWarning)
+		}
+	}
+	rp.diagnostics.sort()
+	rp.recipe.Header = rp.header.String()
+	rp.recipe.Footer = rp.footer.String()
+	rp.recipe.Indent = rp.indent.String()
+	rp.recipe.File = file
+
+	return &rp.recipe, rp.diagnostics
+}
+
+// recipeParser collects the parts of a recipe as Parse works through its
+// statements. Text before the first directive goes in the header, and text
+// after it in the footer.
+type recipeParser struct {
+	tokenErrs              []*tokeniser.Error
+	reported               map[*tokeniser.Error]bool
+	diagnostics            Diagnostics
+	header, footer, indent strings.Builder
+	seenDirective          bool
+	recipe                 Recipe
+}
+
+// parse parses statements, which are the body of block unless it's nil.
+// Directives are only taken from the class body and from with statements
+// that the parser models; the bodies of other compound statements, such as
+// methods, are kept as text.
+func (rp *recipeParser) parse(nodes []Node, block *Block) {
+	for _, node := range nodes {
+		compound, ok := node.(*Compound)
+		if !ok {
+			rp.directive(node, block)
+			continue
+		}
+		switch compound.Phrase.Type {
+		case phraser.PhraseClass:
+			rp.class(compound)
+			rp.parse(compound.Body, block)
+		case phraser.PhraseWith:
+			rp.with(compound, block)
 		default:
-			sb := &header
-			if seenVersionOrDepends {
-				sb = &footer
-			}
-			joinTokens(phrase.Tokens, sb)
+			rp.text(compound)
 		}
 	}
+}
 
-	recipe := Recipe{
-		Header:   header.String(),
-		Footer:   footer.String(),
-		Indent:   indent.String(),
-		Versions: versions,
-		Depends:  depends,
+// class parses a class statement, but not its body.
+func (rp *recipeParser) class(node *Compound) {
+	rp.text(&Statement{Phrase: node.Phrase})
+	if err := rp.diagnosticIn(node.Phrase); err != nil {
+		rp.diagnostics.add(err, SeverityError)
+		return
+	}
+	class, err := parseClass(node)
+	if err != nil {
+		rp.diagnostics.add(wrapError(err, "failed to parse class"), SeverityError)
+		return
 	}
+	rp.recipe.Class = &class
+}
 
-	return &recipe, nil
+// with parses a with statement, taking its body apart if its context
+// managers are Spack's and it only holds directives the parser models.
+func (rp *recipeParser) with(node *Compound, block *Block) {
+	phrase := node.Phrase
+	contexts, err := parseWith(phrase)
+	if err != nil || contexts != nil && modelled(node.Body) {
+		if err := rp.diagnosticIn(phrase); err != nil {
+			rp.diagnostics.add(err, SeverityError)
+			rp.text(node)
+			return
+		}
+	}
+	if err != nil {
+		rp.diagnostics.add(wrapError(err, "failed to parse with statement"), SeverityError)
+		rp.text(node)
+		return
+	}
+	if contexts == nil || !modelled(node.Body) {
+		rp.text(node)
+		return
+	}
+	rp.seenDirective = true
+	rp.trimIndent(&phrase, block)
+	rp.parse(node.Body, &Block{Parent: block, Contexts: contexts, Node: node})
+}
+
+// directive parses a statement other than a compound one, keeping it as
+// text if it isn't a directive the parser models or fails to parse.
+func (rp *recipeParser) directive(node Node, block *Block) {
+	phrase := phraseOf(node)
+	directive, _ := node.(*Directive)
+	switch phrase.Type {
+	case phraser.PhraseVersion, phraser.PhraseVariant, phraser.PhraseDependsOn:
+	default:
+		rp.text(&Statement{Phrase: phrase})
+		return
+	}
+	if err := rp.diagnosticIn(phrase); err != nil {
+		rp.diagnostics.add(err, SeverityError)
+		rp.text(&Statement{Phrase: phrase})
+		return
+	}
+	statement := &Statement{Phrase: phrase}
+	rp.seenDirective = true
+	rp.trimIndent(&phrase, block)
+	var err error
+	switch phrase.Type {
+	case phraser.PhraseVersion:
+		var version Version
+		if version, err = parseVersion(phrase); err != nil {
+			err = wrapError(err, "failed to parse version")
+			break
+		}
+		version.Block, version.Node = block, directive
+		rp.recipe.Versions = append(rp.recipe.Versions, version)
+		checkChecksum(version, &rp.diagnostics)
+	case phraser.PhraseVariant:
+		var variant Variant
+		if variant, err = parseVariant(phrase); err != nil {
+			err = wrapError(err, "failed to parse variant")
+			break
+		}
+		variant.Block, variant.Node = block, directive
+		rp.recipe.Variants = append(rp.recipe.Variants, variant)
+	case phraser.PhraseDependsOn:
+		var dependency Dependency
+		if dependency, err = parseDependency(phrase); err != nil {
+			err = wrapError(err, "failed to parse depends_on")
+			break
+		}
+		dependency.Block, dependency.Node = block, directive
+		rp.recipe.Depends = append(rp.recipe.Depends, dependency)
+	}
+	if err != nil {
+		rp.diagnostics.add(err, SeverityError)
+		rp.text(statement)
+	}
+}
+
+// text adds the source of a statement, without parsing any directives in it,
+// to the header or footer.
+func (rp *recipeParser) text(node Node) {
+	sb := &rp.header
+	if rp.seenDirective {
+		sb = &rp.footer
+	}
+	writeSource(sb, node)
+}
+
+// trimIndent removes the leading newlines and indentation from a directive,
+// taking the recipe's indentation from it if it's the first one outside a
+// block.
+func (rp *recipeParser) trimIndent(phrase *phraser.Phrase, block *Block) {
+	var indent strings.Builder
+	setIndent(phrase, &indent)
+	if block == nil && rp.indent.Len() == 0 {
+		rp.indent.WriteString(indent.String())
+	}
+}
+
+// diagnosticIn returns the first tokeniser error within the phrase, if there
+// is one, marking it as reported.
+func (rp *recipeParser) diagnosticIn(phrase phraser.Phrase) error {
+	if len(phrase.Tokens) == 0 {
+		return nil
+	}
+	start := phrase.Tokens[0].Pos.Offset
+	end := phrase.Tokens[len(phrase.Tokens)-1].End().Offset
+	for _, d := range rp.tokenErrs {
+		if d.Pos.Offset >= start && d.Pos.Offset < end {
+			rp.reported[d] = true
+			return d
+		}
+	}
+	return nil
+}
+
+// diagnosticBefore returns the first tokeniser error, if it came before err
+// and so is likely to have caused it, and err otherwise.
+func diagnosticBefore(diagnostics []*tokeniser.Error, err error) error {
+	var e *tokeniser.Error
+	if len(diagnostics) > 0 && (!errors.As(err, &e) || diagnostics[0].Pos.Offset <= e.Pos.Offset) {
+		return diagnostics[0]
+	}
+	return err
+}
+
+// checkString returns an error unless the token is a string literal with a
+// constant value.
+func checkString(token tokeniser.Token) error {
+	if token.Type != tokeniser.TokenString {
+		return errorAt(token, "expected string")
+	}
+	if _, err := tokeniser.Unquote(token.Val); err != nil {
+		return errorAt(token, err.Error())
+	}
+	return nil
+}
+
+// hasNoValue reports whether Unquote failed because a well-formed literal's
+// value isn't known, as for an f-string or a named escape.
+func hasNoValue(err error) bool {
+	return errors.Is(err, tokeniser.ErrFormatString) || errors.Is(err, tokeniser.ErrNamedEscape)
+}
+
+func errorAt(token tokeniser.Token, msg string) error {
+	return &tokeniser.Error{Pos: token.Pos, Msg: msg}
+}
+
+func exprError(e Expr, msg string) error {
+	return &tokeniser.Error{Pos: e.Pos(), Msg: msg}
+}
+
+// wrapError adds context to an error while keeping its position.
+func wrapError(err error, context string) error {
+	var e *tokeniser.Error
+	if errors.As(err, &e) {
+		return &tokeniser.Error{Pos: e.Pos, Msg: context + ": " + e.Msg}
+	}
+	return fmt.Errorf("%s: %w", context, err)
 }
 
 func joinTokens(phrase []tokeniser.Token, sb *strings.Builder) {
@@ -107,146 +334,309 @@ func setIndent(phrase *phraser.Phrase, indent *strings.Builder) {
 	phrase.Tokens = phrase.Tokens[i:]
 }
 
+// checksumLengths maps the length of a checksum given without a keyword to
+// its type, as Spack does.
+var checksumLengths = map[int]string{32: "md5", 40: "sha1", 56: "sha224", 64: "sha256", 96: "sha384", 128: "sha512"}
+
 func parseVersion(phrase phraser.Phrase) (Version, error) {
 	var v Version
-	p := &phraser.Phraser{Tokens: phrase.Tokens}
-	p.Next()
-	p.AcceptRun(tokeniser.TokenWhitespace)
-	if p.Next() != (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: "("}) {
-		return v, errors.New("expected '('")
+	args, err := callArguments(phrase.Tokens)
+	if err != nil {
+		return v, err
 	}
-	p.AcceptRun(tokeniser.TokenWhitespace)
-	v.Version = p.Next()
-	if v.Version.Type != tokeniser.TokenString {
-		return v, errors.New("expected string")
+	if len(args) == 0 {
+		return v, errorAt(phrase.Tokens[0], "missing version")
 	}
-	for {
-		p.AcceptRun(tokeniser.TokenWhitespace)
-		nextToken := p.Next()
-		if nextToken == (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: ")"}) {
-			break
+	if v.Version, err = stringArgument(args[0]); err != nil {
+		return v, err
+	}
+	for n, arg := range args[1:] {
+		if arg.Keyword == nil {
+			if n > 0 {
+				return v, errorAt(arg.Value[0], "too many arguments")
+			}
+			if v.Hash, err = stringArgument(arg); err != nil {
+				return v, err
+			}
+			hashType, ok := checksumLengths[len(unquoteToken(v.Hash))]
+			if !ok {
+				return v, errorAt(v.Hash, "unknown checksum type")
+			}
+			v.HashType = tokeniser.Token{Val: hashType, Type: tokeniser.TokenIdentifier, Pos: v.Hash.Pos}
+			continue
+		}
+		value, err := parseExpr(arg.Value)
+		if err != nil {
+			return v, err
 		}
-		if nextToken != (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: ","}) {
-			return v, errors.New("expected ','")
-		}
-		p.AcceptRun(tokeniser.TokenWhitespace)
-		switch i := p.Next(); i {
-		case tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "sha256"},
-			tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "md5"},
-			tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "sha1"},
-			tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "sha224"},
-			tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "sha384"},
-			tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "sha512"},
-			tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "commit"},
-			tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "tag"},
-			tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "branch"}:
-			v.HashType = i
-			p.AcceptRun(tokeniser.TokenWhitespace)
-			if p.Next() != (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: "="}) {
-				return v, errors.New("expected '='")
-			}
-			p.AcceptRun(tokeniser.TokenWhitespace)
-			v.Hash = p.Next()
-			if v.Hash.Type != tokeniser.TokenString {
-				return v, errors.New("expected string")
-			}
-		case tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "url"},
-			tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "svn"},
-			tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "hg"},
-			tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "cvs"},
-			tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "git"}:
-			v.URLType = &i
-			p.AcceptRun(tokeniser.TokenWhitespace)
-			if p.Next() != (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: "="}) {
-				return v, errors.New("expected '='")
-			}
-			p.AcceptRun(tokeniser.TokenWhitespace)
-			url := p.Next()
-			if url.Type != tokeniser.TokenString {
-				return v, errors.New("expected string")
-			}
-			v.URL = &url
-		case tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "preferred"}:
-			p.AcceptRun(tokeniser.TokenWhitespace)
-			if p.Next() != (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: "="}) {
-				return v, errors.New("expected '='")
-			}
-			p.AcceptRun(tokeniser.TokenWhitespace)
-			preferred := p.Next()
-			if preferred.Type != tokeniser.TokenKeyword {
-				return v, errors.New("expected keyword")
-			}
-			if preferred.Val != "True" && preferred.Val != "False" {
-				return v, errors.New("expected 'True' or 'False'")
-			}
-			v.Preferred = &preferred
+		switch keyword := *arg.Keyword; keyword.Val {
+		case "sha256", "md5", "sha1", "sha224", "sha384", "sha512":
+			hash, err := stringArgument(arg)
+			if err != nil {
+				return v, err
+			}
+			if v.HashType.Val != "" {
+				// checkChecksum reports the conflict.
+				v.Args = append(v.Args, KeywordArgument{Keyword: keyword, Value: value})
+				continue
+			}
+			v.HashType, v.Hash = keyword, hash
+		case "tag", "branch", "commit":
+			ref, err := stringArgument(arg)
+			if err != nil {
+				return v, err
+			}
+			switch keyword.Val {
+			case "tag":
+				v.Tag = &ref
+			case "branch":
+				v.Branch = &ref
+			default:
+				v.Commit = &ref
+			}
+		case "url", "svn", "hg", "cvs", "git":
+			// A URL that is built by an expression is kept as it is.
+			url, err := stringValue(value)
+			if err != nil {
+				v.Args = append(v.Args, KeywordArgument{Keyword: keyword, Value: value})
+				continue
+			}
+			v.URLType, v.URL = &keyword, &url
+		case "preferred":
+			preferred, ok := value.(*Constant)
+			if !ok || preferred.Token.Type != tokeniser.TokenKeyword {
+				return v, exprError(value, "expected keyword")
+			}
+			if preferred.Token.Val == "None" {
+				return v, exprError(value, "expected 'True' or 'False'")
+			}
+			v.Preferred = &preferred.Token
+		default:
+			v.Args = append(v.Args, KeywordArgument{Keyword: keyword, Value: value})
 		}
 	}
 	return v, nil
 }
 
+// checksumDigits is the number of hexadecimal digits in each type of
+// checksum.
+var checksumDigits = map[string]int{"md5": 32, "sha1": 40, "sha224": 56, "sha256": 64, "sha384": 96, "sha512": 128}
+
+// minCommitDigits is the fewest hexadecimal digits an abbreviated commit
+// hash can have, as for git.
+const minCommitDigits = 4
+
+// checkChecksum adds any problem with a version's checksums or commit hash to
+// the diagnostics. An abbreviated commit hash is only a warning, as Spack
+// accepts one, but it might become ambiguous.
+func checkChecksum(v Version, diagnostics *Diagnostics) {
+	if digits, ok := checksumDigits[v.HashType.Val]; ok && !isHex(unquoteToken(v.Hash), digits, digits) {
+		diagnostics.add(errorAt(v.Hash, fmt.Sprintf("invalid %s checksum: expected %d hexadecimal digits", v.HashType.Val, digits)), SeverityError)
+	}
+	for _, arg := range v.Args {
+		if _, ok := checksumDigits[arg.Keyword.Val]; ok {
+			diagnostics.add(errorAt(arg.Keyword, fmt.Sprintf("conflicting checksums: %s and %s", v.HashType.Val, arg.Keyword.Val)), SeverityWarning)
+		}
+	}
+	if v.Commit == nil {
+		return
+	}
+	switch value := unquoteToken(*v.Commit); {
+	case !isHex(value, minCommitDigits, checksumDigits["sha1"]):
+		diagnostics.add(errorAt(*v.Commit, fmt.Sprintf("invalid commit hash: expected %d hexadecimal digits", checksumDigits["sha1"])), SeverityError)
+	case len(value) < checksumDigits["sha1"]:
+		diagnostics.add(errorAt(*v.Commit, "abbreviated commit hash"), SeverityWarning)
+	}
+}
+
+// isHex reports whether s is between min and max hexadecimal digits.
+func isHex(s string, min, max int) bool {
+	return len(s) >= min && len(s) <= max && strings.Trim(s, "0123456789abcdefABCDEF") == ""
+}
+
+// unquoteToken returns the value of a string token that has been checked.
+func unquoteToken(token tokeniser.Token) string {
+	s, _ := tokeniser.Unquote(token.Val)
+	return s
+}
+
+// dependencyParameters are the parameters of Spack's depends_on directive, in
+// the order they can be given positionally.
+var dependencyParameters = [...]string{"spec", "when", "type", "patches"}
+
+// DependencyTypes are the types of dependency Spack allows, in the order it
+// lists them.
+var DependencyTypes = [...]string{"build", "link", "run", "test"}
+
 func parseDependency(phrase phraser.Phrase) (Dependency, error) {
 	var d Dependency
-	p := &phraser.Phraser{Tokens: phrase.Tokens}
-	p.Next()
-	p.AcceptRun(tokeniser.TokenWhitespace)
-	if p.Next() != (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: "("}) {
-		return d, errors.New("expected '('")
-	}
-	p.AcceptRun(tokeniser.TokenWhitespace)
-	d.Spec = p.Next()
-	if d.Spec.Type != tokeniser.TokenString {
-		return d, errors.New("expected string")
+	args, err := callArguments(phrase.Tokens)
+	if err != nil {
+		return d, err
 	}
-	for {
-		p.AcceptRun(tokeniser.TokenWhitespace)
-		nextToken := p.Next()
-		if nextToken == (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: ")"}) {
-			break
+	for n, arg := range args {
+		var keyword tokeniser.Token
+		if arg.Keyword != nil {
+			keyword = *arg.Keyword
+		} else if n < len(dependencyParameters) {
+			keyword = tokeniser.Token{Val: dependencyParameters[n], Type: tokeniser.TokenIdentifier, Pos: arg.Value[0].Pos}
+		} else {
+			return d, errorAt(arg.Value[0], "too many arguments")
 		}
-		if nextToken != (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: ","}) {
-			return d, errors.New("expected ','")
-		}
-		p.AcceptRun(tokeniser.TokenWhitespace)
-		switch i := p.Next(); i {
-		case tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "type"}:
-			p.AcceptRun(tokeniser.TokenWhitespace)
-			if p.Next() != (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: "="}) {
-				return d, errors.New("expected '='")
-			}
-			p.AcceptRun(tokeniser.TokenWhitespace)
-			bracketOrType := p.Next()
-			if bracketOrType.Type == tokeniser.TokenString {
-				d.Type = []tokeniser.Token{bracketOrType}
-			} else if bracketOrType == (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: "("}) {
-				d.Type = append(d.Type, p.Next())
-				for {
-					if len(d.Type) > 3 {
-						return d, errors.New("too many arguments")
-					}
-					nextToken = p.Next()
-					if nextToken == (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: ")"}) {
-						break
-					}
-					if nextToken != (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: ","}) {
-						return d, errors.New("expected ','")
-					}
-					p.AcceptRun(tokeniser.TokenWhitespace)
-					d.Type = append(d.Type, p.Next())
-				}
-			}
-		case tokeniser.Token{Type: tokeniser.TokenIdentifier, Val: "when"}:
-			p.AcceptRun(tokeniser.TokenWhitespace)
-			if p.Next() != (tokeniser.Token{Type: tokeniser.TokenDelimiter, Val: "="}) {
-				return d, errors.New("expected '='")
-			}
-			p.AcceptRun(tokeniser.TokenWhitespace)
-			when := p.Next()
-			if when.Type != tokeniser.TokenString {
-				return d, errors.New("expected string")
+		switch keyword.Val {
+		case "spec":
+			if d.Spec, err = stringArgument(arg); err != nil {
+				return d, err
+			}
+		case "type":
+			if d.Type, err = typeArgument(arg); err != nil {
+				return d, err
+			}
+		case "when":
+			when, err := stringArgument(arg)
+			if err != nil {
+				return d, err
 			}
 			d.When = &when
+		default:
+			value, err := parseExpr(arg.Value)
+			if err != nil {
+				return d, err
+			}
+			d.Args = append(d.Args, KeywordArgument{Keyword: keyword, Value: value})
 		}
 	}
+	if d.Spec.Val == "" {
+		return d, errorAt(phrase.Tokens[0], "missing spec")
+	}
 	return d, nil
 }
+
+// typeArgument returns the dependency types in a type= argument, checking
+// that Spack allows them.
+func typeArgument(arg Argument) ([]tokeniser.Token, error) {
+	types, err := stringsArgument(arg)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range types {
+		value := unquoteToken(t)
+		if !slices.Contains(DependencyTypes[:], value) {
+			return nil, errorAt(t, fmt.Sprintf("invalid dependency type %q", value))
+		}
+		for _, other := range types[:i] {
+			if unquoteToken(other) == value {
+				return nil, errorAt(t, fmt.Sprintf("repeated dependency type %q", value))
+			}
+		}
+	}
+	return types, nil
+}
+
+// Argument is one argument of a directive. Keyword is nil for positional
+// arguments, and Value holds the tokens of the argument's expression, without
+// comments or surrounding whitespace.
+type Argument struct {
+	Keyword *tokeniser.Token
+	Value   []tokeniser.Token
+}
+
+// callArguments splits the arguments of a directive, such as
+// variant("x", default=True), whose name is the first token.
+func callArguments(tokens []tokeniser.Token) ([]Argument, error) {
+	args, _, err := callArgumentsAt(tokens, 0)
+	return args, err
+}
+
+// callArgumentsAt splits the arguments of the call whose name is tokens[i],
+// also returning the index of the token after its closing bracket.
+func callArgumentsAt(tokens []tokeniser.Token, i int) ([]Argument, int, error) {
+	i = skipSpace(tokens, i+1)
+	if i == len(tokens) || !tokens[i].Is(tokeniser.TokenDelimiter, "(") {
+		return nil, 0, errorAt(tokenAt(tokens, i), "expected '('")
+	}
+	var args []Argument
+	var keywords bool
+	for i++; ; i++ {
+		i = skipSpace(tokens, i)
+		if i == len(tokens) {
+			return nil, 0, errorAt(tokenAt(tokens, i), "expected ')'")
+		} else if tokens[i].Is(tokeniser.TokenDelimiter, ")") {
+			break
+		}
+		start := i
+		var arg Argument
+		if tokens[start].Type == tokeniser.TokenIdentifier {
+			if j := skipSpace(tokens, i+1); j < len(tokens) && tokens[j].Is(tokeniser.TokenDelimiter, "=") {
+				arg.Keyword = &tokens[start]
+				i = skipSpace(tokens, j+1)
+			}
+		}
+		if arg.Keyword == nil && keywords {
+			return nil, 0, errorAt(tokenAt(tokens, start), "positional argument follows keyword argument")
+		}
+		for _, other := range args {
+			if arg.Keyword != nil && other.Keyword != nil && other.Keyword.Val == arg.Keyword.Val {
+				return nil, 0, errorAt(*arg.Keyword, "repeated keyword argument")
+			}
+		}
+		keywords = arg.Keyword != nil
+		var depth int
+		var lambda bool
+		for ; i < len(tokens); i++ {
+			token := tokens[i]
+			if token.Type == tokeniser.TokenDelimiter && depth == 0 && (token.Val == ")" || token.Val == "," && !lambda) {
+				break
+			}
+			switch {
+			case token.Type == tokeniser.TokenComment:
+				continue
+			case token.Is(tokeniser.TokenKeyword, "lambda"):
+				// A lambda's parameters are separated by commas too.
+				lambda = depth == 0
+			case lambda && depth == 0 && token.Is(tokeniser.TokenDelimiter, ":"):
+				lambda = false
+			case token.Type != tokeniser.TokenDelimiter:
+			case strings.Contains("([{", token.Val):
+				depth++
+			case strings.Contains(")]}", token.Val):
+				depth--
+			}
+			arg.Value = append(arg.Value, token)
+		}
+		for len(arg.Value) > 0 && arg.Value[len(arg.Value)-1].Type == tokeniser.TokenWhitespace {
+			arg.Value = arg.Value[:len(arg.Value)-1]
+		}
+		if len(arg.Value) == 0 {
+			return nil, 0, errorAt(tokenAt(tokens, i), "expected argument")
+		}
+		args = append(args, arg)
+		if i == len(tokens) {
+			return nil, 0, errorAt(tokenAt(tokens, i), "expected ')'")
+		} else if tokens[i].Val == ")" {
+			break
+		}
+	}
+	return args, i + 1, nil
+}
+
+// skipSpace returns the index of the first token from i that isn't
+// whitespace or a comment.
+func skipSpace(tokens []tokeniser.Token, i int) int {
+	for i < len(tokens) && (tokens[i].Type == tokeniser.TokenWhitespace || tokens[i].Type == tokeniser.TokenComment) {
+		i++
+	}
+	return i
+}
+
+// tokenAt returns tokens[i], or a token marking the end of the tokens if i is
+// past them.
+func tokenAt(tokens []tokeniser.Token, i int) tokeniser.Token {
+	if i < len(tokens) {
+		return tokens[i]
+	}
+	if len(tokens) == 0 {
+		return tokeniser.Token{Type: tokeniser.TokenDone}
+	}
+	return tokeniser.Token{Type: tokeniser.TokenDone, Pos: tokens[len(tokens)-1].End()}
+}
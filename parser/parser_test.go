@@ -2,7 +2,9 @@ package parser
 
 import (
 	_ "embed"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
@@ -268,6 +270,9 @@ class RArraymvout(RPackage):
 		if err != nil {
 			t.Fatalf("Test %d: failed to parse test recipe: %s", n+1, err)
 		}
+		stripPositions(recipe)
+		// The class statement is checked by TestClass.
+		recipe.Class = nil
 
 		if !reflect.DeepEqual(recipe, test.expectation) {
 			errorPrinted := false
@@ -301,3 +306,242 @@ class RArraymvout(RPackage):
 		}
 	}
 }
+
+func stripPosition(token *tokeniser.Token) {
+	if token != nil {
+		token.Pos = tokeniser.Position{}
+	}
+}
+
+func stripPositions(recipe *Recipe) {
+	recipe.File = nil
+	for i := range recipe.Versions {
+		v := &recipe.Versions[i]
+		v.Node = nil
+		stripPosition(&v.Version)
+		stripPosition(&v.HashType)
+		stripPosition(&v.Hash)
+		stripPosition(v.URLType)
+		stripPosition(v.URL)
+		stripPosition(v.Preferred)
+	}
+	for i := range recipe.Depends {
+		d := &recipe.Depends[i]
+		d.Node = nil
+		stripPosition(&d.Spec)
+		for j := range d.Type {
+			stripPosition(&d.Type[j])
+		}
+		stripPosition(d.When)
+	}
+}
+
+func TestParserPositions(t *testing.T) {
+	recipe, err := DoParse(testdata.TestCran1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := recipe.Versions[0].Hash
+	offset := strings.Index(testdata.TestCran1, hash.Val)
+	if hash.Pos != (tokeniser.Position{Offset: offset, Line: 20, Column: 21}) {
+		t.Errorf("unexpected hash position: %+v", hash.Pos)
+	}
+	if pos := recipe.Depends[1].Spec.Pos.String(); pos != "23:13" {
+		t.Errorf("unexpected spec position: %s", pos)
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	for n, test := range [...]struct {
+		input    string
+		expected string
+	}{
+		{
+			"class A(RPackage):\n\tversion(\"1.0\" md5=\"abc00000000000000000000000000000\")\n",
+			"2:16: failed to parse version: expected ','",
+		},
+		{
+			"class A(RPackage):\n\tversion(\"1.0\", md5=\"abc00000000000000000000000000000\")\n\n\tdepends_on(r, type=\"run\")\n",
+			"4:13: failed to parse depends_on: expected string",
+		},
+		{
+			"class A(RPackage):\n\tdepends_on(\"r\", when=\"@1:\"",
+			"2:12: unmatched bracket",
+		},
+		{
+			"def f():\n\tpass\n",
+			"1:1: unexpected Keyword \"def\"",
+		},
+		{
+			"class A(RPackage):\n\tversion(\"1.0\", preferred=1)\n",
+			"2:27: failed to parse version: expected keyword",
+		},
+		{
+			"class A(RPackage):\n\tversion(\"1.0\"",
+			"2:9: unmatched bracket",
+		},
+		{
+			"class A(RPackage):\n\tversion(\"1.0\", md5=\"abc)\n",
+			"2:21: newline in string",
+		},
+		{
+			"class A(RPackage):\n\tversion(f\"{v}\", md5=\"abc00000000000000000000000000000\")\n",
+			"2:10: failed to parse version: f-strings have no constant value",
+		},
+		{
+			"class A(RPackage):\n\tdepends_on(\"r\", type=(\"build\", \"\\x\"))\n",
+			"2:33: failed to parse depends_on: truncated \\x escape",
+		},
+		{
+			"$ = 1\nclass A(RPackage):\n",
+			"1:1: invalid delimiter",
+		},
+	} {
+		_, err := DoParse(test.input)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Test %d: expected error %q, got %v", n+1, test.expected, err)
+		}
+	}
+}
+
+func TestParserTolerant(t *testing.T) {
+	input := "class A(RPackage):\n\tversion(\"1.0\", md5=\"abc00000000000000000000000000000\")\n\n\tdef install(self):\n\t\tx = $y\n\t\tz = 'w\n"
+	recipe, err := DoParse(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(recipe.Versions) != 1 || recipe.Versions[0].Version.Val != "\"1.0\"" {
+		t.Errorf("expected version 1.0, got %v", recipe.Versions)
+	}
+	if expected := "\n\n\tdef install(self):\n\t\tx = $y\n\t\tz = 'w"; recipe.Footer != expected {
+		t.Errorf("expected footer %q, got %q", expected, recipe.Footer)
+	}
+}
+
+func TestParserMethodBody(t *testing.T) {
+	input := "class A(Package):\n\tversion(\"2.0\")\n\n\tdef url_for_version(self, version):\n\t\tversion(\"1.0\")\n\t\treturn url\n\n\tversion(\"1.5\")\n"
+	recipe, err := DoParse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []string
+	for _, v := range recipe.Versions {
+		versions = append(versions, v.Version.Val)
+	}
+	if expected := []string{`"2.0"`, `"1.5"`}; !reflect.DeepEqual(versions, expected) {
+		t.Errorf("expected versions %q, got %q", expected, versions)
+	}
+	if expected := "\n\n\tdef url_for_version(self, version):\n\t\tversion(\"1.0\")\n\t\treturn url"; recipe.Footer != expected {
+		t.Errorf("expected footer %q, got %q", expected, recipe.Footer)
+	}
+}
+
+func TestParserVersionArgs(t *testing.T) {
+	recipe, err := DoParse("class A(Package):\n" +
+		"\tversion(\"2.0\", sha256=\"abc0000000000000000000000000000000000000000000000000000000000000\", deprecated=True, expand=False, extension=\"tar.gz\")\n" +
+		"\tversion(\"1.0\", branch=\"main\", submodules=True, get_full_repo=True, git=\"https://example.com/a.git\")\n" +
+		"\tversion(\"0.9\", \"0123456789abcdef0123456789abcdef\", fetch_options=lambda: 1)\n")
+	if err == nil {
+		t.Fatal("expected an error for an unsupported expression")
+	}
+	if expected := "4:67: failed to parse version: unsupported expression"; err.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, err)
+	}
+
+	recipe, err = DoParse("class A(Package):\n" +
+		"\tversion(\"2.0\", sha256=\"abc0000000000000000000000000000000000000000000000000000000000000\", deprecated=True, expand=False, extension=\"tar.gz\")\n" +
+		"\tversion(\"1.0\", branch=\"main\", submodules=True, get_full_repo=True, git=\"https://example.com/a.git\")\n" +
+		"\tversion(\"0.9\", \"0123456789abcdef0123456789abcdef\", fetch_options=dict(timeout=60))\n" +
+		"\tversion(\"0.8\", tag=\"v0.8\", git=join_url(base, \"a.git\"))\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, expected := range [...][]string{
+		{"deprecated *parser.Constant True", "expand *parser.Constant False", `extension *parser.String "tar.gz"`},
+		{"submodules *parser.Constant True", "get_full_repo *parser.Constant True"},
+		{"fetch_options *parser.Call dict(timeout=60)"},
+		{`git *parser.Call join_url(base, "a.git")`},
+	} {
+		var got []string
+		for _, arg := range recipe.Versions[n].Args {
+			got = append(got, fmt.Sprintf("%s %T %s", arg.Keyword.Val, arg.Value, Format(arg.Value)))
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Test %d: expected arguments %q, got %q", n+1, expected, got)
+		}
+	}
+	if v := recipe.Versions[1]; v.Branch == nil || v.HashType.Val != "" || v.URLType == nil || v.URLType.Val != "git" {
+		t.Errorf("expected a branch and git URL, got %+v", v)
+	}
+	if v := recipe.Versions[3]; v.Tag == nil || v.URLType != nil {
+		t.Errorf("expected a tag and no git URL, got %+v", v)
+	}
+	if v := recipe.Versions[2]; v.HashType.Val != "md5" || v.Hash.Val != `"0123456789abcdef0123456789abcdef"` {
+		t.Errorf("expected a positional md5 checksum, got %+v", v)
+	}
+
+	recipe, err = DoParse("class A(Package):\n" +
+		"\tversion(\"1.2\", tag=\"v1.2\", commit=\"0123456789abcdef0123456789abcdef01234567\")\n" +
+		"\tversion(\"1.1\", \"0123456789abcdef0123456789abcdef\", sha256=\"abc0000000000000000000000000000000000000000000000000000000000000\")\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := recipe.Versions[0]; v.Tag == nil || v.Tag.Val != `"v1.2"` || v.Commit == nil || v.HashType.Val != "" {
+		t.Errorf("expected a tag and a commit, got %+v", v)
+	}
+	if v := recipe.Versions[1]; v.HashType.Val != "md5" || len(v.Args) != 1 || v.Args[0].Keyword.Val != "sha256" {
+		t.Errorf("expected the md5 checksum and the sha256 one as an argument, got %+v", v)
+	}
+}
+
+func TestParserDependencyArgs(t *testing.T) {
+	recipe, err := DoParse("class A(Package):\n" +
+		"\tdepends_on(\"b\", type=[\"build\", \"link\", \"run\", \"test\"])\n" +
+		"\tdepends_on(\"c\", \"@2:\", \"build\")\n" +
+		"\tdepends_on(\"d\", patches=patch(\"fix.patch\", when=\"@1\"), type=(\"run\",))\n" +
+		"\tdepends_on(\"e\", patches=[patch(\"a.patch\"), patch(\"b.patch\")], when=\"+x\")\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, expected := range [...]struct {
+		types []string
+		when  string
+		args  []string
+	}{
+		{[]string{`"build"`, `"link"`, `"run"`, `"test"`}, "", nil},
+		{[]string{`"build"`}, `"@2:"`, nil},
+		{[]string{`"run"`}, "", []string{`patches *parser.Call patch("fix.patch", when="@1")`}},
+		{nil, `"+x"`, []string{`patches *parser.List [patch("a.patch"), patch("b.patch")]`}},
+	} {
+		d := recipe.Depends[n]
+		var when string
+		if d.When != nil {
+			when = d.When.Val
+		}
+		var args []string
+		for _, arg := range d.Args {
+			args = append(args, fmt.Sprintf("%s %T %s", arg.Keyword.Val, arg.Value, Format(arg.Value)))
+		}
+		if types := vals(d.Type); !reflect.DeepEqual(types, expected.types) || when != expected.when || !reflect.DeepEqual(args, expected.args) {
+			t.Errorf("Test %d: expected %v, %q and %q, got %v, %q and %q", n+1, expected.types, expected.when, expected.args, types, when, args)
+		}
+	}
+}
+
+func TestParserDependencyErrors(t *testing.T) {
+	for n, test := range [...]struct {
+		input    string
+		expected string
+	}{
+		{"\tdepends_on(\"b\", type=\"install\")\n", "2:23: failed to parse depends_on: invalid dependency type \"install\""},
+		{"\tdepends_on(\"b\", type=(\"run\", \"build\", \"run\"))\n", "2:40: failed to parse depends_on: repeated dependency type \"run\""},
+		{"\tdepends_on(\"b\", type=build)\n", "2:23: failed to parse depends_on: expected string"},
+		{"\tdepends_on(type=\"build\")\n", "2:2: failed to parse depends_on: missing spec"},
+		{"\tdepends_on(\"b\", \"@1\", \"build\", None, 1)\n", "2:39: failed to parse depends_on: too many arguments"},
+	} {
+		_, err := DoParse("class A(Package):\n" + test.input)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Test %d: expected error %q, got %v", n+1, test.expected, err)
+		}
+	}
+}
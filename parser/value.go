@@ -0,0 +1,452 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+// Expr is a node in the syntax tree of a Python expression, such as the value
+// of a directive's argument. Only the subset of Python found in directives is
+// supported: literals, names, attributes, calls, tuples, lists, dicts, and the
+// + and % operators.
+type Expr interface {
+	Pos() tokeniser.Position
+}
+
+// String is one or more adjacent string literals, any of which may be an
+// f-string.
+type String struct {
+	Tokens []tokeniser.Token
+}
+
+// Constant is a number, True, False or None.
+type Constant struct {
+	Token tokeniser.Token
+}
+
+// Name is a reference to a variable.
+type Name struct {
+	Token tokeniser.Token
+}
+
+// Attribute is an attribute of an expression, such as os.path.
+type Attribute struct {
+	X    Expr
+	Name tokeniser.Token
+}
+
+// Call is a function call, such as join_url(base, "a.tar.gz").
+type Call struct {
+	Func Expr
+	Args []CallArgument
+}
+
+// CallArgument is an argument of a call. Keyword is nil for positional
+// arguments.
+type CallArgument struct {
+	Keyword *tokeniser.Token
+	Value   Expr
+}
+
+// Tuple is a tuple, which must be in brackets.
+type Tuple struct {
+	Open     tokeniser.Token
+	Elements []Expr
+}
+
+// List is a list display.
+type List struct {
+	Open     tokeniser.Token
+	Elements []Expr
+}
+
+// Dict is a dict display, with a value for each key.
+type Dict struct {
+	Open   tokeniser.Token
+	Keys   []Expr
+	Values []Expr
+}
+
+// Paren is an expression in brackets.
+type Paren struct {
+	Open tokeniser.Token
+	X    Expr
+}
+
+// Unary is a signed expression, such as -1.
+type Unary struct {
+	Op tokeniser.Token
+	X  Expr
+}
+
+// Binary is an addition or a % format.
+type Binary struct {
+	X  Expr
+	Op tokeniser.Token
+	Y  Expr
+}
+
+func (e *String) Pos() tokeniser.Position    { return e.Tokens[0].Pos }
+func (e *Constant) Pos() tokeniser.Position  { return e.Token.Pos }
+func (e *Name) Pos() tokeniser.Position      { return e.Token.Pos }
+func (e *Attribute) Pos() tokeniser.Position { return e.X.Pos() }
+func (e *Call) Pos() tokeniser.Position      { return e.Func.Pos() }
+func (e *Tuple) Pos() tokeniser.Position     { return e.Open.Pos }
+func (e *List) Pos() tokeniser.Position      { return e.Open.Pos }
+func (e *Dict) Pos() tokeniser.Position      { return e.Open.Pos }
+func (e *Paren) Pos() tokeniser.Position     { return e.Open.Pos }
+func (e *Unary) Pos() tokeniser.Position     { return e.Op.Pos }
+func (e *Binary) Pos() tokeniser.Position    { return e.X.Pos() }
+
+// KeywordArgument is a keyword argument of a directive whose value has been
+// parsed.
+type KeywordArgument struct {
+	Keyword tokeniser.Token
+	Value   Expr
+}
+
+// Format returns the Python source of an expression on a single line, with
+// literals as they were written.
+func Format(e Expr) string {
+	var sb strings.Builder
+	format(&sb, e)
+	return sb.String()
+}
+
+func format(sb *strings.Builder, e Expr) {
+	switch e := e.(type) {
+	case *String:
+		for i, token := range e.Tokens {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(token.Val)
+		}
+	case *Constant:
+		sb.WriteString(e.Token.Val)
+	case *Name:
+		sb.WriteString(e.Token.Val)
+	case *Attribute:
+		format(sb, e.X)
+		sb.WriteString("." + e.Name.Val)
+	case *Call:
+		format(sb, e.Func)
+		sb.WriteByte('(')
+		for i, arg := range e.Args {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			if arg.Keyword != nil {
+				sb.WriteString(arg.Keyword.Val + "=")
+			}
+			format(sb, arg.Value)
+		}
+		sb.WriteByte(')')
+	case *Tuple:
+		sb.WriteByte('(')
+		formatElements(sb, e.Elements)
+		if len(e.Elements) == 1 {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte(')')
+	case *List:
+		sb.WriteByte('[')
+		formatElements(sb, e.Elements)
+		sb.WriteByte(']')
+	case *Dict:
+		sb.WriteByte('{')
+		for i := range e.Keys {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			format(sb, e.Keys[i])
+			sb.WriteString(": ")
+			format(sb, e.Values[i])
+		}
+		sb.WriteByte('}')
+	case *Paren:
+		sb.WriteByte('(')
+		format(sb, e.X)
+		sb.WriteByte(')')
+	case *Unary:
+		sb.WriteString(e.Op.Val)
+		format(sb, e.X)
+	case *Binary:
+		format(sb, e.X)
+		sb.WriteString(" " + e.Op.Val + " ")
+		format(sb, e.Y)
+	}
+}
+
+// formatElements writes the comma separated elements of a tuple or list.
+func formatElements(sb *strings.Builder, elements []Expr) {
+	for i, e := range elements {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		format(sb, e)
+	}
+}
+
+// unparen returns the expression inside any brackets around e.
+func unparen(e Expr) Expr {
+	for {
+		p, ok := e.(*Paren)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
+
+// exprParser is a recursive descent parser for expressions, working on tokens
+// that aren't whitespace or comments.
+type exprParser struct {
+	tokens []tokeniser.Token
+	pos    int
+}
+
+// parseExpr parses the tokens of an argument's value, which must be a single
+// expression.
+func parseExpr(tokens []tokeniser.Token) (Expr, error) {
+	p := exprParser{tokens: significant(tokens)}
+	if len(p.tokens) == 0 {
+		return nil, errorAt(tokenAt(tokens, len(tokens)), "expected value")
+	}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, errorAt(p.tokens[p.pos], "expected ','")
+	}
+	return e, nil
+}
+
+func (p *exprParser) peek() tokeniser.Token {
+	return tokenAt(p.tokens, p.pos)
+}
+
+// accept consumes the next token if it is the given delimiter or operator.
+func (p *exprParser) accept(val string) bool {
+	if token := p.peek(); (token.Type == tokeniser.TokenDelimiter || token.Type == tokeniser.TokenOperator) && token.Val == val {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(val string) error {
+	if !p.accept(val) {
+		return errorAt(p.peek(), "expected '"+val+"'")
+	}
+	return nil
+}
+
+// expr parses a sum.
+func (p *exprParser) expr() (Expr, error) {
+	x, err := p.term()
+	for err == nil && p.peek().Is(tokeniser.TokenOperator, "+") {
+		op := p.peek()
+		p.pos++
+		var y Expr
+		if y, err = p.term(); err == nil {
+			x = &Binary{X: x, Op: op, Y: y}
+		}
+	}
+	return x, err
+}
+
+// term parses a % format, which binds more tightly than +.
+func (p *exprParser) term() (Expr, error) {
+	x, err := p.unary()
+	for err == nil && p.peek().Is(tokeniser.TokenOperator, "%") {
+		op := p.peek()
+		p.pos++
+		var y Expr
+		if y, err = p.unary(); err == nil {
+			x = &Binary{X: x, Op: op, Y: y}
+		}
+	}
+	return x, err
+}
+
+func (p *exprParser) unary() (Expr, error) {
+	if op := p.peek(); op.Is(tokeniser.TokenOperator, "-") || op.Is(tokeniser.TokenOperator, "+") {
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{Op: op, X: x}, nil
+	}
+	return p.postfix()
+}
+
+// postfix parses a primary expression followed by any attributes and calls.
+func (p *exprParser) postfix() (Expr, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			name := p.peek()
+			if name.Type != tokeniser.TokenIdentifier {
+				return nil, errorAt(name, "expected attribute name")
+			}
+			p.pos++
+			x = &Attribute{X: x, Name: name}
+		case p.accept("("):
+			args, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			x = &Call{Func: x, Args: args}
+		default:
+			return x, nil
+		}
+	}
+}
+
+// arguments parses the arguments of a call, after its opening bracket.
+func (p *exprParser) arguments() ([]CallArgument, error) {
+	var args []CallArgument
+	for !p.accept(")") {
+		var arg CallArgument
+		if token := p.peek(); token.Type == tokeniser.TokenIdentifier && tokenAt(p.tokens, p.pos+1).Is(tokeniser.TokenDelimiter, "=") {
+			for _, other := range args {
+				if other.Keyword != nil && other.Keyword.Val == token.Val {
+					return nil, errorAt(token, "repeated keyword argument")
+				}
+			}
+			arg.Keyword = &token
+			p.pos += 2
+		} else if len(args) > 0 && args[len(args)-1].Keyword != nil {
+			return nil, errorAt(token, "positional argument follows keyword argument")
+		}
+		var err error
+		if arg.Value, err = p.expr(); err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if !p.accept(",") {
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return args, nil
+}
+
+func (p *exprParser) primary() (Expr, error) {
+	token := p.peek()
+	switch {
+	case token.Type == tokeniser.TokenString:
+		s := &String{}
+		for ; p.peek().Type == tokeniser.TokenString; p.pos++ {
+			if _, err := tokeniser.Unquote(p.peek().Val); err != nil && !hasNoValue(err) {
+				return nil, errorAt(p.peek(), err.Error())
+			}
+			s.Tokens = append(s.Tokens, p.peek())
+		}
+		return s, nil
+	case token.Type == tokeniser.TokenNumber,
+		token.Is(tokeniser.TokenKeyword, "True"), token.Is(tokeniser.TokenKeyword, "False"), token.Is(tokeniser.TokenKeyword, "None"):
+		p.pos++
+		return &Constant{Token: token}, nil
+	case token.Type == tokeniser.TokenIdentifier:
+		p.pos++
+		return &Name{Token: token}, nil
+	case p.accept("("):
+		if p.accept(")") {
+			return &Tuple{Open: token}, nil
+		}
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.accept(")") {
+			return &Paren{Open: token, X: x}, nil
+		} else if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		elements, err := p.elements(")")
+		if err != nil {
+			return nil, err
+		}
+		return &Tuple{Open: token, Elements: append([]Expr{x}, elements...)}, nil
+	case p.accept("["):
+		elements, err := p.elements("]")
+		if err != nil {
+			return nil, err
+		}
+		return &List{Open: token, Elements: elements}, nil
+	case p.accept("{"):
+		return p.dict(token)
+	case token.Type == tokeniser.TokenDone:
+		return nil, errorAt(token, "expected value")
+	}
+	return nil, errorAt(token, "unsupported expression")
+}
+
+// elements parses comma separated expressions up to the closing bracket,
+// allowing a trailing comma.
+func (p *exprParser) elements(closing string) ([]Expr, error) {
+	var elements []Expr
+	for !p.accept(closing) {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, e)
+		if !p.accept(",") {
+			if err := p.expect(closing); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return elements, nil
+}
+
+// dict parses a dict display, after its opening bracket.
+func (p *exprParser) dict(open tokeniser.Token) (Expr, error) {
+	d := &Dict{Open: open}
+	for !p.accept("}") {
+		key, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		d.Keys, d.Values = append(d.Keys, key), append(d.Values, value)
+		if !p.accept(",") {
+			if err := p.expect("}"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return d, nil
+}
+
+// significant returns the tokens that aren't whitespace, comments or the
+// newlines before a statement.
+func significant(tokens []tokeniser.Token) []tokeniser.Token {
+	var sig []tokeniser.Token
+	for _, token := range tokens {
+		if token.Type != tokeniser.TokenWhitespace && token.Type != tokeniser.TokenComment && token.Type != tokeniser.TokenNewline {
+			sig = append(sig, token)
+		}
+	}
+	return sig
+}
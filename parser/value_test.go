@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+// expressionTokens drops the tokens that end the input.
+func expressionTokens(tokens []tokeniser.Token) []tokeniser.Token {
+	for len(tokens) > 0 && (tokens[len(tokens)-1].Type == tokeniser.TokenDone || tokens[len(tokens)-1].Type == tokeniser.TokenNewline) {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
+
+func TestParseExpr(t *testing.T) {
+	for n, test := range [...]struct {
+		input, expected string
+	}{
+		{`"tar.gz"`, `"tar.gz"`},
+		{`"a"  'b'`, `"a" 'b'`},
+		{`f"{x}.tar.gz"`, `f"{x}.tar.gz"`},
+		{"True", "True"},
+		{"None", "None"},
+		{"-1.5", "-1.5"},
+		{"url", "url"},
+		{"spack.util.url", "spack.util.url"},
+		{`( "a" , 1 )`, `("a", 1)`},
+		{`("a",)`, `("a",)`},
+		{"()", "()"},
+		{`("a")`, `("a")`},
+		{`["a", ("b", True),]`, `["a", ("b", True)]`},
+		{`{"a": 1, b: [2]}`, `{"a": 1, b: [2]}`},
+		{`patch("fix.patch", when="@1")`, `patch("fix.patch", when="@1")`},
+		{"join_url(\n\tbase,  # the mirror\n\t\"a.tar.gz\",\n)", `join_url(base, "a.tar.gz")`},
+		{`os.path.join("a")`, `os.path.join("a")`},
+		{`"@{0}".format(v).upper()`, `"@{0}".format(v).upper()`},
+		{`base + "/a-" + version`, `base + "/a-" + version`},
+		{`"%s-%s" % (a, b)`, `"%s-%s" % (a, b)`},
+		{"(a)(b)", "(a)(b)"},
+	} {
+		tokens, err := tokeniser.Tokenise(test.input)
+		if err != nil {
+			t.Fatalf("Test %d: %s", n+1, err)
+		}
+		e, err := parseExpr(expressionTokens(tokens))
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+		} else if got := Format(e); got != test.expected {
+			t.Errorf("Test %d: expected %s, got %s", n+1, test.expected, got)
+		}
+	}
+}
+
+func TestParseExprTree(t *testing.T) {
+	tokens, err := tokeniser.Tokenise(`a + "b" % c.d(e, f=1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := parseExpr(expressionTokens(tokens))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := func(val string, tokenType tokeniser.TokenType, column int) tokeniser.Token {
+		return tokeniser.Token{Val: val, Type: tokenType, Pos: tokeniser.Position{Offset: column - 1, Line: 1, Column: column}}
+	}
+	keyword := token("f", tokeniser.TokenIdentifier, 18)
+	expected := &Binary{
+		X:  &Name{Token: token("a", tokeniser.TokenIdentifier, 1)},
+		Op: token("+", tokeniser.TokenOperator, 3),
+		Y: &Binary{
+			X:  &String{Tokens: []tokeniser.Token{token(`"b"`, tokeniser.TokenString, 5)}},
+			Op: token("%", tokeniser.TokenOperator, 9),
+			Y: &Call{
+				Func: &Attribute{X: &Name{Token: token("c", tokeniser.TokenIdentifier, 11)}, Name: token("d", tokeniser.TokenIdentifier, 13)},
+				Args: []CallArgument{
+					{Value: &Name{Token: token("e", tokeniser.TokenIdentifier, 15)}},
+					{Keyword: &keyword, Value: &Constant{Token: token("1", tokeniser.TokenNumber, 20)}},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(e, expected) {
+		t.Errorf("expected %#v, got %#v", expected, e)
+	}
+	if pos := e.Pos().String(); pos != "1:1" {
+		t.Errorf("expected position 1:1, got %s", pos)
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for n, test := range [...]struct {
+		input, expected string
+	}{
+		{`"a" "b" c`, "1:9: expected ','"},
+		{"a - b", "1:3: expected ','"},
+		{"(1, +)", "1:6: unsupported expression"},
+		{"lambda x: x", "1:1: unsupported expression"},
+		{`"\x"`, "1:1: truncated \\x escape"},
+		{"f(a=1, b)", "1:8: positional argument follows keyword argument"},
+		{"f(a=1, a=2)", "1:8: repeated keyword argument"},
+		{"(1 2)", "1:4: expected ','"},
+		{"{1, 2}", "1:3: expected ':'"},
+		{"a.(b)", "1:3: expected attribute name"},
+		{"a +", "1:4: expected value"},
+	} {
+		tokens, err := tokeniser.Tokenise(test.input)
+		if err != nil {
+			t.Fatalf("Test %d: %s", n+1, err)
+		}
+		_, err = parseExpr(expressionTokens(tokens))
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Test %d: expected error %q, got %v", n+1, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/phraser"
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+// Variant is a variant(...) directive. Default holds the tokens of the
+// default value's expression, and Description the one or more adjacent string
+// literals of the description. Values are only set when the allowed values
+// are a literal list or tuple of strings; anything else, such as
+// any_combination_of(...), is kept in Extra with the arguments the parser
+// doesn't model, such as validator= and sticky=, as is a description whose
+// value isn't known because it has a named escape. Arguments in Extra always
+// have a keyword, even if they were given positionally.
+type Variant struct {
+	Name        tokeniser.Token
+	Default     []tokeniser.Token
+	Description []tokeniser.Token
+	Values      []tokeniser.Token
+	Multi       *tokeniser.Token
+	When        *tokeniser.Token
+	Extra       []Argument
+	Block       *Block
+	Node        *Directive
+}
+
+// variantParameters are the parameters of Spack's variant directive, in the
+// order they can be given positionally.
+var variantParameters = [...]string{"name", "default", "description", "values", "multi", "validator", "when", "sticky"}
+
+func parseVariant(phrase phraser.Phrase) (Variant, error) {
+	var v Variant
+	args, err := callArguments(phrase.Tokens)
+	if err != nil {
+		return v, err
+	}
+	for n, arg := range args {
+		var keyword string
+		if arg.Keyword != nil {
+			keyword = arg.Keyword.Val
+		} else if n < len(variantParameters) {
+			keyword = variantParameters[n]
+			arg.Keyword = &tokeniser.Token{Val: keyword, Type: tokeniser.TokenIdentifier, Pos: arg.Value[0].Pos}
+		} else {
+			return v, errorAt(arg.Value[0], "too many arguments")
+		}
+		switch keyword {
+		case "name":
+			if v.Name, err = stringArgument(arg); err != nil {
+				return v, err
+			}
+		case "default":
+			v.Default = arg.Value
+		case "description":
+			value, err := parseExpr(arg.Value)
+			if err != nil {
+				return v, err
+			}
+			description, ok := unparen(value).(*String)
+			if !ok {
+				return v, exprError(value, "expected string")
+			}
+			if slices.ContainsFunc(description.Tokens, func(token tokeniser.Token) bool {
+				_, err := tokeniser.Unquote(token.Val)
+				return errors.Is(err, tokeniser.ErrNamedEscape)
+			}) {
+				v.Extra = append(v.Extra, arg)
+				break
+			}
+			for _, token := range description.Tokens {
+				if err := checkString(token); err != nil {
+					return v, err
+				}
+			}
+			v.Description = description.Tokens
+		case "values":
+			if values, ok := stringSequence(arg.Value); ok {
+				v.Values = values
+			} else {
+				v.Extra = append(v.Extra, arg)
+			}
+		case "multi":
+			value, err := parseExpr(arg.Value)
+			if err != nil {
+				return v, err
+			}
+			multi, ok := value.(*Constant)
+			if !ok || !multi.Token.Is(tokeniser.TokenKeyword, "True") && !multi.Token.Is(tokeniser.TokenKeyword, "False") {
+				return v, exprError(value, "expected 'True' or 'False'")
+			}
+			v.Multi = &multi.Token
+		case "when":
+			when, err := stringArgument(arg)
+			if err != nil {
+				return v, err
+			}
+			v.When = &when
+		default:
+			v.Extra = append(v.Extra, arg)
+		}
+	}
+	if v.Name.Val == "" {
+		return v, errorAt(phrase.Tokens[0], "missing variant name")
+	}
+	return v, nil
+}
+
+// stringSequence returns the elements of a list or tuple of string literals,
+// reporting whether the tokens are one.
+func stringSequence(tokens []tokeniser.Token) ([]tokeniser.Token, bool) {
+	value, err := parseExpr(tokens)
+	if err != nil {
+		return nil, false
+	}
+	var elements []Expr
+	switch v := value.(type) {
+	case *Tuple:
+		elements = v.Elements
+	case *List:
+		elements = v.Elements
+	default:
+		return nil, false
+	}
+	var values []tokeniser.Token
+	for _, e := range elements {
+		token, err := stringValue(e)
+		if err != nil {
+			return nil, false
+		}
+		values = append(values, token)
+	}
+	return values, true
+}
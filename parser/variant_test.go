@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+// variantSummary holds the values of a Variant's tokens.
+type variantSummary struct {
+	Name, Default string
+	Description   []string
+	Values        []string
+	Multi, When   string
+	Extra         []string
+}
+
+func summariseVariant(v Variant) variantSummary {
+	s := variantSummary{
+		Name:        v.Name.Val,
+		Default:     joinVals(v.Default),
+		Description: vals(v.Description),
+		Values:      vals(v.Values),
+	}
+	if v.Multi != nil {
+		s.Multi = v.Multi.Val
+	}
+	if v.When != nil {
+		s.When = v.When.Val
+	}
+	for _, arg := range v.Extra {
+		s.Extra = append(s.Extra, arg.Keyword.Val+"="+joinVals(arg.Value))
+	}
+	return s
+}
+
+func vals(tokens []tokeniser.Token) []string {
+	var vals []string
+	for _, token := range tokens {
+		vals = append(vals, token.Val)
+	}
+	return vals
+}
+
+func joinVals(tokens []tokeniser.Token) string {
+	var sb strings.Builder
+	joinTokens(tokens, &sb)
+	return sb.String()
+}
+
+func TestVariant(t *testing.T) {
+	for n, test := range [...]struct {
+		input    string
+		expected []variantSummary
+	}{
+		{
+			"\tvariant(\"shared\", default=True, description=\"Build shared libraries\")\n",
+			[]variantSummary{{Name: `"shared"`, Default: "True", Description: []string{`"Build shared libraries"`}}},
+		},
+		{
+			"\tvariant('x11', True, 'Enable X11')\n",
+			[]variantSummary{{Name: `'x11'`, Default: "True", Description: []string{`'Enable X11'`}}},
+		},
+		{
+			"\tvariant(\n\t\t\"backend\",\n\t\tdefault=\"cpu\",  # the default\n\t\tdescription=\"The backend \"\n\t\t\"to use\",\n\t\tvalues=(\"cpu\", \"gpu\"),\n\t\tmulti=False,\n\t\twhen=\"@2:\",\n\t)\n",
+			[]variantSummary{{
+				Name:        `"backend"`,
+				Default:     `"cpu"`,
+				Description: []string{`"The backend "`, `"to use"`},
+				Values:      []string{`"cpu"`, `"gpu"`},
+				Multi:       "False",
+				When:        `"@2:"`,
+			}},
+		},
+		{
+			"\tvariant(\"libs\", default=\"shared,static\", values=[\"shared\", \"static\"], multi=True)\n",
+			[]variantSummary{{Name: `"libs"`, Default: `"shared,static"`, Values: []string{`"shared"`, `"static"`}, Multi: "True"}},
+		},
+		{
+			"\tvariant(\"cuda_arch\", values=any_combination_of(\"70\", \"80\"), sticky=True, validator=lambda pkg, name, values: None)\n",
+			[]variantSummary{{
+				Name:  `"cuda_arch"`,
+				Extra: []string{`values=any_combination_of("70", "80")`, "sticky=True", "validator=lambda pkg, name, values: None"},
+			}},
+		},
+		{
+			"\tvariant(\"a\", default=True)\n\tvariant(\"b\", default=False)\n",
+			[]variantSummary{{Name: `"a"`, Default: "True"}, {Name: `"b"`, Default: "False"}},
+		},
+	} {
+		recipe, err := DoParse("class A(Package):\n" + test.input)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+			continue
+		}
+		var summaries []variantSummary
+		for _, v := range recipe.Variants {
+			summaries = append(summaries, summariseVariant(v))
+		}
+		if !reflect.DeepEqual(summaries, test.expected) {
+			t.Errorf("Test %d: expected %+v, got %+v", n+1, test.expected, summaries)
+		}
+	}
+}
+
+func TestVariantErrors(t *testing.T) {
+	for n, test := range [...]struct {
+		input    string
+		expected string
+	}{
+		{"\tvariant(default=True)\n", "2:2: failed to parse variant: missing variant name"},
+		{"\tvariant(x11, default=True)\n", "2:10: failed to parse variant: expected string"},
+		{"\tvariant(\"x11\", multi=1)\n", "2:23: failed to parse variant: expected 'True' or 'False'"},
+		{"\tvariant(\"x11\", default=True, \"Enable X11\")\n", "2:31: failed to parse variant: positional argument follows keyword argument"},
+		{"\tvariant(\"x11\", when=\"+a\", when=\"+b\")\n", "2:28: failed to parse variant: repeated keyword argument"},
+		{"\tvariant(\"x11\", description=\"a\" + b)\n", "2:29: failed to parse variant: expected string"},
+		{"\tvariant(\"x11\",, default=True)\n", "2:16: failed to parse variant: expected argument"},
+		{"\tvariant \"x11\"\n", "2:10: failed to parse variant: expected '('"},
+	} {
+		_, err := DoParse("class A(Package):\n" + test.input)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Test %d: expected error %q, got %v", n+1, test.expected, err)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package phraser
 
 import (
-	"errors"
+	"fmt"
+	"io"
+	"iter"
 	"slices"
 
 	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
@@ -12,6 +14,20 @@ type Phrase struct {
 	Type   PhraseType
 }
 
+// Pos returns the position of the first token in the phrase that isn't
+// leading whitespace.
+func (p Phrase) Pos() tokeniser.Position {
+	for _, token := range p.Tokens {
+		if token.Type != tokeniser.TokenNewline && token.Type != tokeniser.TokenWhitespace {
+			return token.Pos
+		}
+	}
+	if len(p.Tokens) > 0 {
+		return p.Tokens[0].Pos
+	}
+	return tokeniser.Position{}
+}
+
 type PhraseType int
 
 func (p PhraseType) String() string {
@@ -30,6 +46,34 @@ func (p PhraseType) String() string {
 		return "Version"
 	case PhraseDependsOn:
 		return "DependsOn"
+	case PhraseVariant:
+		return "Variant"
+	case PhrasePatch:
+		return "Patch"
+	case PhraseConflicts:
+		return "Conflicts"
+	case PhraseProvides:
+		return "Provides"
+	case PhraseExtends:
+		return "Extends"
+	case PhraseResource:
+		return "Resource"
+	case PhraseMaintainers:
+		return "Maintainers"
+	case PhraseLicense:
+		return "License"
+	case PhraseListURL:
+		return "ListURL"
+	case PhraseCRAN:
+		return "CRAN"
+	case PhraseBioc:
+		return "Bioc"
+	case PhrasePyPI:
+		return "PyPI"
+	case PhraseRequires:
+		return "Requires"
+	case PhraseWith:
+		return "With"
 	case PhraseExtra:
 		return "Extra"
 	case PhraseDone:
@@ -44,9 +88,13 @@ func (p PhraseType) String() string {
 type PhraseFunc func(*Phraser) (Phrase, PhraseFunc)
 
 type Phraser struct {
-	Tokens  []tokeniser.Token
-	pos     int
-	lastPos int
+	Tokens    []tokeniser.Token
+	pos       int
+	lastPos   int
+	tokeniser *tokeniser.Tokeniser
+	end       tokeniser.Position
+	state     PhraseFunc
+	err       error
 }
 
 const (
@@ -57,13 +105,25 @@ const (
 	PhraseURL
 	PhraseVersion
 	PhraseDependsOn
+	PhraseVariant
+	PhrasePatch
+	PhraseConflicts
+	PhraseProvides
+	PhraseExtends
+	PhraseResource
+	PhraseMaintainers
+	PhraseLicense
+	PhraseListURL
+	PhraseCRAN
+	PhraseBioc
+	PhrasePyPI
+	PhraseRequires
+	PhraseWith
 	PhraseExtra
 	PhraseDone  = -1
 	PhraseError = -2
 )
 
-var done = tokeniser.Token{Val: "", Type: tokeniser.TokenDone}
-
 func DoPhrase(input string) ([]Phrase, error) {
 	tokens, err := tokeniser.Tokenise(input)
 	if err != nil {
@@ -73,19 +133,61 @@ func DoPhrase(input string) ([]Phrase, error) {
 	p := Phraser{Tokens: tokens}
 	var phrases []Phrase
 
-	state := stateStart
 	for {
-		var phrase Phrase
-		phrase, state = state(&p)
-		if phrase.Type == PhraseDone {
+		phrase, err := p.NextPhrase()
+		if err == io.EOF {
 			return phrases, nil
-		} else if phrase.Type == PhraseError {
-			return nil, errors.New(phrase.Tokens[len(phrase.Tokens)-1].Val)
+		} else if err != nil {
+			return nil, err
 		}
 		phrases = append(phrases, phrase)
 	}
 }
 
+// New returns a Phraser that takes tokens from t as it needs them, dropping
+// each phrase's tokens once it has been returned.
+func New(t *tokeniser.Tokeniser) *Phraser {
+	return &Phraser{tokeniser: t}
+}
+
+// NextPhrase returns the next phrase, or io.EOF when there are no more. Once
+// an error has been returned, every later call returns it again.
+func (p *Phraser) NextPhrase() (Phrase, error) {
+	if p.err != nil && p.err != io.EOF {
+		return Phrase{}, p.err
+	}
+	if p.state == nil {
+		p.state = stateStart
+	}
+	var phrase Phrase
+	phrase, p.state = p.state(p)
+	if p.err != nil && p.err != io.EOF {
+		return Phrase{}, p.err
+	}
+	switch phrase.Type {
+	case PhraseDone:
+		return Phrase{}, io.EOF
+	case PhraseError:
+		token := phrase.Tokens[0]
+		p.err = &tokeniser.Error{Pos: token.Pos, Msg: fmt.Sprintf("unexpected %s %q", token.Type, token.Val)}
+		return Phrase{}, p.err
+	}
+	return phrase, nil
+}
+
+// All returns an iterator over the remaining phrases. The iteration stops
+// after the first error.
+func (p *Phraser) All() iter.Seq2[Phrase, error] {
+	return func(yield func(Phrase, error) bool) {
+		for {
+			phrase, err := p.NextPhrase()
+			if err == io.EOF || !yield(phrase, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
 func stateStart(p *Phraser) (Phrase, PhraseFunc) {
 	p.AcceptRun(tokeniser.TokenNewline)
 	if p.Accept(tokeniser.TokenComment) {
@@ -95,7 +197,7 @@ func stateStart(p *Phraser) (Phrase, PhraseFunc) {
 	if c := p.Peek(); p.Accept(tokeniser.TokenKeyword) {
 		return p.importOrClass(c)
 	}
-	if p.Peek() == done {
+	if p.Peek().Type == tokeniser.TokenDone {
 		return stateDone(p)
 	}
 	return stateError(p)
@@ -114,8 +216,12 @@ func stateMain(p *Phraser) (Phrase, PhraseFunc) {
 	if p.Peek().Type == tokeniser.TokenDone {
 		return stateDone(p)
 	}
+	typ := PhraseType(PhraseExtra)
+	if p.Peek().Is(tokeniser.TokenKeyword, "with") {
+		typ = PhraseWith
+	}
 	p.ExceptRun(tokeniser.TokenNewline)
-	return Phrase{p.Get(), PhraseExtra}, stateMain
+	return Phrase{p.Get(), typ}, stateMain
 }
 
 func stateDone(p *Phraser) (Phrase, PhraseFunc) {
@@ -123,12 +229,12 @@ func stateDone(p *Phraser) (Phrase, PhraseFunc) {
 }
 
 func stateError(p *Phraser) (Phrase, PhraseFunc) {
-	return Phrase{p.Tokens, PhraseError}, stateDone
+	return Phrase{[]tokeniser.Token{p.Peek()}, PhraseError}, stateDone
 }
 
 func (p *Phraser) Next() tokeniser.Token {
-	if p.pos >= len(p.Tokens) {
-		return done
+	if !p.more() {
+		return p.done()
 	}
 	char := p.Tokens[p.pos]
 	p.pos++
@@ -136,7 +242,7 @@ func (p *Phraser) Next() tokeniser.Token {
 }
 
 func (p *Phraser) Accept(types ...tokeniser.TokenType) bool {
-	if p.pos >= len(p.Tokens) {
+	if !p.more() {
 		return false
 	}
 	char := p.Tokens[p.pos]
@@ -154,7 +260,7 @@ func (p *Phraser) AcceptRun(types ...tokeniser.TokenType) tokeniser.Token {
 }
 
 func (p *Phraser) Except(types ...tokeniser.TokenType) bool {
-	if p.pos >= len(p.Tokens) {
+	if !p.more() {
 		return false
 	}
 	char := p.Tokens[p.pos]
@@ -171,18 +277,51 @@ func (p *Phraser) ExceptRun(types ...tokeniser.TokenType) tokeniser.Token {
 	return p.Peek()
 }
 
+// more reports whether there are any tokens left, taking another from the
+// tokeniser if all those taken so far have been consumed.
+func (p *Phraser) more() bool {
+	if p.pos < len(p.Tokens) {
+		return true
+	}
+	if p.tokeniser == nil || p.err != nil {
+		return false
+	}
+	token, err := p.tokeniser.NextToken()
+	if err != nil {
+		p.err = err
+		return false
+	}
+	p.Tokens = append(p.Tokens, token)
+	p.end = token.End()
+	return true
+}
+
 func (p *Phraser) Peek() tokeniser.Token {
-	if p.pos >= len(p.Tokens) {
-		return done
+	if !p.more() {
+		return p.done()
 	}
 	char := p.Tokens[p.pos]
 	return char
 }
 
+// done returns the token marking the end of the input, positioned after the
+// last real token.
+func (p *Phraser) done() tokeniser.Token {
+	if len(p.Tokens) == 0 {
+		return tokeniser.Token{Type: tokeniser.TokenDone, Pos: p.end}
+	}
+	return tokeniser.Token{Type: tokeniser.TokenDone, Pos: p.Tokens[len(p.Tokens)-1].End()}
+}
+
 func (p *Phraser) Get() []tokeniser.Token {
 	lastPos := p.lastPos
 	p.lastPos = p.pos
-	return p.Tokens[lastPos:p.pos]
+	tokens := p.Tokens[lastPos:p.pos:p.pos]
+	if p.tokeniser != nil {
+		p.Tokens = p.Tokens[p.pos:]
+		p.pos, p.lastPos = 0, 0
+	}
+	return tokens
 }
 
 func (p *Phraser) importOrClass(c tokeniser.Token) (Phrase, PhraseFunc) {
@@ -193,22 +332,45 @@ func (p *Phraser) importOrClass(c tokeniser.Token) (Phrase, PhraseFunc) {
 	if c.Val == "class" {
 		return Phrase{p.Get(), PhraseClass}, stateMain
 	}
-	return Phrase{p.Get(), PhraseError}, stateError
+	return Phrase{[]tokeniser.Token{c}, PhraseError}, stateDone
+}
+
+// directives maps the identifier that starts a statement in the class body to
+// the type of the phrase, for Spack's directives and the package attributes
+// the tool knows about.
+var directives = map[string]PhraseType{
+	"homepage":    PhraseHomepage,
+	"url":         PhraseURL,
+	"git":         PhraseURL,
+	"urls":        PhraseURL,
+	"version":     PhraseVersion,
+	"depends_on":  PhraseDependsOn,
+	"variant":     PhraseVariant,
+	"patch":       PhrasePatch,
+	"conflicts":   PhraseConflicts,
+	"provides":    PhraseProvides,
+	"extends":     PhraseExtends,
+	"resource":    PhraseResource,
+	"maintainers": PhraseMaintainers,
+	"license":     PhraseLicense,
+	"list_url":    PhraseListURL,
+	"cran":        PhraseCRAN,
+	"bioc":        PhraseBioc,
+	"pypi":        PhrasePyPI,
+	"requires":    PhraseRequires,
+}
+
+// IsDirective reports whether name starts one of the statements in a class
+// body that the phraser recognises, such as version or homepage.
+func IsDirective(name string) bool {
+	_, ok := directives[name]
+	return ok
 }
 
 func (p *Phraser) identifier(c tokeniser.Token) (Phrase, PhraseFunc) {
 	p.ExceptRun(tokeniser.TokenNewline)
-	if c.Val == "homepage" {
-		return Phrase{p.Get(), PhraseHomepage}, stateMain
-	}
-	if c.Val == "url" || c.Val == "git" || c.Val == "urls" {
-		return Phrase{p.Get(), PhraseURL}, stateMain
-	}
-	if c.Val == "version" {
-		return Phrase{p.Get(), PhraseVersion}, stateMain
-	}
-	if c.Val == "depends_on" {
-		return Phrase{p.Get(), PhraseDependsOn}, stateMain
+	if typ, ok := directives[c.Val]; ok {
+		return Phrase{p.Get(), typ}, stateMain
 	}
 	return Phrase{p.Get(), PhraseExtra}, stateMain
 }
@@ -2,7 +2,9 @@ package phraser
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
 	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
@@ -10,6 +12,11 @@ import (
 
 func TestPhraser(t *testing.T) {
 	phrases, err := DoPhrase(testdata.TestRecipe1)
+	for i := range phrases {
+		for j := range phrases[i].Tokens {
+			phrases[i].Tokens[j].Pos = tokeniser.Position{}
+		}
+	}
 
 	if err != nil {
 		t.Errorf("unexpected error: %s", err)
@@ -343,3 +350,70 @@ func TestPhraser(t *testing.T) {
 		}
 	}
 }
+
+func TestNew(t *testing.T) {
+	for n, input := range [...]string{
+		testdata.TestRecipe1,
+		"",
+		"import a\nb = 1\n",
+		"class A:\n    version(\"1\"\n",
+	} {
+		expected, expectedErr := DoPhrase(input)
+		var phrases []Phrase
+		var err error
+		for phrase, e := range New(tokeniser.NewReader(iotest.OneByteReader(strings.NewReader(input)))).All() {
+			if e != nil {
+				err = e
+				break
+			}
+			phrases = append(phrases, phrase)
+		}
+		if !reflect.DeepEqual(err, expectedErr) {
+			t.Errorf("Test %d: expected error %v, got %v", n+1, expectedErr, err)
+		} else if err == nil && !reflect.DeepEqual(phrases, expected) {
+			t.Errorf("Test %d: got %v, want %v", n+1, phrases, expected)
+		}
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	for n, test := range [...]struct {
+		Line     string
+		Expected PhraseType
+	}{
+		{"homepage = \"https://example.com\"", PhraseHomepage},
+		{"url = \"https://example.com/a-1.tar.gz\"", PhraseURL},
+		{"git = \"https://example.com/a.git\"", PhraseURL},
+		{"urls = [\"https://example.com/a-1.tar.gz\"]", PhraseURL},
+		{"version(\"1\", sha256=\"abc\")", PhraseVersion},
+		{"depends_on(\"b\")", PhraseDependsOn},
+		{"variant(\"shared\", default=True, description=\"Build shared libraries\")", PhraseVariant},
+		{"patch(\"fix.patch\", when=\"@1\")", PhrasePatch},
+		{"conflicts(\"%intel\")", PhraseConflicts},
+		{"provides(\"mpi\")", PhraseProvides},
+		{"extends(\"r\")", PhraseExtends},
+		{"resource(\n\t\tname=\"b\",\n\t\turl=\"https://example.com/b.tar.gz\",\n\t)", PhraseResource},
+		{"maintainers(\"someone\")", PhraseMaintainers},
+		{"maintainers = [\"someone\"]", PhraseMaintainers},
+		{"license(\"MIT\")", PhraseLicense},
+		{"list_url = \"https://example.com/\"", PhraseListURL},
+		{"cran = \"abcrf\"", PhraseCRAN},
+		{"bioc = \"arrayMvout\"", PhraseBioc},
+		{"pypi = \"a/a-1.tar.gz\"", PhrasePyPI},
+		{"requires(\"%gcc\")", PhraseRequires},
+		{"build_directory = \"src\"", PhraseExtra},
+		{"variants = 1", PhraseExtra},
+		{"with when(\"@2:\"):", PhraseWith},
+		{"with default_args(type=(\"build\", \"run\")):", PhraseWith},
+		{"def install(self, spec, prefix):", PhraseExtra},
+	} {
+		phrases, err := DoPhrase("class A(Package):\n\t" + test.Line + "\n")
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+		} else if len(phrases) != 2 {
+			t.Errorf("Test %d: expected 2 phrases, got %d", n+1, len(phrases))
+		} else if phrases[1].Type != test.Expected {
+			t.Errorf("Test %d: expected phrase type %s, got %s", n+1, test.Expected, phrases[1].Type)
+		}
+	}
+}
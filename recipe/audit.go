@@ -0,0 +1,211 @@
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/spec"
+)
+
+type ProblemKind int
+
+const (
+	ProblemUnknownVersion ProblemKind = iota
+	ProblemChecksumMismatch
+	ProblemMissingDependency
+	ProblemUnexpectedDependency
+	ProblemWrongBound
+)
+
+func (p ProblemKind) String() string {
+	switch p {
+	case ProblemUnknownVersion:
+		return "unknown version"
+	case ProblemChecksumMismatch:
+		return "checksum mismatch"
+	case ProblemMissingDependency:
+		return "missing dependency"
+	case ProblemUnexpectedDependency:
+		return "unexpected dependency"
+	case ProblemWrongBound:
+		return "wrong bound"
+	default:
+		return "unknown"
+	}
+}
+
+func (p ProblemKind) MarshalText() ([]byte, error) {
+	return []byte(strings.ReplaceAll(p.String(), " ", "_")), nil
+}
+
+// Problem is a single difference between a recipe and upstream. Name is the
+// hash type for checksum problems and the Spack package name for dependency
+// problems.
+type Problem struct {
+	Kind     ProblemKind `json:"kind"`
+	Name     string      `json:"name,omitempty"`
+	Expected string      `json:"expected,omitempty"`
+	Actual   string      `json:"actual,omitempty"`
+}
+
+func (p Problem) String() string {
+	switch p.Kind {
+	case ProblemChecksumMismatch:
+		return fmt.Sprintf("%s %s: expected %s, got %s", p.Name, p.Kind, p.Expected, p.Actual)
+	case ProblemMissingDependency:
+		return fmt.Sprintf("%s: %s%s", p.Kind, p.Name, p.Expected)
+	case ProblemUnexpectedDependency:
+		return fmt.Sprintf("%s: %s%s", p.Kind, p.Name, p.Actual)
+	case ProblemWrongBound:
+		return fmt.Sprintf("%s for %s: expected %q, got %q", p.Kind, p.Name, p.Expected, p.Actual)
+	}
+	return p.Kind.String()
+}
+
+type VersionAudit struct {
+	Version  string    `json:"version"`
+	Problems []Problem `json:"problems"`
+}
+
+type AuditReport struct {
+	Name     string         `json:"name"`
+	Versions []VersionAudit `json:"versions"`
+}
+
+func (a AuditReport) HasDrift() bool {
+	for _, v := range a.Versions {
+		if len(v.Problems) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (a AuditReport) String() string {
+	var sb strings.Builder
+	sb.WriteString(a.Name + ":\n")
+	for _, v := range a.Versions {
+		if len(v.Problems) == 0 {
+			fmt.Fprintf(&sb, "  %s: ok\n", v.Version)
+			continue
+		}
+		fmt.Fprintf(&sb, "  %s:\n", v.Version)
+		for _, p := range v.Problems {
+			fmt.Fprintf(&sb, "    %s\n", p)
+		}
+	}
+	return sb.String()
+}
+
+// Audit rebuilds the expected checksums and dependencies of every version in
+// the recipe from upstream and reports where the recipe differs. The recipe
+// itself is not modified.
+func (r *Recipe) Audit(up Upstream) (*AuditReport, error) {
+	report := AuditReport{Name: r.Name}
+	for _, v := range r.Versions {
+		version := v.Version
+		audit := VersionAudit{Version: version, Problems: []Problem{}}
+		release, err := up.Release(r.Name, version)
+		if errors.Is(err, ErrUnknownVersion) {
+			audit.Problems = append(audit.Problems, Problem{Kind: ProblemUnknownVersion})
+			report.Versions = append(report.Versions, audit)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("fetching %s %s: %w", r.Name, version, err)
+		}
+		audit.Problems = append(audit.Problems, v.checksumProblems(release)...)
+		audit.Problems = append(audit.Problems, r.dependencyProblems(version, release)...)
+		report.Versions = append(report.Versions, audit)
+	}
+	return &report, nil
+}
+
+func (v Version) checksumProblems(release *Release) []Problem {
+	var problems []Problem
+	for _, c := range checksums {
+		value, ok := v.Extra[c.name]
+		if !ok {
+			continue
+		}
+		if actual := value; actual != release.Checksums[c.name] {
+			problems = append(problems, Problem{
+				Kind:     ProblemChecksumMismatch,
+				Name:     c.name,
+				Expected: release.Checksums[c.name],
+				Actual:   actual,
+			})
+		}
+	}
+	return problems
+}
+
+func (r *Recipe) dependencyProblems(version string, release *Release) []Problem {
+	expected := make(map[string]string)
+	var order []string
+	for _, dep := range release.dependencies() {
+		if comesWithR(dep.Name) {
+			continue
+		}
+		name := dep.spackName()
+		if _, ok := expected[name]; !ok {
+			order = append(order, name)
+		}
+		expected[name] = versionConstraint(dep.versions())
+	}
+
+	actual := make(map[string]string)
+	for _, d := range r.Dependencies {
+		name := d.Spec.Name
+		if name != "r" && !strings.HasPrefix(name, "r-") {
+			continue
+		}
+		resolved, err := d.Resolve()
+		if err != nil {
+			continue
+		}
+		if included, known := whenIncludes(resolved.When, version); !known || !included {
+			continue
+		}
+		if _, ok := actual[name]; !ok {
+			order = append(order, name)
+		}
+		actual[name] = versionConstraint(d.Spec.Versions)
+	}
+
+	var problems []Problem
+	seen := make(map[string]bool)
+	for _, name := range order {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		want, inUpstream := expected[name]
+		got, inRecipe := actual[name]
+		switch {
+		case !inRecipe:
+			problems = append(problems, Problem{Kind: ProblemMissingDependency, Name: name, Expected: want})
+		case !inUpstream:
+			problems = append(problems, Problem{Kind: ProblemUnexpectedDependency, Name: name, Actual: got})
+		case want != got:
+			problems = append(problems, Problem{Kind: ProblemWrongBound, Name: name, Expected: want, Actual: got})
+		}
+	}
+	return problems
+}
+
+// versionConstraint returns versions in the form they follow a package name
+// in a spec, such as "@1.2:".
+func versionConstraint(versions spec.VersionList) string {
+	return spec.Spec{Versions: versions}.String()
+}
+
+// whenIncludes reports whether a depends_on when clause applies to the given
+// version of the package. The second return value is false if the clause
+// depends on something other than the version, such as a variant.
+func whenIncludes(when spec.Spec, version string) (bool, bool) {
+	if when.String() != versionConstraint(when.Versions) {
+		return false, false
+	}
+	return when.Versions.Includes(version), true
+}
@@ -0,0 +1,189 @@
+package recipe
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+	"github.com/wtsi-hgi/uber-recipe-creator/spec"
+)
+
+const abcrfDescription = `Package: abcrf
+Type: Package
+Title: Approximate Bayesian Computation via Random Forests
+Version: 1.9
+Depends: R (>= 3.1)
+Imports: readr, MASS, matrixStats, ranger, doParallel, parallel,
+        foreach, stringr, Rcpp (>= 0.11.2)
+LinkingTo: Rcpp, RcppArmadillo
+NeedsCompilation: yes
+`
+
+func md5sum(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRepositoryRelease(t *testing.T) {
+	tarball := testdata.Tarball(t, "abcrf", abcrfDescription)
+	server := testdata.ServeFiles(t, map[string][]byte{
+		"/Archive/abcrf/abcrf_1.9.tar.gz": tarball,
+	})
+	repo := Repository{URL: server.URL}
+
+	release, err := repo.Release("abcrf", "1.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Name != "abcrf" || release.Version != "1.9" {
+		t.Errorf("unexpected release: %s %s", release.Name, release.Version)
+	}
+	if release.MD5sum != md5sum(tarball) || release.Checksums["md5"] != md5sum(tarball) {
+		t.Errorf("md5 incorrect, expected %s, got %s", md5sum(tarball), release.MD5sum)
+	}
+	if len(release.Checksums["sha256"]) != 64 {
+		t.Errorf("sha256 missing, got %q", release.Checksums["sha256"])
+	}
+	expected := []Dependency{
+		{Name: "R", Version: VersionRange{Min: "3.1"}},
+		{Name: "readr"},
+		{Name: "MASS"},
+		{Name: "matrixStats"},
+		{Name: "ranger"},
+		{Name: "doParallel"},
+		{Name: "parallel"},
+		{Name: "foreach"},
+		{Name: "stringr"},
+		{Name: "Rcpp", Version: VersionRange{Min: "0.11.2"}},
+	}
+	if !reflect.DeepEqual(release.Depends, expected) {
+		t.Errorf("dependencies incorrect, expected\n%+v, got\n%+v", expected, release.Depends)
+	}
+	if expected := []Dependency{{Name: "Rcpp"}, {Name: "RcppArmadillo"}}; !reflect.DeepEqual(release.LinkingTo, expected) {
+		t.Errorf("LinkingTo incorrect, expected %+v, got %+v", expected, release.LinkingTo)
+	}
+
+	if _, err := repo.Release("abcrf", "1.8"); err != ErrUnknownVersion {
+		t.Errorf("expected ErrUnknownVersion, got %v", err)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	tarball := testdata.Tarball(t, "abcrf", abcrfDescription)
+	drifted := testdata.Tarball(t, "abcrf", `Package: abcrf
+Version: 2.0
+Depends: R (>= 4.0)
+Imports: readr, Matrix, matrixStats, ranger, doParallel, foreach,
+        stringr, Rcpp (>= 0.11.2)
+LinkingTo: Rcpp, RcppArmadillo
+`)
+	server := testdata.ServeFiles(t, map[string][]byte{
+		"/abcrf_2.0.tar.gz":               drifted,
+		"/Archive/abcrf/abcrf_1.9.tar.gz": tarball,
+	})
+
+	t.Run("Clean recipe reports no drift", func(t *testing.T) {
+		r, err := parseRecipe(testdata.TestCran1, "abcrf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Versions[0].Extra["md5"] = md5sum(tarball)
+		r.Dependencies[8].Spec = spec.Spec{Name: "r-rcpp", Versions: spec.VersionList{{Lo: "0.11.2", IsRange: true}}}
+
+		report, err := r.Audit(Repository{URL: server.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.HasDrift() {
+			t.Errorf("unexpected drift:\n%s", report)
+		}
+	})
+
+	t.Run("Drifted recipe reports every problem", func(t *testing.T) {
+		r, err := parseRecipe(testdata.TestCran1, "abcrf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Versions = append([]Version{
+			{Version: "2.0", Extra: map[string]string{"md5": md5sum(drifted)}},
+			{Version: "1.0", Extra: map[string]string{"md5": "00000000000000000000000000000000"}},
+		}, r.Versions...)
+
+		report, err := r.Audit(Repository{URL: server.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := &AuditReport{
+			Name: "abcrf",
+			Versions: []VersionAudit{
+				{
+					Version: "2.0",
+					Problems: []Problem{
+						{Kind: ProblemWrongBound, Name: "r", Expected: "@4.0:", Actual: "@3.1:"},
+						{Kind: ProblemMissingDependency, Name: "r-matrix"},
+						{Kind: ProblemWrongBound, Name: "r-rcpp", Expected: "@0.11.2:"},
+						{Kind: ProblemUnexpectedDependency, Name: "r-mass"},
+					},
+				},
+				{
+					Version:  "1.0",
+					Problems: []Problem{{Kind: ProblemUnknownVersion}},
+				},
+				{
+					Version: "1.9",
+					Problems: []Problem{
+						{Kind: ProblemChecksumMismatch, Name: "md5", Expected: md5sum(tarball), Actual: "506f4cc36ae9d66bd174f4b65f8c3bb2"},
+						{Kind: ProblemWrongBound, Name: "r-rcpp", Expected: "@0.11.2:"},
+					},
+				},
+			},
+		}
+		if !reflect.DeepEqual(report, expected) {
+			t.Fatalf("report incorrect, expected\n%s\ngot\n%s", expected, report)
+		}
+		if !report.HasDrift() {
+			t.Error("expected drift")
+		}
+
+		data, err := json.Marshal(report.Versions[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `{"version":"1.0","problems":[{"kind":"unknown_version"}]}` {
+			t.Errorf("unexpected JSON: %s", data)
+		}
+	})
+}
+
+func TestWhenIncludes(t *testing.T) {
+	for n, test := range [...]struct {
+		when, version   string
+		included, known bool
+	}{
+		{"", "1.0", true, true},
+		{"@1.9:", "1.10", true, true},
+		{"@1.9:", "1.8", false, true},
+		{"@:1.9", "1.9.3", true, true},
+		{"@:1.9", "1.10", false, true},
+		{"@1.2:1.4,2:", "1.5", false, true},
+		{"@1.2:1.4,2:", "2.1", true, true},
+		{"@1.9", "1.9.1", true, true},
+		{"@=1.9", "1.9.1", false, true},
+		{"@:1.9 @:2.0", "1.8", true, true},
+		{"+x11", "1.8", false, false},
+		{"@2: %gcc", "2.1", false, false},
+	} {
+		when, err := spec.Parse(test.when)
+		if err != nil {
+			t.Fatalf("Test %d: %s", n+1, err)
+		}
+		included, known := whenIncludes(when, test.version)
+		if included != test.included || known != test.known {
+			t.Errorf("Test %d: whenIncludes(%q, %q) = %v, %v, want %v, %v", n+1, test.when, test.version, included, known, test.included, test.known)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package recipe
+
+import (
+	"slices"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/spec"
+)
+
+// Resolve returns the dependency as it would be outside of any block: with
+// the type and when= spec it inherits from default_args(...) if it doesn't
+// give its own, and with its when= spec constrained by every enclosing
+// when(...).
+func (d DependsOn) Resolve() (DependsOn, error) {
+	resolved := d
+	resolved.Block = nil
+	haveType, haveWhen := d.Type != nil, d.When.String() != ""
+	var err error
+	for b := d.Block; b != nil; b = b.Parent {
+		for i := len(b.Contexts) - 1; i >= 0; i-- {
+			c := b.Contexts[i]
+			if !c.DefaultArgs {
+				if resolved.When, err = resolved.When.Constrain(c.When); err != nil {
+					return DependsOn{}, err
+				}
+				continue
+			}
+			if !haveType && c.Type != nil {
+				resolved.Type, haveType = c.Type, true
+			}
+			if !haveWhen && c.When.String() != "" {
+				if resolved.When, err = resolved.When.Constrain(c.When); err != nil {
+					return DependsOn{}, err
+				}
+				haveWhen = true
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// addDependency adds a dependency after the others. If there's a block it can
+// go in without changing its type or when= spec, it's added at the end of the
+// last such block instead, leaving out the arguments the block provides.
+func (r *Recipe) addDependency(d DependsOn) {
+	tried := make(map[*Block]bool)
+	for i := len(r.Dependencies) - 1; i >= 0; i-- {
+		for b := r.Dependencies[i].Block; b != nil; b = b.Parent {
+			if tried[b] {
+				continue
+			}
+			tried[b] = true
+			if inBlock, ok := d.inBlock(b); ok {
+				r.Dependencies = slices.Insert(r.Dependencies, i+1, inBlock)
+				return
+			}
+		}
+	}
+	r.Dependencies = append(r.Dependencies, d)
+}
+
+// inBlock returns the dependency as it would be written in the block, or false
+// if the block would make it apply differently.
+func (d DependsOn) inBlock(b *Block) (DependsOn, bool) {
+	inherited, err := DependsOn{Spec: d.Spec, Block: b}.Resolve()
+	if err != nil {
+		return DependsOn{}, false
+	}
+	result := DependsOn{Spec: d.Spec, Type: d.Type, When: d.When, Block: b}
+	switch when := inherited.When.String(); {
+	case when == d.When.String():
+		result.When = spec.Spec{}
+	case when != "":
+		return DependsOn{}, false
+	}
+	switch {
+	case slices.Equal(inherited.Type, d.Type):
+		result.Type = nil
+	case d.Type == nil:
+		return DependsOn{}, false
+	}
+	return result, true
+}
+
+// chain returns the block and those it's in, outermost first.
+func (b *Block) chain() []*Block {
+	var blocks []*Block
+	for ; b != nil; b = b.Parent {
+		blocks = append(blocks, b)
+	}
+	slices.Reverse(blocks)
+	return blocks
+}
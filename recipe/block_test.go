@@ -0,0 +1,118 @@
+package recipe
+
+import (
+	"reflect"
+	"testing"
+)
+
+const blockRecipe = `class A(RPackage):
+	cran = "a"
+
+	version("2.0", md5="bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	version("1.0", md5="aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	with default_args(type=("build", "run")):
+		depends_on("r@3.5:")
+		depends_on("r-b", type="build")
+		with when("@2:"):
+			depends_on("r-c")
+	depends_on("r-d", when="@:1")
+`
+
+func TestReadBlocks(t *testing.T) {
+	r, err := parseRecipe(blockRecipe, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outer := r.Dependencies[0].Block
+	if outer == nil || outer.Parent != nil || r.Dependencies[1].Block != outer {
+		t.Fatalf("expected the first two dependencies to share a top-level block, got %+v", r.Dependencies)
+	}
+	if inner := r.Dependencies[2].Block; inner == nil || inner.Parent != outer {
+		t.Fatalf("expected a nested block, got %+v", inner)
+	}
+	if r.Dependencies[3].Block != nil {
+		t.Errorf("expected the last dependency to be outside any block")
+	}
+	if got := r.String(); got != blockRecipe {
+		t.Errorf("expected render:\n%s\ngot:\n%s", blockRecipe, got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r, err := parseRecipe(blockRecipe, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, expected := range [...]struct {
+		Type []string
+		When string
+	}{
+		{[]string{"build", "run"}, ""},
+		{[]string{"build"}, ""},
+		{[]string{"build", "run"}, "@2:"},
+		{nil, "@:1"},
+	} {
+		resolved, err := r.Dependencies[n].Resolve()
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+		} else if !reflect.DeepEqual(resolved.Type, expected.Type) || resolved.When.String() != expected.When || resolved.Block != nil {
+			t.Errorf("Test %d: expected type %v and when %q, got %+v", n+1, expected.Type, expected.When, resolved)
+		}
+	}
+}
+
+func TestResolveDefaultWhen(t *testing.T) {
+	r, err := parseRecipe(`class A(Package):
+	with when("+x11"), default_args(when="@2:"):
+		depends_on("b")
+		depends_on("c", when="@:1")
+		with default_args(type="link"):
+			depends_on("d")
+`, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, expected := range [...]string{"@2: +x11", "@:1 +x11", "@2: +x11"} {
+		resolved, err := r.Dependencies[n].Resolve()
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+		} else if got := resolved.When.String(); got != expected {
+			t.Errorf("Test %d: expected when %q, got %q", n+1, expected, got)
+		}
+	}
+	if resolved, _ := r.Dependencies[2].Resolve(); !reflect.DeepEqual(resolved.Type, []string{"link"}) {
+		t.Errorf("expected the nested default type, got %v", resolved.Type)
+	}
+}
+
+func TestUpdateIntoBlock(t *testing.T) {
+	r, err := parseRecipe(blockRecipe, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Update([]Package{{
+		Name:    "a",
+		Version: "3.0",
+		Depends: []Dependency{{Name: "R", Version: VersionRange{Min: "3.5"}}, {Name: "b"}, {Name: "c"}, {Name: "e"}},
+		MD5sum:  "cccccccccccccccccccccccccccccccc",
+	}})
+	expected := `class A(RPackage):
+	cran = "a"
+
+	version("3.0", md5="cccccccccccccccccccccccccccccccc")
+	version("2.0", md5="bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	version("1.0", md5="aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	with default_args(type=("build", "run")):
+		depends_on("r@3.5:")
+		depends_on("r-b", type="build")
+		with when("@2:"):
+			depends_on("r-c")
+		depends_on("r-e", when="@3.0:")
+	depends_on("r-d", when="@:1")
+`
+	if got := r.String(); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
@@ -0,0 +1,423 @@
+package recipe
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/parser"
+	"github.com/wtsi-hgi/uber-recipe-creator/spec"
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+type ChangeKind int
+
+const (
+	ChangeAdded ChangeKind = iota
+	ChangeRemoved
+	ChangeModified
+)
+
+func (c ChangeKind) String() string {
+	switch c {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "changed"
+	default:
+		return "unknown"
+	}
+}
+
+func (c ChangeKind) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *ChangeKind) UnmarshalText(text []byte) error {
+	for _, kind := range [...]ChangeKind{ChangeAdded, ChangeRemoved, ChangeModified} {
+		if kind.String() == string(text) {
+			*c = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown change kind: %q", text)
+}
+
+// Change is a single difference between two recipes. Name is the version,
+// package, variant or attribute it's about, and Field what changed about it,
+// if not the whole thing: an argument of a version, or "type" for a
+// dependency. Old and New are Python source, or spec constraints for
+// dependencies, and When is the versions of the recipe a dependency change
+// applies to, or the when= spec of a variant.
+type Change struct {
+	Kind  ChangeKind `json:"kind"`
+	Name  string     `json:"name"`
+	Field string     `json:"field,omitempty"`
+	When  string     `json:"when,omitempty"`
+	Old   string     `json:"old,omitempty"`
+	New   string     `json:"new,omitempty"`
+}
+
+// RecipeDiff is what changed between two recipes.
+type RecipeDiff struct {
+	Versions     []Change `json:"versions"`
+	Dependencies []Change `json:"dependencies"`
+	Variants     []Change `json:"variants"`
+	Attributes   []Change `json:"attributes"`
+}
+
+func (d RecipeDiff) Empty() bool {
+	return len(d.Versions)+len(d.Dependencies)+len(d.Variants)+len(d.Attributes) == 0
+}
+
+// String describes each change on its own line.
+func (d RecipeDiff) String() string {
+	var sb strings.Builder
+	for _, c := range d.Versions {
+		switch {
+		case c.Kind == ChangeAdded && c.Field != "":
+			fmt.Fprintf(&sb, "added version %s (%s %s)\n", c.Name, c.Field, c.New)
+		case c.Kind == ChangeModified:
+			fmt.Fprintf(&sb, "version %s: %s\n", c.Name, describeValues(c.Field, c.Old, c.New))
+		default:
+			fmt.Fprintf(&sb, "%s version %s\n", c.Kind, c.Name)
+		}
+	}
+	for _, c := range d.Dependencies {
+		var when string
+		if c.When != "" {
+			when = " when " + c.When
+		}
+		switch {
+		case c.Kind == ChangeAdded:
+			fmt.Fprintf(&sb, "added %s%s%s\n", c.Name, c.New, when)
+		case c.Kind == ChangeRemoved && c.When != "":
+			fmt.Fprintf(&sb, "dropped %s for %s\n", c.Name, c.When)
+		case c.Kind == ChangeRemoved:
+			fmt.Fprintf(&sb, "dropped %s\n", c.Name)
+		case c.Field == "type":
+			fmt.Fprintf(&sb, "%s now has type %s%s\n", c.Name, orDefault(c.New, "(default)"), when)
+		default:
+			fmt.Fprintf(&sb, "%s now requires %s%s\n", c.Name, orDefault(c.New, "any version"), when)
+		}
+	}
+	for _, c := range d.Variants {
+		switch c.Kind {
+		case ChangeAdded:
+			fmt.Fprintf(&sb, "added %s\n", c.New)
+		case ChangeRemoved:
+			fmt.Fprintf(&sb, "removed %s\n", c.Old)
+		default:
+			fmt.Fprintf(&sb, "variant %s: changed from %s to %s\n", c.Name, c.Old, c.New)
+		}
+	}
+	for _, c := range d.Attributes {
+		fmt.Fprintln(&sb, describeValues(c.Name, c.Old, c.New))
+	}
+	return sb.String()
+}
+
+// describeValues describes the change to a named value.
+func describeValues(name, old, new string) string {
+	switch {
+	case old == "":
+		return fmt.Sprintf("added %s = %s", name, new)
+	case new == "":
+		return fmt.Sprintf("removed %s", name)
+	}
+	return fmt.Sprintf("%s changed from %s to %s", name, old, new)
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// Diff compares two recipes, such as a recipe before and after an update.
+// Dependencies are compared by what they require of each package for each
+// version of the recipe, so that changes are reported for the range of
+// versions they affect rather than directive by directive.
+func Diff(a, b Recipe) RecipeDiff {
+	return RecipeDiff{
+		Versions:     diffVersions(a.Versions, b.Versions),
+		Dependencies: diffDependencies(a, b),
+		Variants:     diffVariants(a.Variants, b.Variants),
+		Attributes:   diffValues(argumentValues(a.Class.Attributes), argumentValues(b.Class.Attributes)),
+	}
+}
+
+func diffVersions(a, b []Version) []Change {
+	changes := []Change{}
+	old := make(map[string]Version)
+	for _, v := range slices.Backward(a) {
+		old[v.Version] = v
+	}
+	seen := make(map[string]bool)
+	for _, v := range b {
+		if seen[v.Version] {
+			continue
+		}
+		seen[v.Version] = true
+		o, ok := old[v.Version]
+		if !ok {
+			change := Change{Kind: ChangeAdded, Name: v.Version}
+			for _, k := range hashTypes {
+				if hash, ok := v.Extra[k]; ok {
+					change.Field, change.New = k, hash
+					break
+				}
+			}
+			changes = append(changes, change)
+			continue
+		}
+		for _, c := range diffValues(argumentValues(o.values()), argumentValues(v.values())) {
+			changes = append(changes, Change{Kind: ChangeModified, Name: v.Version, Field: c.Name, Old: c.Old, New: c.New})
+		}
+	}
+	for _, v := range a {
+		if !seen[v.Version] {
+			seen[v.Version] = true
+			changes = append(changes, Change{Kind: ChangeRemoved, Name: v.Version})
+		}
+	}
+	return changes
+}
+
+// values returns the arguments of a version other than the version itself.
+func (v Version) values() []Argument {
+	var values []Argument
+	for k, value := range v.Extra {
+		values = append(values, Argument{Name: k, Value: value, IsString: k != "preferred"})
+	}
+	slices.SortFunc(values, func(a, b Argument) int { return strings.Compare(a.Name, b.Name) })
+	return append(values, v.Args...)
+}
+
+// argumentValues returns the names and values of arguments, as Python source,
+// with later arguments replacing earlier ones of the same name.
+func argumentValues(args []Argument) [][2]string {
+	var values [][2]string
+	for _, arg := range args {
+		value := arg.Value
+		if arg.IsString {
+			value = tokeniser.Quote(arg.Value, '"')
+		}
+		values = slices.DeleteFunc(values, func(v [2]string) bool { return v[0] == arg.Name })
+		values = append(values, [2]string{arg.Name, value})
+	}
+	return values
+}
+
+// diffValues compares named values, reporting additions and changes in the
+// order of new and then removals in the order of old.
+func diffValues(old, new [][2]string) []Change {
+	changes := []Change{}
+	lookup := func(values [][2]string, name string) (string, bool) {
+		i := slices.IndexFunc(values, func(v [2]string) bool { return v[0] == name })
+		if i < 0 {
+			return "", false
+		}
+		return values[i][1], true
+	}
+	for _, v := range new {
+		if o, ok := lookup(old, v[0]); !ok {
+			changes = append(changes, Change{Kind: ChangeAdded, Name: v[0], New: v[1]})
+		} else if o != v[1] {
+			changes = append(changes, Change{Kind: ChangeModified, Name: v[0], Old: o, New: v[1]})
+		}
+	}
+	for _, o := range old {
+		if _, ok := lookup(new, o[0]); !ok {
+			changes = append(changes, Change{Kind: ChangeRemoved, Name: o[0], Old: o[1]})
+		}
+	}
+	return changes
+}
+
+func diffVariants(a, b []Variant) []Change {
+	changes := []Change{}
+	key := func(v Variant) string { return v.Name + " " + v.When.String() }
+	old := make(map[string]Variant)
+	for _, v := range a {
+		old[key(v)] = v
+	}
+	seen := make(map[string]bool)
+	for _, v := range b {
+		seen[key(v)] = true
+		o, ok := old[key(v)]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: ChangeAdded, Name: v.Name, When: v.When.String(), New: v.String()})
+		case o.String() != v.String():
+			changes = append(changes, Change{Kind: ChangeModified, Name: v.Name, When: v.When.String(), Old: o.String(), New: v.String()})
+		}
+	}
+	for _, v := range a {
+		if !seen[key(v)] {
+			seen[key(v)] = true
+			changes = append(changes, Change{Kind: ChangeRemoved, Name: v.Name, When: v.When.String(), Old: v.String()})
+		}
+	}
+	return changes
+}
+
+// requirement is what a recipe requires of a package for a version of the
+// recipe: the constraints on it, without its name, and its types.
+type requirement struct {
+	present     bool
+	constraints string
+	types       string
+}
+
+func diffDependencies(a, b Recipe) []Change {
+	var versions []string
+	for _, v := range append(slices.Clone(a.Versions), b.Versions...) {
+		if !slices.Contains(versions, v.Version) {
+			versions = append(versions, v.Version)
+		}
+	}
+	slices.SortFunc(versions, spec.CompareVersions)
+	aByVersion, aOther := splitDependencies(a.Dependencies, len(versions) > 0)
+	bByVersion, bOther := splitDependencies(b.Dependencies, len(versions) > 0)
+
+	var names []string
+	for _, deps := range [][]DependsOn{b.Dependencies, a.Dependencies} {
+		for _, d := range deps {
+			if !slices.Contains(names, d.Spec.Name) {
+				names = append(names, d.Spec.Name)
+			}
+		}
+	}
+
+	changes := []Change{}
+	for _, name := range names {
+		for i := 0; i < len(versions); {
+			old, new := requirementAt(aByVersion, name, versions[i]), requirementAt(bByVersion, name, versions[i])
+			j := i
+			for j+1 < len(versions) && requirementAt(aByVersion, name, versions[j+1]) == old && requirementAt(bByVersion, name, versions[j+1]) == new {
+				j++
+			}
+			changes = append(changes, requirementChanges(name, versionsWhen(versions, i, j), old, new)...)
+			i = j + 1
+		}
+		changes = append(changes, directiveChanges(name, aOther, bOther)...)
+	}
+	return changes
+}
+
+// splitDependencies resolves dependencies, separating those that only depend
+// on the version of the recipe from those that depend on other things, such
+// as variants. Dependencies whose blocks contradict them are left out.
+func splitDependencies(dependencies []DependsOn, byVersion bool) ([]DependsOn, []DependsOn) {
+	var versioned, other []DependsOn
+	for _, d := range dependencies {
+		resolved, err := d.Resolve()
+		if err != nil {
+			continue
+		}
+		if _, known := whenIncludes(resolved.When, ""); byVersion && known {
+			versioned = append(versioned, resolved)
+		} else {
+			other = append(other, resolved)
+		}
+	}
+	return versioned, other
+}
+
+// requirementAt combines the dependencies on a package that apply to a version
+// of the recipe.
+func requirementAt(dependencies []DependsOn, name, version string) requirement {
+	var req requirement
+	var combined spec.Spec
+	var types []string
+	for _, d := range dependencies {
+		if included, _ := whenIncludes(d.When, version); d.Spec.Name != name || !included {
+			continue
+		}
+		if !req.present {
+			combined = d.Spec
+		} else if constrained, err := combined.Constrain(d.Spec); err == nil {
+			combined = constrained
+		}
+		req.present = true
+		types = append(types, d.Type...)
+	}
+	combined.Name = ""
+	req.constraints = combined.String()
+	var ordered []string
+	for _, t := range parser.DependencyTypes {
+		if slices.Contains(types, t) {
+			ordered = append(ordered, t)
+		}
+	}
+	req.types = strings.Join(ordered, ", ")
+	return req
+}
+
+func requirementChanges(name, when string, old, new requirement) []Change {
+	switch {
+	case old == new:
+		return nil
+	case !old.present:
+		return []Change{{Kind: ChangeAdded, Name: name, When: when, New: new.constraints}}
+	case !new.present:
+		return []Change{{Kind: ChangeRemoved, Name: name, When: when, Old: old.constraints}}
+	}
+	var changes []Change
+	if old.constraints != new.constraints {
+		changes = append(changes, Change{Kind: ChangeModified, Name: name, When: when, Old: old.constraints, New: new.constraints})
+	}
+	if old.types != new.types {
+		changes = append(changes, Change{Kind: ChangeModified, Name: name, Field: "type", When: when, Old: old.types, New: new.types})
+	}
+	return changes
+}
+
+// versionsWhen returns the when= spec for the versions from i to j of the
+// sorted versions of the recipe, leaving the range open at either end if it
+// includes the oldest or newest.
+func versionsWhen(versions []string, i, j int) string {
+	lo, hi := versions[i], versions[j]
+	if i == 0 {
+		lo = ""
+	}
+	if j == len(versions)-1 {
+		hi = ""
+	}
+	switch {
+	case lo == "" && hi == "":
+		return ""
+	case lo == hi:
+		return "@" + lo
+	}
+	return "@" + spec.VersionRange{Lo: lo, Hi: hi, IsRange: true}.String()
+}
+
+// directiveChanges compares the dependencies on a package that don't only
+// depend on the version of the recipe, directive by directive.
+func directiveChanges(name string, a, b []DependsOn) []Change {
+	var changes []Change
+	contains := func(deps []DependsOn, d DependsOn) bool {
+		return slices.ContainsFunc(deps, func(e DependsOn) bool { return e.String() == d.String() })
+	}
+	constraints := func(d DependsOn) string {
+		s := d.Spec
+		s.Name = ""
+		return s.String()
+	}
+	for _, d := range b {
+		if d.Spec.Name == name && !contains(a, d) {
+			changes = append(changes, Change{Kind: ChangeAdded, Name: name, When: d.When.String(), New: constraints(d)})
+		}
+	}
+	for _, d := range a {
+		if d.Spec.Name == name && !contains(b, d) {
+			changes = append(changes, Change{Kind: ChangeRemoved, Name: name, When: d.When.String(), Old: constraints(d)})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,162 @@
+package recipe
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+	"github.com/wtsi-hgi/uber-recipe-creator/spec"
+)
+
+func TestDiffUpdate(t *testing.T) {
+	a, err := parseRecipe(testdata.TestCran1, "abcrf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := parseRecipe(testdata.TestCran1, "abcrf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Update([]Package{{
+		Name:    "abcrf",
+		Version: "1.10",
+		MD5sum:  "11111111111111111111111111111111",
+		Depends: []Dependency{{Name: "R", Version: VersionRange{Min: "3.1"}}, {Name: "Rcpp", Version: VersionRange{Min: "1.0.5"}}},
+	}})
+	for i, d := range b.Dependencies {
+		if d.Spec.Name == "r-mass" {
+			b.Dependencies[i].When = spec.Spec{Versions: spec.VersionList{{Hi: "1.9", IsRange: true}}}
+		}
+	}
+
+	diff := Diff(a, b)
+	expected := RecipeDiff{
+		Versions: []Change{{Kind: ChangeAdded, Name: "1.10", Field: "md5", New: "11111111111111111111111111111111"}},
+		Dependencies: []Change{
+			{Kind: ChangeRemoved, Name: "r-mass", When: "@1.10:"},
+			{Kind: ChangeModified, Name: "r-rcpp", When: "@1.10:", New: "@1.0.5:"},
+		},
+		Variants:   []Change{},
+		Attributes: []Change{},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("expected %+v, got %+v", expected, diff)
+	}
+	if got, expected := diff.String(), "added version 1.10 (md5 11111111111111111111111111111111)\n"+
+		"dropped r-mass for @1.10:\n"+
+		"r-rcpp now requires @1.0.5: when @1.10:\n"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if Diff(a, a).String() != "" || !Diff(b, b).Empty() {
+		t.Errorf("expected no changes between a recipe and itself")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a, err := parseRecipe(`class A(Package):
+	homepage = "https://a.example.com"
+	url = "https://a.example.com/a.tar.gz"
+
+	version("3.0", sha256="abc0000000000000000000000000000000000000000000000000000000000000", preferred=True)
+	version("2.0", sha256="abc0000000000000000000000000000000000000000000000000000000000000")
+	version("1.0", md5="cccccccccccccccccccccccccccccccc")
+
+	variant("x", default=True, description="X")
+	variant("y", default=False, description="Y")
+
+	depends_on("r@3:", type=("build", "run"))
+	depends_on("r-a", type="build")
+	depends_on("r-b", when="+x")
+	depends_on("r-c@2:", when="@2:")
+	depends_on("r-c", when="@:1")
+	depends_on("r-e")
+`, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := parseRecipe(`class A(Package):
+	homepage = "https://b.example.com"
+	list_url = "https://b.example.com/"
+
+	version("3.0", sha256="abc0000000000000000000000000000000000000000000000000000000000000")
+	version("2.0", sha256="def0000000000000000000000000000000000000000000000000000000000000", url="https://b/2.0.tar.gz")
+
+	variant("x", default=False, description="X")
+	variant("z", default=True, description="Z", when="@3:")
+
+	depends_on("r@3:", type=("build", "run"))
+	depends_on("r-a", type=("build", "run"))
+	depends_on("r-b", when="+x ^r-d")
+	with when("@3:"):
+		depends_on("r-c@2:")
+	depends_on("r-c@2:", when="@2")
+	depends_on("r-d@1:", when="@1:2")
+	depends_on("r-e", when="@:1")
+	depends_on("r-e", when="@3:")
+`, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := Diff(a, b)
+	expected := RecipeDiff{
+		Versions: []Change{
+			{Kind: ChangeModified, Name: "3.0", Field: "preferred", Old: "True"},
+			{Kind: ChangeModified, Name: "2.0", Field: "sha256", Old: `"abc0000000000000000000000000000000000000000000000000000000000000"`, New: `"def0000000000000000000000000000000000000000000000000000000000000"`},
+			{Kind: ChangeModified, Name: "2.0", Field: "url", New: `"https://b/2.0.tar.gz"`},
+			{Kind: ChangeRemoved, Name: "1.0"},
+		},
+		Dependencies: []Change{
+			{Kind: ChangeModified, Name: "r-a", Field: "type", Old: "build", New: "build, run"},
+			{Kind: ChangeAdded, Name: "r-b", When: "+x ^r-d"},
+			{Kind: ChangeRemoved, Name: "r-b", When: "+x"},
+			{Kind: ChangeRemoved, Name: "r-c", When: "@:1.0"},
+			{Kind: ChangeAdded, Name: "r-d", When: "@:2.0", New: "@1:"},
+			{Kind: ChangeRemoved, Name: "r-e", When: "@2.0"},
+		},
+		Variants: []Change{
+			{Kind: ChangeModified, Name: "x", Old: `variant("x", default=True, description="X")`, New: `variant("x", default=False, description="X")`},
+			{Kind: ChangeAdded, Name: "z", When: "@3:", New: `variant("z", default=True, description="Z", when="@3:")`},
+			{Kind: ChangeRemoved, Name: "y", Old: `variant("y", default=False, description="Y")`},
+		},
+		Attributes: []Change{
+			{Kind: ChangeModified, Name: "homepage", Old: `"https://a.example.com"`, New: `"https://b.example.com"`},
+			{Kind: ChangeAdded, Name: "list_url", New: `"https://b.example.com/"`},
+			{Kind: ChangeRemoved, Name: "url", Old: `"https://a.example.com/a.tar.gz"`},
+		},
+	}
+	for _, section := range [...]struct {
+		name          string
+		got, expected []Change
+	}{
+		{"versions", diff.Versions, expected.Versions},
+		{"dependencies", diff.Dependencies, expected.Dependencies},
+		{"variants", diff.Variants, expected.Variants},
+		{"attributes", diff.Attributes, expected.Attributes},
+	} {
+		if !reflect.DeepEqual(section.got, section.expected) {
+			t.Errorf("expected %s %+v, got %+v", section.name, section.expected, section.got)
+		}
+	}
+
+	expectedString := `version 3.0: removed preferred
+version 2.0: sha256 changed from "abc0000000000000000000000000000000000000000000000000000000000000" to "def0000000000000000000000000000000000000000000000000000000000000"
+version 2.0: added url = "https://b/2.0.tar.gz"
+removed version 1.0
+r-a now has type build, run
+added r-b when +x ^r-d
+dropped r-b for +x
+dropped r-c for @:1.0
+added r-d@1: when @:2.0
+dropped r-e for @2.0
+variant x: changed from variant("x", default=True, description="X") to variant("x", default=False, description="X")
+added variant("z", default=True, description="Z", when="@3:")
+removed variant("y", default=False, description="Y")
+homepage changed from "https://a.example.com" to "https://b.example.com"
+added list_url = "https://b.example.com/"
+removed url
+`
+	if got := diff.String(); got != expectedString {
+		t.Errorf("expected:\n%s\ngot:\n%s", expectedString, got)
+	}
+}
@@ -0,0 +1,204 @@
+package recipe
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/spec"
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+// Style is the layout Format gives a recipe. Indent is the indentation of
+// one level and Quote the quote character for strings; if they're empty the
+// recipe's own are kept. Docstrings are rewrapped to fit in Width characters,
+// unless it's zero.
+type Style struct {
+	Indent string
+	Quote  byte
+	Width  int
+}
+
+var paragraphPattern = regexp.MustCompile(`\n[ \t]*\n\s*`)
+
+// Format lays out the recipe in the given style. The recipe is printed and
+// parsed again with the indentation and quotes of its statements changed and
+// the docstring rewrapped, so that comments and code are kept; its versions
+// and dependencies are then sorted and every directive rendered anew. It
+// returns an error if the restyled recipe can't be parsed.
+func (r *Recipe) Format(style Style) error {
+	if style.Indent == "" {
+		style.Indent = r.Indent
+	}
+	if style.Quote == 0 {
+		style.Quote = r.Quote
+	}
+	if style.Quote == 0 {
+		style.Quote = '"'
+	}
+	text, bom := strings.CutPrefix(r.String(), "\uFEFF")
+	text = restyle(text, r.Indent, style)
+	if bom {
+		text = "\uFEFF" + text
+	}
+	formatted, err := parseRecipe(text, r.Name)
+	if err == nil && style.Width > 0 {
+		formatted.Indent, formatted.Quote = style.Indent, style.Quote
+		if wrapped := formatted.wrapDocstring(text, style.Width); wrapped != text {
+			formatted, err = parseRecipe(wrapped, r.Name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	formatted.Indent, formatted.Quote = style.Indent, style.Quote
+	if formatted.source != nil {
+		formatted.source.restyled = true
+	}
+	*r = formatted
+	r.SortVersions()
+	r.SortDependencies()
+	return nil
+}
+
+// SortVersions puts the versions newest first, as Spack lists them.
+func (r *Recipe) SortVersions() {
+	slices.SortStableFunc(r.Versions, func(a, b Version) int {
+		return spec.CompareVersions(b.Version, a.Version)
+	})
+}
+
+// SortDependencies puts the dependencies on R first and the rest in order of
+// name, keeping those in the same block together, in the order the blocks
+// first appear.
+func (r *Recipe) SortDependencies() {
+	groups := make(map[*Block]int)
+	for _, d := range r.Dependencies {
+		if _, ok := groups[d.Block]; !ok {
+			groups[d.Block] = len(groups)
+		}
+	}
+	slices.SortStableFunc(r.Dependencies, func(a, b DependsOn) int {
+		if isR := a.Spec.Name == "r"; isR != (b.Spec.Name == "r") {
+			if isR {
+				return -1
+			}
+			return 1
+		}
+		if c := cmp.Compare(groups[a.Block], groups[b.Block]); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Spec.Name, b.Spec.Name)
+	})
+}
+
+// restyle changes the indentation of each line of Python source from one
+// level of indent to the style's, keeping any alignment beyond whole levels,
+// and requotes the strings that can be requoted without adding escapes.
+// Trailing whitespace is dropped.
+func restyle(text, indent string, style Style) string {
+	tokens, _ := tokeniser.TokeniseMode(text, tokeniser.Tolerant)
+	var sb strings.Builder
+	lineStart := true
+	for i, token := range tokens {
+		trailing := i+1 == len(tokens) || tokens[i+1].Type == tokeniser.TokenNewline
+		switch {
+		case token.Type == tokeniser.TokenWhitespace && trailing && !strings.ContainsAny(token.Val, "\r\n"):
+		case token.Type == tokeniser.TokenWhitespace && lineStart:
+			sb.WriteString(changeIndent(token.Val, indent, style.Indent))
+		case token.Type == tokeniser.TokenWhitespace && strings.ContainsAny(token.Val, "\r\n"):
+			n := strings.LastIndexAny(token.Val, "\r\n") + 1
+			sb.WriteString(token.Val[:n] + changeIndent(token.Val[n:], indent, style.Indent))
+		case token.Type == tokeniser.TokenString:
+			sb.WriteString(requote(token.Val, style.Quote))
+		default:
+			sb.WriteString(token.Val)
+		}
+		lineStart = token.Type == tokeniser.TokenNewline
+	}
+	return sb.String()
+}
+
+// changeIndent replaces each leading level of indentation in whitespace.
+func changeIndent(whitespace, from, to string) string {
+	if from == "" || from == to {
+		return whitespace
+	}
+	var levels int
+	for strings.HasPrefix(whitespace, from) {
+		whitespace = whitespace[len(from):]
+		levels++
+	}
+	return strings.Repeat(to, levels) + whitespace
+}
+
+// requote returns a plain single-line string literal in the given quote
+// character, if it has no escapes and doesn't contain that character.
+func requote(literal string, quote byte) string {
+	if literal[0] == quote || !strings.Contains(`"'`, literal[:1]) ||
+		strings.HasPrefix(literal, strings.Repeat(literal[:1], 3)) || strings.Contains(literal, `\`) {
+		return literal
+	}
+	value, err := tokeniser.Unquote(literal)
+	if err != nil || strings.IndexByte(value, quote) >= 0 {
+		return literal
+	}
+	return tokeniser.Quote(value, quote)
+}
+
+// wrapDocstring rewraps each paragraph of the class's docstring in text, that
+// the recipe was parsed from, to fit in width characters, as a triple-quoted
+// string whose first line follows the opening quotes, with a blank line after
+// it. Docstrings that would need escapes are left as they are.
+func (r Recipe) wrapDocstring(text string, width int) string {
+	if r.source == nil || len(r.source.docstring) == 0 {
+		return text
+	}
+	doc := r.Class.Docstring
+	delim := strings.Repeat(string(r.Quote), 3)
+	if strings.TrimSpace(doc) == "" || strings.Contains(doc, `\`) || strings.Contains(doc, delim) ||
+		strings.HasSuffix(strings.TrimSpace(doc), string(r.Quote)) {
+		return text
+	}
+
+	paragraphs := paragraphPattern.Split(strings.TrimSpace(doc), -1)
+	var lines []string
+	for i, paragraph := range paragraphs {
+		words := strings.Fields(paragraph)
+		if i == 0 {
+			words[0] = delim + words[0]
+		} else {
+			lines = append(lines, "")
+		}
+		if i == len(paragraphs)-1 {
+			words[len(words)-1] += delim
+		}
+		var line string
+		for _, word := range words {
+			if line != "" && utf8.RuneCountInString(r.Indent+line+" "+word) > width {
+				lines, line = append(lines, line), ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		lines = append(lines, line)
+	}
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = r.Indent + lines[i]
+		}
+	}
+	literal := strings.Join(lines, r.newline())
+
+	tokens := r.source.docstring
+	start, end := tokens[0].Pos.Offset, tokens[len(tokens)-1].End().Offset
+	rest := text[end:]
+	if space := strings.TrimLeft(rest, " \t\r\n"); space != "" && lineBreaks(rest[:len(rest)-len(space)]) == 1 {
+		literal += r.newline()
+	}
+	return text[:start] + literal + rest
+}
@@ -0,0 +1,187 @@
+package recipe
+
+import (
+	"testing"
+)
+
+const md5a = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+func TestFormat(t *testing.T) {
+	for n, test := range [...]struct {
+		input    string
+		style    Style
+		expected string
+	}{
+		{
+			"class A(Package):\n" +
+				"    '''Doc.'''\n\n" +
+				"    homepage = 'https://example.com'  \n" +
+				"    urls = [\n" +
+				"        'https://a',\n" +
+				"        \"https://'b'\",\n" +
+				"    ]\n\n" +
+				"    version('1.0', md5='" + md5a + "')\n" +
+				"    version('develop', branch='main')\n" +
+				"    version('1.10', md5='" + md5a + "')\n\n" +
+				"    depends_on('r-b', type=['run', 'build'])\n" +
+				"    depends_on('r-a', type=('build',))\n" +
+				"    depends_on('r@3:', type='run')\n\n" +
+				"    def install(self, spec, prefix):\n" +
+				"        msg = '''\n    keep\n'''\n" +
+				"        if spec.satisfies('+x'):  \n" +
+				"            print(r'\\d', msg)\n",
+			Style{Indent: "\t", Quote: '"'},
+			"class A(Package):\n" +
+				"\t'''Doc.'''\n\n" +
+				"\thomepage = \"https://example.com\"\n" +
+				"\turls = [\n" +
+				"\t\t\"https://a\",\n" +
+				"\t\t\"https://'b'\",\n" +
+				"\t]\n\n" +
+				"\tversion(\"develop\", branch=\"main\")\n" +
+				"\tversion(\"1.10\", md5=\"" + md5a + "\")\n" +
+				"\tversion(\"1.0\", md5=\"" + md5a + "\")\n\n" +
+				"\tdepends_on(\"r@3:\", type=\"run\")\n" +
+				"\tdepends_on(\"r-a\", type=\"build\")\n" +
+				"\tdepends_on(\"r-b\", type=(\"build\", \"run\"))\n\n" +
+				"\tdef install(self, spec, prefix):\n" +
+				"\t\tmsg = '''\n    keep\n'''\n" +
+				"\t\tif spec.satisfies(\"+x\"):\n" +
+				"\t\t\tprint(r'\\d', msg)\n",
+		},
+		{
+			"class A(Package):\n" +
+				"\t\"\"\"A short title\n\n" +
+				"\tA description that is long enough\n\tto need wrapping, which is\n" +
+				"\tdone.\n\t\"\"\"\n\n" +
+				"\tversion(\"1.0\")\n",
+			Style{Indent: "  ", Width: 30},
+			"class A(Package):\n" +
+				"  \"\"\"A short title\n\n" +
+				"  A description that is long\n  enough to need wrapping,\n" +
+				"  which is done.\"\"\"\n\n" +
+				"  version(\"1.0\")\n",
+		},
+		{
+			"class A(Package):\n\t'Doc ' \"string\"\n\tversion('1.0')\n",
+			Style{Quote: '\'', Width: 79},
+			"class A(Package):\n\t'''Doc string'''\n\n\tversion('1.0')\n",
+		},
+		{
+			"\uFEFFclass A(Package):\n\t\"\"\"Doc\\n\"\"\"\n\tversion('1.0')\n",
+			Style{Indent: "    ", Width: 79},
+			"\uFEFFclass A(Package):\n    '''Doc'''\n\n    version('1.0')\n",
+		},
+		{
+			"class A(Package):\r\n\t\"\"\"Doc\r\n\r\n\tmore\r\n\t\"\"\"\r\n\tversion(\"1.0\")\r\n",
+			Style{Indent: "    ", Width: 79},
+			"class A(Package):\r\n    \"\"\"Doc\r\n\r\n    more\"\"\"\r\n\r\n    version(\"1.0\")\r\n",
+		},
+	} {
+		r, err := parseRecipe(test.input, "a")
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+			continue
+		}
+		if err := r.Format(test.style); err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+			continue
+		}
+		if got := r.String(); got != test.expected {
+			t.Errorf("Test %d: expected:\n%s\ngot:\n%s", n+1, test.expected, got)
+		}
+	}
+}
+
+func TestFormatKeepsComments(t *testing.T) {
+	input := "# Copyright\n\n" +
+		"class A(Package):\n" +
+		"    '''Doc.'''\n\n" +
+		"    # The oldest release.\n" +
+		"    version('1.0', md5='" + md5a + "')\n" +
+		"    # The current release.\n" +
+		"    version('2.0',\n" +
+		"            md5='" + md5a + "')  # checked\n\n" +
+		"    depends_on('r-b')  # not r-a\n" +
+		"    with when('@2:'):\n" +
+		"        # Only needed since 2.0.\n" +
+		"        depends_on('r-c')\n" +
+		"    # R itself\n" +
+		"    depends_on('r@3:')\n\n" +
+		"    def install(self, spec, prefix):\n" +
+		"        # Nothing to do.\n" +
+		"        pass\n"
+	expected := "# Copyright\n\n" +
+		"class A(Package):\n" +
+		"\t\"\"\"Doc.\"\"\"\n\n" +
+		"\t# The current release.\n" +
+		"\tversion(\"2.0\", md5=\"" + md5a + "\")  # checked\n" +
+		"\t# The oldest release.\n" +
+		"\tversion(\"1.0\", md5=\"" + md5a + "\")\n\n" +
+		"\t# R itself\n" +
+		"\tdepends_on(\"r@3:\")\n" +
+		"\twith when(\"@2:\"):\n" +
+		"\t\t# Only needed since 2.0.\n" +
+		"\t\tdepends_on(\"r-c\")\n" +
+		"\tdepends_on(\"r-b\")  # not r-a\n\n" +
+		"\tdef install(self, spec, prefix):\n" +
+		"\t\t# Nothing to do.\n" +
+		"\t\tpass\n"
+	r, err := parseRecipe(input, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	style := Style{Indent: "\t", Quote: '"', Width: 79}
+	if err := r.Format(style); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.String(); got != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+	if r, err = parseRecipe(expected, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Format(style); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.String(); got != expected {
+		t.Errorf("expected formatting to be stable, got:\n%s", got)
+	}
+}
+
+func TestSortDependencies(t *testing.T) {
+	r, err := parseRecipe("class A(Package):\n"+
+		"\tdepends_on(\"r-c\")\n"+
+		"\twith when(\"@2:\"):\n"+
+		"\t\tdepends_on(\"r-b\")\n"+
+		"\t\tdepends_on(\"r@4:\")\n"+
+		"\tdepends_on(\"r-a\")\n"+
+		"\twith when(\"@2:\"):\n"+
+		"\t\tdepends_on(\"r-a\")\n"+
+		"\tdepends_on(\"r@3:\", when=\"@:1\")\n", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SortDependencies()
+	var got []string
+	for _, d := range r.Dependencies {
+		got = append(got, d.String())
+	}
+	expected := []string{
+		`depends_on("r@3:", when="@:1")`,
+		`depends_on("r@4:")`,
+		`depends_on("r-a")`,
+		`depends_on("r-c")`,
+		`depends_on("r-b")`,
+		`depends_on("r-a")`,
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("expected %q, got %q", expected, got)
+			break
+		}
+	}
+}
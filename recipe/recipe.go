@@ -2,41 +2,106 @@ package recipe
 
 import (
 	"bytes"
+	_ "embed"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"regexp"
+	"slices"
 	"strings"
 	"text/template"
 
 	"github.com/iancoleman/strcase"
 	"github.com/wtsi-hgi/uber-recipe-creator/parser"
+	"github.com/wtsi-hgi/uber-recipe-creator/spec"
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
 )
 
 type Recipe struct {
 	Name         string
+	Class        Class
 	Header       string
 	Indent       string
+	Newline      string
+	Quote        byte
 	Versions     []Version
+	Variants     []Variant
 	Dependencies []DependsOn
 	Footer       string
+	source       *source
+	warnings     parser.Diagnostics
 }
 
+// Class is the class statement of a recipe. Bases are Python source, such as
+// RPackage or spack.pkg.builtin.r_x.RX, and Docstring is the value of the
+// docstring, if there is one. Attributes are the assignments in the class body
+// outside of the directives, such as homepage = "...", in order.
+type Class struct {
+	Name       string
+	Bases      []string
+	Docstring  string
+	Attributes []Argument
+}
+
+// Version is a version(...) directive. Extra holds its checksum, URL and
+// preferred= arguments, and Args any others, in order.
 type Version struct {
 	Version string
 	Extra   map[string]string
+	Args    []Argument
+	Block   *Block
+}
+
+// Argument is a keyword argument that is kept as it is. Value is the decoded
+// value of a string, and the Python source of anything else.
+type Argument struct {
+	Name     string
+	Value    string
+	IsString bool
 }
 
+// Variant is a variant(...) directive. Default is Python source, as it can be
+// any expression, and Args holds any other arguments, in order. Values is nil
+// unless the allowed values are a literal list or tuple of strings.
+type Variant struct {
+	Name        string
+	Default     string
+	Description string
+	Values      []string
+	Multi       bool
+	When        spec.Spec
+	Args        []Argument
+	Block       *Block
+}
+
+// DependsOn is a depends_on(...) directive. Type and When are the arguments
+// it was given, with the types in Spack's order; Resolve applies those of the
+// blocks it's in. Args holds any other arguments, such as patches=.
 type DependsOn struct {
-	Spec Spec
-	Type []string
-	When string
+	Spec  spec.Spec
+	Type  []string
+	When  spec.Spec
+	Args  []Argument
+	Block *Block
 }
 
-type Spec struct {
-	Name     string
-	Version  string
-	Variants []string
+// Block is a with when(...) or with default_args(...) block, whose contexts
+// apply to the directives in its body.
+type Block struct {
+	Parent   *Block
+	Contexts []Context
+}
+
+// Context is a when(...) context manager, or a default_args(...) one if
+// DefaultArgs is set, in which case Extra holds the arguments other than
+// type= and when= as Python source.
+type Context struct {
+	DefaultArgs bool
+	When        spec.Spec
+	Type        []string
+	Extra       map[string]string
 }
 
 type Header struct {
@@ -47,11 +112,14 @@ type Header struct {
 	URLs        []string
 }
 
+// Package is a package in an upstream index. Depends holds its Depends and
+// Imports, and LinkingTo the packages whose headers it compiles against.
 type Package struct {
-	Name    string
-	Version string
-	Depends []Dependency
-	MD5sum  string
+	Name      string
+	Version   string
+	Depends   []Dependency
+	LinkingTo []Dependency
+	MD5sum    string
 }
 
 type Dependency struct {
@@ -77,14 +145,21 @@ func (v VersionRange) String() string {
 	return output
 }
 
-const headerTemplate = "header.tmpl"
+//go:embed header.tmpl
+var headerTemplate string
 
 var dependencyPattern = regexp.MustCompile(`^([^ (]+) *(\((>=|<=|>|<|==) *([^),]+)(, *(>=|<=|>|<) *([^)]+))?\))?`)
 
+var continuationPattern = regexp.MustCompile(`\n[ \t]+`)
+
+var repoPattern = regexp.MustCompile(`(?m)^[ \t]*(cran|bioc)[ \t]*=[ \t]*["']([^"']+)["']`)
+
+var basePackages = [...]string{"base", "compiler", "datasets", "graphics", "grDevices", "grid", "methods", "parallel", "splines", "stats", "stats4", "tcltk", "tools", "utils"}
+
 func New(name, repo, urlType string, urls ...string) (*Recipe, error) {
 	header := Header{PackageName: name, Repo: repo, URLs: urls, URLType: urlType}
-	header.ClassName = "R" + strcase.ToCamel(strings.ReplaceAll(name, "-", " "))
-	tmpl, err := template.New(headerTemplate).ParseFiles(headerTemplate)
+	header.ClassName = ClassName(name)
+	tmpl, err := template.New("header").Parse(headerTemplate)
 	if err != nil {
 		return nil, err
 	}
@@ -95,17 +170,40 @@ func New(name, repo, urlType string, urls ...string) (*Recipe, error) {
 	}
 	return &Recipe{
 		Name:   name,
+		Class:  Class{Name: header.ClassName, Bases: []string{"RPackage"}},
 		Header: result.String(),
 		Indent: "\t",
 	}, nil
 }
 
+// ClassName returns the name of the class of the recipe for a CRAN or
+// Bioconductor package.
+func ClassName(name string) string {
+	return "R" + strcase.ToCamel(strings.ReplaceAll(name, "-", " "))
+}
+
 func CRANDatabase() (string, error) {
-	response, err := http.Get("https://cran.r-project.org/src/contrib/PACKAGES")
+	return fetchDatabase(CRANURL)
+}
+
+// Database fetches and parses the PACKAGES index of a CRAN-like repository.
+func Database(url string) ([]Package, error) {
+	data, err := fetchDatabase(url)
+	if err != nil {
+		return nil, err
+	}
+	return parseCranDatabase(data)
+}
+
+func fetchDatabase(url string) (string, error) {
+	response, err := http.Get(url + "/PACKAGES")
 	if err != nil {
 		return "", err
 	}
 	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s/PACKAGES: %s", url, response.Status)
+	}
 	var buf strings.Builder
 	io.Copy(&buf, response.Body)
 	return buf.String(), nil
@@ -115,49 +213,93 @@ func parseCranDatabase(data string) ([]Package, error) {
 	packageList := strings.Split(data, "\n\n")
 	var packages []Package
 	for _, pkg := range packageList {
-		pkg = strings.ReplaceAll(pkg, "\n        ", " ")
+		if strings.TrimSpace(pkg) == "" {
+			continue
+		}
+		pkg = continuationPattern.ReplaceAllString(pkg, " ")
 		lines := strings.Split(pkg, "\n")
 		packageData := make(map[string]string)
 		for _, line := range lines {
 			if line == "" {
 				continue
 			}
-			parts := strings.SplitN(line, ": ", 2)
-			packageData[parts[0]] = parts[1]
+			field, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid field: %q", line)
+			}
+			packageData[field] = strings.TrimSpace(value)
 		}
 		ver := packageData["Version"]
 		deps, err := objectifyDependencies(splitString(packageData["Depends"], ", "), splitString(packageData["Imports"], ", "))
 		if err != nil {
 			return nil, err
 		}
+		linkingTo, err := objectifyDependencies(splitString(packageData["LinkingTo"], ", "))
+		if err != nil {
+			return nil, err
+		}
 		packages = append(packages, Package{
-			Name:    packageData["Package"],
-			Version: ver,
-			Depends: deps,
-			MD5sum:  packageData["MD5sum"],
+			Name:      packageData["Package"],
+			Version:   ver,
+			Depends:   deps,
+			LinkingTo: linkingTo,
+			MD5sum:    packageData["MD5sum"],
 		})
 	}
 	return packages, nil
 }
 
-func (p Package) createRecipe() (*Recipe, error) {
-	recipe, err := New(p.Name, "cran", "")
+// Recipe creates a new recipe for the current version of a package from the
+// given repository ("cran" or "bioc").
+func (p Package) Recipe(repo string) (*Recipe, error) {
+	recipe, err := New(p.Name, repo, "")
 	if err != nil {
 		return nil, err
 	}
-	recipe.Versions = append(recipe.Versions, Version{Version: p.Version})
-	for _, dep := range p.Depends {
-		ver := dep.versionToSpack()
+	version := Version{Version: p.Version}
+	if p.MD5sum != "" {
+		version.Extra = map[string]string{"md5": p.MD5sum}
+	}
+	recipe.Versions = append(recipe.Versions, version)
+	for _, dep := range p.dependencies() {
+		if comesWithR(dep.Name) {
+			continue
+		}
 		recipe.Dependencies = append(recipe.Dependencies, DependsOn{
-			Spec: Spec{Name: dep.Name, Version: ver},
-			Type: []string{"build", "run"},
+			Spec: spec.Spec{Name: dep.spackName(), Versions: dep.versions()},
+			Type: dep.Type,
 		})
 	}
 	return recipe, nil
 }
 
-func objectifyDependencies(depends, imports []string) ([]Dependency, error) {
-	stringDeps := append(depends, imports...)
+// typedDependency is a dependency with the Spack dependency types it needs.
+type typedDependency struct {
+	Dependency
+	Type []string
+}
+
+// dependencies returns the packages p depends on with their Spack dependency
+// types: build and run for Depends and Imports, and only build for LinkingTo
+// packages that aren't also imported.
+func (p Package) dependencies() []typedDependency {
+	var deps []typedDependency
+	for _, dep := range p.Depends {
+		deps = append(deps, typedDependency{dep, []string{"build", "run"}})
+	}
+	for _, dep := range p.LinkingTo {
+		if !slices.ContainsFunc(p.Depends, func(d Dependency) bool { return d.Name == dep.Name }) {
+			deps = append(deps, typedDependency{dep, []string{"build"}})
+		}
+	}
+	return deps
+}
+
+func objectifyDependencies(fields ...[]string) ([]Dependency, error) {
+	var stringDeps []string
+	for _, field := range fields {
+		stringDeps = append(stringDeps, field...)
+	}
 	if len(stringDeps) == 0 {
 		return nil, nil
 	}
@@ -175,6 +317,12 @@ func objectifyDependencies(depends, imports []string) ([]Dependency, error) {
 		if matches[6] != "" {
 			dep.setDepVersion(matches[6], matches[7])
 		}
+		if i := slices.IndexFunc(deps, func(d Dependency) bool { return d.Name == dep.Name }); i >= 0 {
+			if deps[i].Version == (VersionRange{}) {
+				deps[i].Version = dep.Version
+			}
+			continue
+		}
 		deps = append(deps, dep)
 	}
 	return deps, nil
@@ -224,80 +372,394 @@ func splitString(s, sep string) []string {
 	return parts
 }
 
-func (d Dependency) versionToSpack() string {
-	if d.Version.Min != "" && d.Version.Max != "" {
-		return fmt.Sprintf("@%s:%s", d.Version.Min, d.Version.Max)
-	} else if d.Version.Min != "" {
-		return fmt.Sprintf("@%s:", d.Version.Min)
-	} else if d.Version.Max != "" {
-		return fmt.Sprintf("@:%s", d.Version.Max)
+func (d Dependency) spackName() string {
+	return SpackName(d.Name)
+}
+
+// SpackName converts a CRAN or Bioconductor package name to the name of its
+// Spack recipe.
+func SpackName(name string) string {
+	if name == "R" {
+		return "r"
 	}
-	return ""
+	return "r-" + strings.ToLower(strings.ReplaceAll(name, ".", "-"))
 }
 
-// func parseRecipeFile(r io.Reader) (Recipe, error) {
-// 	var recipeBytes []byte
-// 	r.Read(recipeBytes)
-// 	return parseRecipe(string(recipeBytes))
-// }
+// IsBasePackage reports whether name is R or one of the packages that come
+// with it, which are provided by the r recipe rather than recipes of their
+// own.
+func IsBasePackage(name string) bool {
+	return name == "R" || comesWithR(name)
+}
 
-func parseRecipe(r, name string) (Recipe, error) {
-	var recipe Recipe
-	recipeData, err := parser.DoParse(r)
+// comesWithR reports whether name is one of the packages that come with R.
+// Unlike R itself, which recipes depend on as r, these aren't depended on.
+func comesWithR(name string) bool {
+	return slices.Contains(basePackages[:], name)
+}
+
+func (d Dependency) versions() spec.VersionList {
+	if d.Version.Min == "" && d.Version.Max == "" {
+		return nil
+	}
+	return spec.VersionList{{Lo: d.Version.Min, Hi: d.Version.Max, IsRange: true}}
+}
+
+// ParseFile reads a package.py, naming the recipe after its cran or bioc
+// attribute.
+func ParseFile(path string) (Recipe, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return Recipe{}, err
 	}
+	recipe, err := parseRecipe(string(data), "")
+	var parseErr *ParseError
+	var posErr *tokeniser.Error
+	if errors.As(err, &parseErr) {
+		parseErr.Path = path
+		return Recipe{}, parseErr
+	} else if errors.As(err, &posErr) {
+		return Recipe{}, fmt.Errorf("%s:%w", path, err)
+	} else if err != nil {
+		return Recipe{}, fmt.Errorf("%s: %w", path, err)
+	}
+	_, recipe.Name = recipe.Repo()
+	return recipe, nil
+}
+
+// Repo returns the repository ("cran" or "bioc") and upstream package name
+// declared in the recipe header, or empty strings if there are none.
+func (r Recipe) Repo() (string, string) {
+	matches := repoPattern.FindStringSubmatch(r.Header)
+	if matches == nil {
+		return "", ""
+	}
+	return matches[1], matches[2]
+}
+
+// Warnings returns the problems found when parsing the recipe that didn't stop
+// it being parsed, such as invalid checksums.
+func (r Recipe) Warnings() parser.Diagnostics {
+	return r.warnings
+}
+
+// Positions are where the class and the versions, variants and dependencies
+// of a recipe are in the file it was parsed from, with the directives in the
+// recipe's order. Those that weren't parsed have the zero position.
+type Positions struct {
+	Class        tokeniser.Position
+	Versions     []tokeniser.Position
+	Variants     []tokeniser.Position
+	Dependencies []tokeniser.Position
+}
+
+// Positions returns where the parts of the recipe were parsed from. A
+// directive that has changed since has the position of the one it replaces.
+func (r Recipe) Positions() Positions {
+	p := Positions{
+		Versions:     make([]tokeniser.Position, len(r.Versions)),
+		Variants:     make([]tokeniser.Position, len(r.Variants)),
+		Dependencies: make([]tokeniser.Position, len(r.Dependencies)),
+	}
+	if r.source == nil {
+		return p
+	}
+	p.Class = r.source.class.Pos()
+	origins := r.edits().origins
+	for kind, positions := range [...][]tokeniser.Position{p.Versions, p.Variants, p.Dependencies} {
+		for i, o := range origins[kind] {
+			if o != nil {
+				positions[i] = o.directive().Pos()
+			}
+		}
+	}
+	return p
+}
+
+// ParseError is returned for a recipe that has syntax errors, with every
+// problem the parser found in it. Its message has a line for each error,
+// prefixed with Path if it's set.
+type ParseError struct {
+	Path        string
+	Diagnostics parser.Diagnostics
+}
+
+func (e *ParseError) Error() string {
+	var lines []string
+	for _, d := range e.Diagnostics {
+		if d.Severity != parser.SeverityError {
+			continue
+		}
+		line := (&tokeniser.Error{Pos: d.Pos, Msg: d.Msg}).Error()
+		if e.Path != "" {
+			line = e.Path + ":" + line
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the first error.
+func (e *ParseError) Unwrap() error {
+	return e.Diagnostics.Err()
+}
+
+func parseRecipe(r, name string) (Recipe, error) {
+	var recipe Recipe
+	recipeData, diagnostics := parser.Parse(r)
+	if diagnostics.Err() != nil {
+		return Recipe{}, &ParseError{Diagnostics: diagnostics}
+	}
+	var err error
+	recipe.warnings = diagnostics
 	recipe.Name = name
 	recipe.Header = recipeData.Header
+	if strings.HasPrefix(r, "\uFEFF") {
+		recipe.Header = "\uFEFF" + recipe.Header
+	}
 	recipe.Indent = recipeData.Indent
+	recipe.Newline = lineEnding(r)
+	recipe.Footer = recipeData.Footer
+	recipe.Quote = quoteStyle(recipeData)
+	if c := recipeData.Class; c != nil {
+		recipe.Class.Name = c.Name.Val
+		for _, base := range c.Bases {
+			recipe.Class.Bases = append(recipe.Class.Bases, parser.Format(base))
+		}
+		for _, token := range c.Docstring {
+			recipe.Class.Docstring += unquote(token)
+		}
+		for _, attr := range c.Attributes {
+			recipe.Class.Attributes = append(recipe.Class.Attributes, newArgument(attr))
+		}
+	}
+	blocks := blockConverter{}
 	for _, v := range recipeData.Versions {
 		version := Version{
-			Version: v.Version.Val,
-			Extra: map[string]string{
-				v.HashType.Val: v.Hash.Val,
-			},
+			Version: unquote(v.Version),
+			Extra:   map[string]string{},
+		}
+		if v.HashType.Val != "" {
+			version.Extra[v.HashType.Val] = unquote(v.Hash)
+		}
+		for _, ref := range [...]struct {
+			name  string
+			token *tokeniser.Token
+		}{{"tag", v.Tag}, {"branch", v.Branch}, {"commit", v.Commit}} {
+			if ref.token != nil {
+				version.Extra[ref.name] = unquote(*ref.token)
+			}
 		}
 		if v.URLType != nil {
-			version.Extra[v.URLType.Val] = v.URL.Val
+			version.Extra[v.URLType.Val] = unquote(*v.URL)
 		}
 		if v.Preferred != nil {
 			version.Extra["preferred"] = v.Preferred.Val
 		}
+		for _, arg := range v.Args {
+			version.Args = append(version.Args, newArgument(arg))
+		}
+		if version.Block, err = blocks.convert(v.Block); err != nil {
+			return Recipe{}, err
+		}
 		recipe.Versions = append(recipe.Versions, version)
 	}
+	for _, v := range recipeData.Variants {
+		variant, err := newVariant(v)
+		if err != nil {
+			return Recipe{}, err
+		}
+		if variant.Block, err = blocks.convert(v.Block); err != nil {
+			return Recipe{}, err
+		}
+		recipe.Variants = append(recipe.Variants, variant)
+	}
 	for _, d := range recipeData.Depends {
-		spec := strings.Split(d.Spec.Val, "@")
-		var name, version string
-		if len(spec) > 2 {
-			return Recipe{}, fmt.Errorf("invalid spec: %q", d.Spec.Val)
-		} else if len(spec) > 1 {
-			name = spec[0]
-			version = "@" + spec[1]
-		} else {
-			name = spec[0]
-			version = ""
-		}
-		depends := DependsOn{
-			Spec: Spec{
-				Name:    name,
-				Version: version,
-			},
-		}
-		var types []string
-
-		for _, t := range d.Type {
-			types = append(types, t.Val)
-		}
-		depends.Type = types
+		depends := DependsOn{}
+		if depends.Spec, err = parseSpec(d.Spec); err != nil {
+			return Recipe{}, err
+		}
 		if d.When != nil {
-			depends.When = d.When.Val
+			if depends.When, err = parseSpec(*d.When); err != nil {
+				return Recipe{}, err
+			}
+		}
+		depends.Type = dependencyTypes(d.Type)
+		for _, arg := range d.Args {
+			depends.Args = append(depends.Args, newArgument(arg))
+		}
+		if depends.Block, err = blocks.convert(d.Block); err != nil {
+			return Recipe{}, err
 		}
 		recipe.Dependencies = append(recipe.Dependencies, depends)
 	}
+	recipe.source = newSource(recipeData, recipe, blocks)
+	if recipe.source != nil {
+		recipe.source.bom = strings.HasPrefix(r, "\uFEFF")
+	}
 	return recipe, nil
 }
 
-func (r *Recipe) checkIfUpdateNecessary(ps []Package) {
+// unquote returns the value of a string token that the parser has already
+// checked.
+func unquote(token tokeniser.Token) string {
+	s, _ := tokeniser.Unquote(token.Val)
+	return s
+}
+
+func newVariant(v parser.Variant) (Variant, error) {
+	variant := Variant{
+		Name:    unquote(v.Name),
+		Default: pythonSource(v.Default),
+	}
+	for _, d := range v.Description {
+		variant.Description += unquote(d)
+	}
+	for _, value := range v.Values {
+		variant.Values = append(variant.Values, unquote(value))
+	}
+	variant.Multi = v.Multi != nil && v.Multi.Val == "True"
+	if v.When != nil {
+		var err error
+		if variant.When, err = parseSpec(*v.When); err != nil {
+			return Variant{}, err
+		}
+	}
+	for _, arg := range v.Extra {
+		variant.Args = append(variant.Args, Argument{Name: arg.Keyword.Val, Value: pythonSource(arg.Value)})
+	}
+	return variant, nil
+}
+
+// newArgument converts a keyword argument, decoding its value if it is made of
+// string literals that have one.
+func newArgument(arg parser.KeywordArgument) Argument {
+	a := Argument{Name: arg.Keyword.Val, Value: parser.Format(arg.Value)}
+	s, ok := arg.Value.(*parser.String)
+	if !ok {
+		return a
+	}
+	var value string
+	for _, token := range s.Tokens {
+		v, err := tokeniser.Unquote(token.Val)
+		if err != nil {
+			return a
+		}
+		value += v
+	}
+	a.Value, a.IsString = value, true
+	return a
+}
+
+// dependencyTypes returns the values of the type tokens, which the parser has
+// checked are valid and distinct, in the same order as Spack.
+func dependencyTypes(tokens []tokeniser.Token) []string {
+	var types []string
+	for _, t := range parser.DependencyTypes {
+		if slices.ContainsFunc(tokens, func(token tokeniser.Token) bool { return unquote(token) == t }) {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// blockConverter converts the parser's blocks, so that directives in the same
+// block share it.
+type blockConverter map[*parser.Block]*Block
+
+func (bc blockConverter) convert(b *parser.Block) (*Block, error) {
+	if b == nil {
+		return nil, nil
+	} else if block, ok := bc[b]; ok {
+		return block, nil
+	}
+	parent, err := bc.convert(b.Parent)
+	if err != nil {
+		return nil, err
+	}
+	block := &Block{Parent: parent}
+	for _, c := range b.Contexts {
+		context := Context{DefaultArgs: c.Name.Val == "default_args"}
+		if c.When != nil {
+			if context.When, err = parseSpec(*c.When); err != nil {
+				return nil, err
+			}
+		}
+		context.Type = dependencyTypes(c.Type)
+		for _, arg := range c.Extra {
+			if context.Extra == nil {
+				context.Extra = make(map[string]string)
+			}
+			context.Extra[arg.Keyword.Val] = pythonSource(arg.Value)
+		}
+		block.Contexts = append(block.Contexts, context)
+	}
+	bc[b] = block
+	return block, nil
+}
+
+// pythonSource joins the tokens of an expression onto a single line.
+func pythonSource(tokens []tokeniser.Token) string {
+	var sb strings.Builder
+	for i, token := range tokens {
+		if token.Type != tokeniser.TokenWhitespace || !strings.ContainsAny(token.Val, "\r\n") {
+			sb.WriteString(token.Val)
+			continue
+		}
+		var prev, next string
+		if i > 0 {
+			prev = tokens[i-1].Val
+		}
+		if i+1 < len(tokens) {
+			next = tokens[i+1].Val
+		}
+		if prev != "" && next != "" && !strings.Contains("([{", prev) && !strings.Contains(")]},", next) {
+			sb.WriteByte(' ')
+		}
+	}
+	return sb.String()
+}
+
+// parseSpec parses a string token holding a spec, reporting errors at the
+// token's position.
+func parseSpec(token tokeniser.Token) (spec.Spec, error) {
+	s, err := spec.Parse(unquote(token))
+	if err != nil {
+		return spec.Spec{}, &tokeniser.Error{Pos: token.Pos, Msg: "invalid spec: " + err.Error()}
+	}
+	return s, nil
+}
+
+// quoteStyle returns the quote character used by the first version or
+// depends_on directive, so that rendered directives match.
+func quoteStyle(r *parser.Recipe) byte {
+	var token tokeniser.Token
+	if len(r.Versions) > 0 {
+		token = r.Versions[0].Version
+	} else if len(r.Depends) > 0 {
+		token = r.Depends[0].Spec
+	}
+	if i := strings.IndexAny(token.Val, "\"'"); i >= 0 {
+		return token.Val[i]
+	}
+	return '"'
+}
+
+// lineEnding returns the style of the first line ending in s.
+func lineEnding(s string) string {
+	i := strings.IndexAny(s, "\r\n")
+	switch {
+	case i < 0 || s[i] == '\n':
+		return "\n"
+	case strings.HasPrefix(s[i:], "\r\n"):
+		return "\r\n"
+	}
+	return "\r"
+}
+
+// Update adds the latest version of the recipe's package in ps if the recipe
+// doesn't already have it, reporting whether anything changed.
+func (r *Recipe) Update(ps []Package) bool {
 	var pkg Package
 	for _, p := range ps {
 		if p.Name == r.Name {
@@ -306,35 +768,42 @@ func (r *Recipe) checkIfUpdateNecessary(ps []Package) {
 		}
 	}
 	if pkg.Name == "" {
-		return
+		return false
 	}
 	for _, v := range r.Versions {
 		if v.Version == pkg.Version {
-			return
+			return false
 		}
 	}
 	r.updateRecipe(pkg)
+	return true
 }
 
 func (r *Recipe) updateRecipe(p Package) {
-	// TODO: this should add the missing latest version to the recipe,
-	// and configure the dependencies if they've changed.
+	var previous string
+	if len(r.Versions) > 0 {
+		previous = r.Versions[0].Version
+	}
 
-	r.Versions = append(r.Versions, Version{
+	r.Versions = append([]Version{{
 		Version: p.Version,
 		Extra: map[string]string{
 			"md5": p.MD5sum,
 		},
-	})
+	}}, r.Versions...)
 
-	for _, dep := range p.Depends {
+	for _, dep := range p.dependencies() {
+		if comesWithR(dep.Name) {
+			continue
+		}
 		var skip bool
 		var change bool
 		var dependencyIndex int
-		ver := dep.versionToSpack()
+		name := dep.spackName()
+		ver := dep.versions()
 		for i, d := range r.Dependencies {
-			if d.Spec.Name == dep.Name {
-				if d.Spec.Version == ver {
+			if d.Spec.Name == name {
+				if d.Spec.Versions.String() == ver.String() {
 					skip = true
 					break
 				} else { // TODO: if change is false or if the version is newer
@@ -345,26 +814,29 @@ func (r *Recipe) updateRecipe(p Package) {
 		}
 		if skip {
 			continue
+		} else if change && previous == "" {
+			r.Dependencies[dependencyIndex].Spec = spec.Spec{Name: name, Versions: ver}
+			continue
 		} else if change {
-			r.updateDependency(dependencyIndex, p.Version)
+			r.updateDependency(dependencyIndex, previous)
 		}
 
-		r.Dependencies = append(r.Dependencies, DependsOn{
-			Spec: Spec{Name: dep.Name, Version: ver},
-			Type: []string{"build", "run"},
-			When: fmt.Sprintf("@%s:", p.Version),
+		r.addDependency(DependsOn{
+			Spec: spec.Spec{Name: name, Versions: ver},
+			Type: dep.Type,
+			When: spec.Spec{Versions: spec.VersionList{{Lo: p.Version, IsRange: true}}},
 		})
 	}
 }
 
+// updateDependency limits a dependency to versions of the package up to the
+// given one.
 func (r *Recipe) updateDependency(i int, version string) {
-	// TODO: make sure that this code is logically sound
 	d := &r.Dependencies[i]
-	if d.When == "" {
-		d.When = "@:" + version
-		return
-	} else if strings.HasPrefix(d.When, "@:") {
-		d.When = d.When + " @:" + version
-		return
+	upTo := spec.VersionList{{Hi: version, IsRange: true}}
+	if len(d.When.Versions) == 0 {
+		d.When.Versions = upTo
+	} else if versions := d.When.Versions.Intersect(upTo); versions != nil {
+		d.When.Versions = versions
 	}
 }
@@ -1,10 +1,17 @@
 package recipe
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+	"github.com/wtsi-hgi/uber-recipe-creator/parser"
+	"github.com/wtsi-hgi/uber-recipe-creator/spec"
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
 )
 
 func TestRecipe(t *testing.T) {
@@ -232,7 +239,7 @@ func TestVersionSplit(t *testing.T) {
 	}
 }
 
-func TestCreateRecipe(t *testing.T) {
+func TestPackageRecipe(t *testing.T) {
 	p := Package{
 		Name:    "A3",
 		Version: "1.0-56",
@@ -249,15 +256,21 @@ func TestCreateRecipe(t *testing.T) {
 				Name:    "pbapply",
 				Version: VersionRange{Min: "", Max: "48.1"},
 			},
+			{
+				Name: "methods",
+			},
 		},
-		MD5sum: "027ebdd8affce8f0effaecfcd5f5ade2",
+		LinkingTo: []Dependency{{Name: "xtable"}, {Name: "Rcpp"}},
+		MD5sum:    "027ebdd8affce8f0effaecfcd5f5ade2",
 	}
-	r, err := p.createRecipe()
+	r, err := p.Recipe("cran")
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	expected := &Recipe{
+		Name:  "A3",
+		Class: Class{Name: "RA3", Bases: []string{"RPackage"}},
 		Header: `# Copyright 2013-2023 Lawrence Livermore National Security, LLC and other
 # Spack Project Developers. See the top-level COPYRIGHT file for details.
 #
@@ -267,47 +280,38 @@ from spack.package import *
 
 
 class RA3(RPackage):
-	
 	cran = "A3"`,
 		Indent: "\t",
 		Versions: []Version{
 			{
 				Version: "1.0-56",
-				Extra:   map[string]string(nil),
+				Extra:   map[string]string{"md5": "027ebdd8affce8f0effaecfcd5f5ade2"},
 			},
 		},
 		Dependencies: []DependsOn{
 			{
-				Spec: Spec{
-					Name:     "R",
-					Version:  "@2.15.0:5.0.0",
-					Variants: []string(nil),
-				},
+				Spec: spec.Spec{Name: "r", Versions: spec.VersionList{{Lo: "2.15.0", Hi: "5.0.0", IsRange: true}}},
 				Type: []string{"build", "run"},
-				When: "",
 			},
 			{
-				Spec: Spec{
-					Name:     "xtable",
-					Version:  "@0.7.5:",
-					Variants: []string(nil),
-				},
+				Spec: spec.Spec{Name: "r-xtable", Versions: spec.VersionList{{Lo: "0.7.5", IsRange: true}}},
 				Type: []string{"build", "run"},
-				When: "",
 			},
 			{
-				Spec: Spec{
-					Name:     "pbapply",
-					Version:  "@:48.1",
-					Variants: []string(nil),
-				},
+				Spec: spec.Spec{Name: "r-pbapply", Versions: spec.VersionList{{Hi: "48.1", IsRange: true}}},
 				Type: []string{"build", "run"},
-				When: "",
+			},
+			{
+				Spec: spec.Spec{Name: "r-rcpp"},
+				Type: []string{"build"},
 			},
 		},
 		Footer: "",
 	}
 	if !reflect.DeepEqual(r, expected) {
+		if !reflect.DeepEqual(r.Class, expected.Class) {
+			t.Fatalf("Class incorrect, expected %+v, got %+v", expected.Class, r.Class)
+		}
 		if r.Header != expected.Header {
 			t.Fatalf("Header incorrect, expected %q, got %q", expected.Header, r.Header)
 		}
@@ -324,8 +328,8 @@ class RA3(RPackage):
 		if r.Footer != expected.Footer {
 			t.Fatalf("Footer incorrect, expected %q, got %q", expected.Footer, r.Footer)
 		}
+		t.Fatalf("Recipe incorrect, expected %+v, got %+v", expected, r)
 	}
-
 }
 
 func TestReadRecipe(t *testing.T) {
@@ -337,6 +341,16 @@ func TestReadRecipe(t *testing.T) {
 
 	expected := Recipe{
 		Name: "abcrf",
+		Class: Class{
+			Name:  "RAbcrf",
+			Bases: []string{"RPackage"},
+			Docstring: "Approximate Bayesian Computation via Random Forests\n\n" +
+				"\tPerforms Approximate Bayesian Computation (ABC) model choice and parameter inference via random forests.\n" +
+				"  Pudlo P., Marin J.-M., Estoup A., Cornuet J.-M., Gautier M. and Robert C. P. (2016) <doi:10.1093/bioinformatics/btv684>.\n" +
+				"  Estoup A., Raynal L., Verdu P. and Marin J.-M. <http://journal-sfds.fr/article/view/709>.\n" +
+				"  Raynal L., Marin J.-M., Pudlo P., Ribatet M., Robert C. P. and Estoup A. (2019) <doi:10.1093/bioinformatics/bty867>.\n\t",
+			Attributes: []Argument{{Name: "cran", Value: "abcrf", IsString: true}},
+		},
 		Header: `# Copyright 2013-2023 Lawrence Livermore National Security, LLC and other
 # Spack Project Developers. See the top-level COPYRIGHT file for details.
 #
@@ -355,141 +369,96 @@ class RAbcrf(RPackage):
 	"""
 	
 	cran = "abcrf" `,
-		Indent: "\t",
+		Indent:  "\t",
+		Newline: "\n",
+		Quote:   '"',
 		Versions: []Version{
 			{
-				Version: "\"1.9\"",
+				Version: "1.9",
 				Extra: map[string]string{
-					"md5": "\"506f4cc36ae9d66bd174f4b65f8c3bb2\"",
+					"md5": "506f4cc36ae9d66bd174f4b65f8c3bb2",
 				},
 			},
 		},
 		Dependencies: []DependsOn{
 			{
-				Spec: Spec{
-					Name:     "\"r",
-					Version:  "@3.1:\"",
-					Variants: []string(nil),
-				},
+				Spec: spec.Spec{Name: "r", Versions: spec.VersionList{{Lo: "3.1", IsRange: true}}},
 				Type: []string{
-					"\"build\"",
-					"\"run\"",
+					"build",
+					"run",
 				},
-				When: "",
 			},
 			{
-				Spec: Spec{
-					Name:     "\"r-readr\"",
-					Version:  "",
-					Variants: []string(nil),
-				},
+				Spec: spec.Spec{Name: "r-readr"},
 				Type: []string{
-					"\"build\"",
-					"\"run\"",
+					"build",
+					"run",
 				},
-				When: "",
 			},
 			{
-				Spec: Spec{
-					Name:     "\"r-mass\"",
-					Version:  "",
-					Variants: []string(nil),
-				},
+				Spec: spec.Spec{Name: "r-mass"},
 				Type: []string{
-					"\"build\"",
-					"\"run\"",
+					"build",
+					"run",
 				},
-				When: "",
 			},
 			{
-				Spec: Spec{
-					Name:     "\"r-matrixstats\"",
-					Version:  "",
-					Variants: []string(nil),
-				},
+				Spec: spec.Spec{Name: "r-matrixstats"},
 				Type: []string{
-					"\"build\"",
-					"\"run\"",
+					"build",
+					"run",
 				},
-				When: "",
 			},
 			{
-				Spec: Spec{
-					Name:     "\"r-ranger\"",
-					Version:  "",
-					Variants: []string(nil),
-				},
+				Spec: spec.Spec{Name: "r-ranger"},
 				Type: []string{
-					"\"build\"",
-					"\"run\"",
+					"build",
+					"run",
 				},
-				When: "",
 			},
 			{
-				Spec: Spec{
-					Name:     "\"r-doparallel\"",
-					Version:  "",
-					Variants: []string(nil),
-				},
+				Spec: spec.Spec{Name: "r-doparallel"},
 				Type: []string{
-					"\"build\"",
-					"\"run\"",
+					"build",
+					"run",
 				},
-				When: "",
 			},
 			{
-				Spec: Spec{
-					Name:     "\"r-foreach\"",
-					Version:  "",
-					Variants: []string(nil),
-				},
+				Spec: spec.Spec{Name: "r-foreach"},
 				Type: []string{
-					"\"build\"",
-					"\"run\"",
+					"build",
+					"run",
 				},
-				When: "",
 			},
 			{
-				Spec: Spec{
-					Name:     "\"r-stringr\"",
-					Version:  "",
-					Variants: []string(nil),
-				},
+				Spec: spec.Spec{Name: "r-stringr"},
 				Type: []string{
-					"\"build\"",
-					"\"run\"",
+					"build",
+					"run",
 				},
-				When: "",
 			},
 			{
-				Spec: Spec{
-					Name:     "\"r-rcpp\"",
-					Version:  "",
-					Variants: []string(nil),
-				},
+				Spec: spec.Spec{Name: "r-rcpp"},
 				Type: []string{
-					"\"build\"",
-					"\"run\"",
+					"build",
+					"run",
 				},
-				When: "",
 			},
 			{
-				Spec: Spec{
-					Name:     "\"r-rcpparmadillo\"",
-					Version:  "",
-					Variants: []string(nil),
-				},
+				Spec: spec.Spec{Name: "r-rcpparmadillo"},
 				Type: []string{
-					"\"build\"",
-					"\"run\"",
+					"build",
+					"run",
 				},
-				When: "",
 			},
 		},
 		Footer: "",
 	}
 
 	if !reflect.DeepEqual(parsed, expected) {
+		if !reflect.DeepEqual(parsed.Class, expected.Class) {
+			t.Fatalf("Class incorrect, expected %+v, got %+v", expected.Class, parsed.Class)
+		}
 		if parsed.Header != expected.Header {
 			t.Fatalf("Header incorrect, expected %q, got %q", expected.Header, parsed.Header)
 		}
@@ -511,3 +480,83 @@ class RAbcrf(RPackage):
 		}
 	}
 }
+
+func TestIsBasePackage(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"R":       true,
+		"methods": true,
+		"stats4":  true,
+		"Rcpp":    false,
+		"r":       false,
+	} {
+		if got := IsBasePackage(name); got != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, got)
+		}
+		if got := comesWithR(name); got != (expected && name != "R") {
+			t.Errorf("%s: expected comesWithR to be %v, got %v", name, !got, got)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	r, err := parseRecipe("from spack.package import *\n\n"+
+		"class RA(RPackage):\n"+
+		"\tversion(\"1.0\", md5=\""+strings.Repeat("a", 32)+"\")\n"+
+		"\tversion(\"2.0\", md5=\""+strings.Repeat("b", 32)+"\")\n\n"+
+		"\twith default_args(type=\"run\"):\n"+
+		"\t\tdepends_on(\"r-b\")\n", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Versions[1].Extra = map[string]string{"md5": "c"}
+	r.Versions = append([]Version{{Version: "3.0"}}, r.Versions...)
+	r.Dependencies = append(r.Dependencies, DependsOn{Spec: spec.Spec{Name: "r-c"}})
+
+	expected := Positions{
+		Class: tokeniser.Position{Offset: 29, Line: 3, Column: 1},
+		Versions: []tokeniser.Position{
+			{},
+			{Offset: 50, Line: 4, Column: 2},
+			{Offset: 106, Line: 5, Column: 2},
+		},
+		Variants: []tokeniser.Position{},
+		Dependencies: []tokeniser.Position{
+			{Offset: 196, Line: 8, Column: 3},
+			{},
+		},
+	}
+	if got := r.Positions(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected positions %+v, got %+v", expected, got)
+	}
+	if got := (Recipe{Versions: r.Versions}).Positions(); got.Class.Line != 0 || len(got.Versions) != 3 || got.Versions[0].Line != 0 {
+		t.Errorf("expected zero positions for a recipe that wasn't parsed, got %+v", got)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "package.py")
+	input := "class A(RPackage):\n" +
+		"\tversion(\"1.0\" md5=\"" + strings.Repeat("a", 32) + "\")\n" +
+		"\tversion(\"2.0\", commit=\"abc1234\")\n" +
+		"\tdepends_on(\"r-b\", type=\"rnu\")\n"
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ParseFile(path)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a ParseError, got %v", err)
+	}
+	if len(parseErr.Diagnostics) != 3 || parseErr.Diagnostics[1].Severity != parser.SeverityWarning {
+		t.Errorf("expected two errors and a warning, got %v", parseErr.Diagnostics)
+	}
+	expected := path + ":2:16: failed to parse version: expected ','\n" +
+		path + ":4:25: failed to parse depends_on: invalid dependency type \"rnu\""
+	if err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+	var posErr *tokeniser.Error
+	if !errors.As(err, &posErr) || posErr.Pos.Line != 2 {
+		t.Errorf("expected the first error, got %v", posErr)
+	}
+}
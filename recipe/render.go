@@ -0,0 +1,790 @@
+package recipe
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/parser"
+	"github.com/wtsi-hgi/uber-recipe-creator/tokeniser"
+)
+
+var hashTypes = [...]string{"sha256", "sha512", "sha384", "sha224", "sha1", "md5", "tag", "branch", "commit"}
+
+var urlTypes = [...]string{"url", "git", "svn", "hg", "cvs"}
+
+// String renders the recipe as a Spack package.py, using the recipe's line
+// ending and quoting style. A parsed recipe is printed from its syntax tree,
+// in which only the directives that have changed are rendered anew; others are
+// laid out with the directives grouped by kind between Header and Footer.
+func (r Recipe) String() string {
+	if r.source != nil {
+		return r.render()
+	}
+	newline := r.newline()
+	var sb strings.Builder
+	sb.WriteString(r.Header)
+	for _, ds := range r.directives(0) {
+		if len(ds) > 0 {
+			sb.WriteString(newline + newline + r.Indent)
+			r.writeDirectives(&sb, r.Indent, nil, ds)
+		}
+	}
+	sb.WriteString(r.Footer)
+	sb.WriteString(newline)
+	return sb.String()
+}
+
+func (r Recipe) newline() string {
+	if r.Newline == "" {
+		return "\n"
+	}
+	return r.Newline
+}
+
+func (r Recipe) quote() byte {
+	if r.Quote == 0 {
+		return '"'
+	}
+	return r.Quote
+}
+
+// directive is a version, variant or dependency as the recipe renders it.
+// Text is how it was rendered in another quoting style, to compare it with
+// the directives the recipe was parsed from, and index is its place among
+// those of its kind.
+type directive struct {
+	line  string
+	text  string
+	block *Block
+	index int
+}
+
+// directives returns the versions, variants and dependencies, in that order,
+// also rendering them in the given quoting style if it isn't zero.
+func (r Recipe) directives(quote byte) [3][]directive {
+	var ds [3][]directive
+	add := func(kind int, block *Block, format func(byte) string) {
+		d := directive{line: format(r.quote()), block: block, index: len(ds[kind])}
+		if quote != 0 {
+			d.text = format(quote)
+		}
+		ds[kind] = append(ds[kind], d)
+	}
+	for _, v := range r.Versions {
+		add(0, v.Block, v.format)
+	}
+	for _, v := range r.Variants {
+		add(1, v.Block, v.format)
+	}
+	for _, d := range r.Dependencies {
+		add(2, d.Block, d.format)
+	}
+	return ds
+}
+
+// writeDirectives writes directives on consecutive lines, opening the with
+// statements of the blocks they're in beyond base. The first line is written
+// as it is, and the others after a newline and indent, which is that of base.
+func (r Recipe) writeDirectives(sb *strings.Builder, indent string, base *Block, ds []directive) {
+	open := base.chain()
+	depth := len(open)
+	for i, d := range ds {
+		chain := d.block.chain()
+		same := depth
+		for same < len(open) && same < len(chain) && open[same] == chain[same] {
+			same++
+		}
+		var lines []string
+		for _, b := range chain[same:] {
+			lines = append(lines, strings.Repeat(r.Indent, len(lines)+same-depth)+b.format(r.quote()))
+		}
+		lines = append(lines, strings.Repeat(r.Indent, len(chain)-depth)+d.line)
+		for j, line := range lines {
+			if i > 0 || j > 0 {
+				sb.WriteString(r.newline() + indent)
+			}
+			sb.WriteString(line)
+		}
+		open = chain
+	}
+}
+
+// source is the syntax tree a recipe was parsed from, along with the
+// versions, variants and dependencies as they were parsed, so that rendering
+// can tell which have changed. Once the recipe has been restyled by Format,
+// every directive is rendered anew, even those that haven't changed, unless
+// it has comments inside its call. Docstring holds the string literals of the
+// class's docstring.
+type source struct {
+	file       *parser.File
+	bom        bool
+	restyled   bool
+	quote      byte
+	docstring  []tokeniser.Token
+	directives [3][]*original
+	units      map[parser.Node]*original
+	blocks     map[*Block]*parser.Compound
+	class      *parser.Compound
+}
+
+// original is a directive as it was parsed: its statement, after the comments
+// directly above it, and how it was rendered then.
+type original struct {
+	nodes []parser.Node
+	text  string
+	block *Block
+}
+
+func (o *original) directive() *parser.Directive {
+	return o.nodes[len(o.nodes)-1].(*parser.Directive)
+}
+
+// newSource keeps the syntax tree of a parsed recipe, returning nil if it has
+// no class or a directive has no statement, as it can't then be printed.
+func newSource(data *parser.Recipe, r Recipe, blocks blockConverter) *source {
+	if data.Class == nil {
+		return nil
+	}
+	s := &source{
+		file:      data.File,
+		quote:     r.quote(),
+		units:     make(map[parser.Node]*original),
+		blocks:    make(map[*Block]*parser.Compound),
+		class:     data.Class.Node,
+		docstring: data.Class.Docstring,
+	}
+	var nodes [3][]*parser.Directive
+	for _, v := range data.Versions {
+		nodes[0] = append(nodes[0], v.Node)
+	}
+	for _, v := range data.Variants {
+		nodes[1] = append(nodes[1], v.Node)
+	}
+	for _, d := range data.Depends {
+		nodes[2] = append(nodes[2], d.Node)
+	}
+	comments := attachedComments(data.File)
+	for kind, ds := range r.directives(0) {
+		for i, d := range ds {
+			node := nodes[kind][i]
+			if node == nil {
+				return nil
+			}
+			o := &original{nodes: append(slices.Clone(comments[node]), node), text: d.line, block: d.block}
+			s.directives[kind] = append(s.directives[kind], o)
+			s.units[o.nodes[0]] = o
+		}
+	}
+	for b, block := range blocks {
+		s.blocks[block] = b.Node
+	}
+	return s
+}
+
+// attachedComments returns the comments directly above each directive, with
+// no blank line between them.
+func attachedComments(file *parser.File) map[*parser.Directive][]parser.Node {
+	attached := make(map[*parser.Directive][]parser.Node)
+	parser.Inspect(file, func(node parser.Node) bool {
+		var body []parser.Node
+		switch n := node.(type) {
+		case *parser.File:
+			body = n.Body
+		case *parser.Compound:
+			body = n.Body
+		default:
+			return false
+		}
+		for i, n := range body {
+			d, ok := n.(*parser.Directive)
+			if !ok {
+				continue
+			}
+			j := i
+			for j > 0 && isAttached(body[j-1]) {
+				j--
+			}
+			if j < i {
+				attached[d] = body[j:i]
+			}
+		}
+		return true
+	})
+	return attached
+}
+
+// isAttached reports whether a node is a comment that isn't followed by a
+// blank line.
+func isAttached(node parser.Node) bool {
+	c, ok := node.(*parser.Comment)
+	if !ok {
+		return false
+	}
+	tokens := c.Phrase.Tokens
+	i := len(tokens)
+	for i > 0 && tokens[i-1].Type != tokeniser.TokenComment {
+		i--
+	}
+	var trailing strings.Builder
+	joinTokens(&trailing, tokens[i:])
+	return lineBreaks(trailing.String()) < 2
+}
+
+// container returns the block a directive is printed in: its own, or the
+// innermost one it's in that was parsed, or nil for the class body.
+func (s *source) container(b *Block) *Block {
+	for ; b != nil; b = b.Parent {
+		if _, ok := s.blocks[b]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// edits are the changes to print a recipe's syntax tree with: what to print
+// in place of each parsed directive, if anything, and the runs of new
+// directives to put before and after statements. Origins holds the parsed
+// directive that each of the recipe's was matched with, if any, and restyled
+// whether the unchanged ones are rendered anew too.
+type edits struct {
+	slots         map[*parser.Directive]placement
+	before, after map[parser.Node][]run
+	origins       [3][]*original
+	restyled      bool
+}
+
+// placement is a parsed directive, along with its comments, to print in
+// place of one in the tree, with line replacing its statement if it has
+// changed. An empty placement removes the directive in the tree.
+type placement struct {
+	unit *original
+	line string
+}
+
+// run is a list of new directives printed on consecutive lines, in blocks
+// within base. Sep is the number of line breaks before the run, and trail the
+// number after it when it comes before a statement.
+type run struct {
+	sep, trail int
+	base       *Block
+	directives []directive
+}
+
+// edits matches the recipe's directives with those it was parsed from. They
+// are matched by their text, and then a changed directive with one that was
+// removed from between the same neighbours. The directives that matched are
+// printed in the places of those they matched, in the recipe's order, so that
+// sorting moves them along with their comments. New directives go next to
+// their neighbours, or if they have none in their block, at its end, and in
+// the class body, in a section after the kinds that come before theirs.
+func (r Recipe) edits() edits {
+	s := r.source
+	e := edits{
+		slots:    make(map[*parser.Directive]placement),
+		before:   make(map[parser.Node][]run),
+		after:    make(map[parser.Node][]run),
+		restyled: s.restyled,
+	}
+	var kept [3][]*original
+	var loose [3][]directive
+	for kind, ds := range r.directives(s.quote) {
+		e.origins[kind] = make([]*original, len(ds))
+		var containers []*Block
+		slots := make(map[*Block][]*original)
+		for _, o := range s.directives[kind] {
+			if _, ok := slots[o.block]; !ok {
+				containers = append(containers, o.block)
+			}
+			slots[o.block] = append(slots[o.block], o)
+		}
+		items := make(map[*Block][]directive)
+		for _, d := range ds {
+			c := s.container(d.block)
+			if _, ok := slots[c]; !ok && items[c] == nil {
+				containers = append(containers, c)
+			}
+			items[c] = append(items[c], d)
+		}
+		for _, c := range containers {
+			var end parser.Node
+			if c != nil {
+				body := s.blocks[c].Body
+				end = s.key(body[len(body)-1])
+			}
+			placed, unanchored := e.place(slots[c], items[c], c, end, e.origins[kind])
+			if c == nil {
+				kept[kind], loose[kind] = placed, unanchored
+			}
+		}
+	}
+	sections := make(map[parser.Node]int)
+	for kind, ds := range loose {
+		if len(ds) == 0 {
+			continue
+		}
+		section := run{sep: 2, trail: 2, directives: ds}
+		var node parser.Node
+		after := true
+		for _, k := range kept[:kind] {
+			if len(k) > 0 {
+				node = k[len(k)-1].directive()
+			}
+		}
+		for _, k := range kept[kind+1:] {
+			if node == nil && len(k) > 0 {
+				node, after = k[0].directive(), false
+			}
+		}
+		if node == nil {
+			body := s.class.Body
+			i := slices.IndexFunc(body, func(n parser.Node) bool {
+				_, ok := n.(*parser.Compound)
+				return ok
+			})
+			switch {
+			case i < 0:
+				node = s.key(body[len(body)-1])
+			case i > 0:
+				node = s.key(body[i-1])
+			default:
+				node, after = s.key(body[0]), false
+			}
+		}
+		if after {
+			e.after[node] = append(e.after[node], section)
+		} else {
+			e.before[node] = slices.Insert(e.before[node], sections[node], section)
+			sections[node]++
+		}
+	}
+	return e
+}
+
+// place matches the directives of one kind in a container with those parsed
+// there, recording the matches in origins, and returns the parsed directives
+// that are still printed, in order, and the new directives that have no
+// neighbour to go next to. New directives after the last that matched go at
+// the end of a block, the last statement of which is end, and otherwise after
+// that directive.
+func (e edits) place(slots []*original, items []directive, c *Block, end parser.Node, origins []*original) ([]*original, []directive) {
+	match := make([]int, len(items))
+	used := make([]bool, len(slots))
+	for i, d := range items {
+		match[i] = -1
+		if d.block != c {
+			continue
+		}
+		for j, o := range slots {
+			if !used[j] && o.text == d.text {
+				match[i], used[j] = j, true
+				break
+			}
+		}
+	}
+	exact := slices.Clone(match)
+	for i, d := range items {
+		if match[i] >= 0 || d.block != c {
+			continue
+		}
+		lo, hi := -1, len(slots)
+		for k := i - 1; k >= 0 && lo < 0; k-- {
+			lo = match[k]
+		}
+		for k := i + 1; k < len(items) && hi == len(slots); k++ {
+			if exact[k] >= 0 {
+				hi = exact[k]
+			}
+		}
+		for j := lo + 1; j < hi; j++ {
+			if !used[j] {
+				match[i], used[j] = j, true
+				break
+			}
+		}
+	}
+
+	var kept []*original
+	for j, o := range slots {
+		if used[j] {
+			kept = append(kept, o)
+		} else {
+			e.slots[o.directive()] = placement{}
+		}
+	}
+	at := make([]*original, len(items))
+	n := 0
+	for i, d := range items {
+		if match[i] < 0 {
+			continue
+		}
+		at[i] = kept[n]
+		n++
+		origins[d.index] = slots[match[i]]
+		p := placement{unit: slots[match[i]]}
+		if exact[i] < 0 || e.restyled && !hasInteriorComment(slots[match[i]].directive()) {
+			p.line = d.line
+		}
+		e.slots[at[i].directive()] = p
+	}
+
+	var unanchored []directive
+	for i := 0; i < len(items); {
+		if at[i] != nil {
+			i++
+			continue
+		}
+		j := i
+		for j < len(items) && at[j] == nil {
+			j++
+		}
+		ds := items[i:j]
+		switch {
+		case j < len(items):
+			node := at[j].directive()
+			e.before[node] = append(e.before[node], run{trail: 1, base: c, directives: ds})
+		case end != nil:
+			e.after[end] = append(e.after[end], run{sep: 1, base: c, directives: ds})
+		case i > 0:
+			node := at[i-1].directive()
+			e.after[node] = append(e.after[node], run{sep: 1, base: c, directives: ds})
+		default:
+			unanchored = ds
+		}
+		i = j
+	}
+	return kept, unanchored
+}
+
+// key returns the node that edits are made at for a statement: the directive
+// if it's a comment above one, or the statement itself.
+func (s *source) key(node parser.Node) parser.Node {
+	if o := s.units[node]; o != nil {
+		return o.directive()
+	}
+	return node
+}
+
+// render prints the syntax tree the recipe was parsed from with its edits.
+func (r Recipe) render() string {
+	p := printer{r: r, edits: r.edits()}
+	var sb strings.Builder
+	if r.source.bom {
+		sb.WriteString("\uFEFF")
+	}
+	p.body(&sb, r.source.file.Body)
+	sb.WriteString(r.source.file.Trailer)
+	return sb.String()
+}
+
+// printer prints a syntax tree with edits. Pending holds the leading
+// whitespace of statements that were removed, which the next one takes if
+// it has more blank lines.
+type printer struct {
+	r       Recipe
+	edits   edits
+	pending string
+}
+
+// body prints statements, reporting whether any that aren't comments were
+// printed.
+func (p *printer) body(sb *strings.Builder, nodes []parser.Node) bool {
+	var printed bool
+	for i := 0; i < len(nodes); i++ {
+		node := nodes[i]
+		unit := p.r.source.units[node]
+		at := node
+		if unit != nil {
+			at = unit.directive()
+			i += len(unit.nodes) - 1
+		}
+		lead, tokens := splitLead(tokensOf(node))
+		if lineBreaks(p.pending) > lineBreaks(lead) {
+			lead = p.pending
+		}
+		p.pending = ""
+		indent := lead[strings.LastIndexAny(lead, "\r\n")+1:]
+
+		first, sep := true, 1
+		write := func(text string) {
+			if first {
+				sb.WriteString(lead)
+			} else {
+				sb.WriteString(strings.Repeat(p.r.newline(), sep) + indent)
+			}
+			first = false
+			sb.WriteString(text)
+		}
+		for _, run := range p.edits.before[at] {
+			write(p.run(run, indent))
+			sep = run.trail
+		}
+		switch node := node.(type) {
+		case *parser.Compound:
+			var inner strings.Builder
+			if p.body(&inner, node.Body) || !p.modelled(node) {
+				var text strings.Builder
+				joinTokens(&text, tokens)
+				write(text.String() + inner.String())
+				printed = true
+			}
+		default:
+			if unit != nil {
+				if placement := p.edits.slots[unit.directive()]; placement.unit != nil {
+					write(placement.String())
+					printed = true
+				}
+				break
+			}
+			var text strings.Builder
+			joinTokens(&text, tokens)
+			write(text.String())
+			if _, ok := node.(*parser.Comment); !ok {
+				printed = true
+			}
+		}
+		for _, run := range p.edits.after[at] {
+			sep = run.sep
+			write(p.run(run, indent))
+			printed = true
+		}
+		if first && lineBreaks(lead) > lineBreaks(p.pending) {
+			p.pending = lead
+		}
+	}
+	p.pending = ""
+	return printed
+}
+
+// modelled reports whether a compound statement is a block of directives.
+func (p *printer) modelled(node *parser.Compound) bool {
+	for _, c := range p.r.source.blocks {
+		if c == node {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *printer) run(run run, indent string) string {
+	var sb strings.Builder
+	p.r.writeDirectives(&sb, indent, run.base, run.directives)
+	return sb.String()
+}
+
+// String returns the text of a parsed directive and its comments, without the
+// leading whitespace of the first, with the directive's statement replaced by
+// line if it has changed.
+func (p placement) String() string {
+	var sb strings.Builder
+	for i, node := range p.unit.nodes {
+		tokens := tokensOf(node)
+		if i == 0 {
+			_, tokens = splitLead(tokens)
+		}
+		if _, ok := node.(*parser.Directive); ok && p.line != "" {
+			end := len(tokens)
+			for end > 0 && !significant(tokens[end-1]) {
+				end--
+			}
+			sb.WriteString(p.line)
+			tokens = tokens[end:]
+		}
+		joinTokens(&sb, tokens)
+	}
+	return sb.String()
+}
+
+// tokensOf returns the tokens of a statement's phrase.
+func tokensOf(node parser.Node) []tokeniser.Token {
+	switch node := node.(type) {
+	case *parser.Comment:
+		return node.Phrase.Tokens
+	case *parser.Statement:
+		return node.Phrase.Tokens
+	case *parser.Directive:
+		return node.Phrase.Tokens
+	case *parser.Compound:
+		return node.Phrase.Tokens
+	}
+	return nil
+}
+
+// splitLead splits the newlines and indentation off the start of a phrase.
+func splitLead(tokens []tokeniser.Token) (string, []tokeniser.Token) {
+	var sb strings.Builder
+	i := 0
+	for i < len(tokens) && (tokens[i].Type == tokeniser.TokenNewline || tokens[i].Type == tokeniser.TokenWhitespace) {
+		sb.WriteString(tokens[i].Val)
+		i++
+	}
+	return sb.String(), tokens[i:]
+}
+
+// hasInteriorComment reports whether a directive has a comment before the end
+// of its call, which printing it anew would lose.
+func hasInteriorComment(d *parser.Directive) bool {
+	tokens := d.Phrase.Tokens
+	end := len(tokens)
+	for end > 0 && !significant(tokens[end-1]) {
+		end--
+	}
+	return slices.ContainsFunc(tokens[:end], func(token tokeniser.Token) bool {
+		return token.Type == tokeniser.TokenComment
+	})
+}
+
+func significant(token tokeniser.Token) bool {
+	switch token.Type {
+	case tokeniser.TokenNewline, tokeniser.TokenWhitespace, tokeniser.TokenComment:
+		return false
+	}
+	return true
+}
+
+func joinTokens(sb *strings.Builder, tokens []tokeniser.Token) {
+	for _, token := range tokens {
+		sb.WriteString(token.Val)
+	}
+}
+
+// lineBreaks returns the number of line endings in s.
+func lineBreaks(s string) int {
+	return strings.Count(s, "\n") + strings.Count(s, "\r") - strings.Count(s, "\r\n")
+}
+
+func (b *Block) format(quote byte) string {
+	contexts := make([]string, len(b.Contexts))
+	for i, c := range b.Contexts {
+		contexts[i] = c.format(quote)
+	}
+	return "with " + strings.Join(contexts, ", ") + ":"
+}
+
+func (c Context) format(quote byte) string {
+	if !c.DefaultArgs {
+		return "when(" + tokeniser.Quote(c.When.String(), quote) + ")"
+	}
+	var args []string
+	if len(c.Type) > 0 {
+		args = append(args, typeArgument(c.Type, quote))
+	}
+	if when := c.When.String(); when != "" {
+		args = append(args, "when="+tokeniser.Quote(when, quote))
+	}
+	var keys []string
+	for k := range c.Extra {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		args = append(args, k+"="+c.Extra[k])
+	}
+	return "default_args(" + strings.Join(args, ", ") + ")"
+}
+
+func (v Version) String() string {
+	return v.format('"')
+}
+
+func (v Version) format(quote byte) string {
+	args := []string{tokeniser.Quote(v.Version, quote)}
+	var keys []string
+	for _, k := range hashTypes {
+		if _, ok := v.Extra[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range urlTypes {
+		if _, ok := v.Extra[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	var rest []string
+	for k := range v.Extra {
+		if !slices.Contains(keys, k) {
+			rest = append(rest, k)
+		}
+	}
+	slices.Sort(rest)
+	for _, k := range append(keys, rest...) {
+		value := v.Extra[k]
+		if k != "preferred" {
+			value = tokeniser.Quote(value, quote)
+		}
+		args = append(args, k+"="+value)
+	}
+	for _, a := range v.Args {
+		args = append(args, a.format(quote))
+	}
+	return "version(" + strings.Join(args, ", ") + ")"
+}
+
+func (v Variant) String() string {
+	return v.format('"')
+}
+
+func (v Variant) format(quote byte) string {
+	args := []string{tokeniser.Quote(v.Name, quote)}
+	if v.Default != "" {
+		args = append(args, "default="+v.Default)
+	}
+	if v.Description != "" {
+		args = append(args, "description="+tokeniser.Quote(v.Description, quote))
+	}
+	if v.Values != nil {
+		values := make([]string, len(v.Values))
+		for i, value := range v.Values {
+			values[i] = tokeniser.Quote(value, quote)
+		}
+		if len(values) == 1 {
+			values[0] += ","
+		}
+		args = append(args, "values=("+strings.Join(values, ", ")+")")
+	}
+	if v.Multi {
+		args = append(args, "multi=True")
+	}
+	for _, a := range v.Args {
+		args = append(args, a.format(quote))
+	}
+	if when := v.When.String(); when != "" {
+		args = append(args, "when="+tokeniser.Quote(when, quote))
+	}
+	return "variant(" + strings.Join(args, ", ") + ")"
+}
+
+func (a Argument) format(quote byte) string {
+	if a.IsString {
+		return a.Name + "=" + tokeniser.Quote(a.Value, quote)
+	}
+	return a.Name + "=" + a.Value
+}
+
+func (d DependsOn) String() string {
+	return d.format('"')
+}
+
+func (d DependsOn) format(quote byte) string {
+	args := []string{tokeniser.Quote(d.Spec.String(), quote)}
+	if len(d.Type) > 0 {
+		args = append(args, typeArgument(d.Type, quote))
+	}
+	if when := d.When.String(); when != "" {
+		args = append(args, "when="+tokeniser.Quote(when, quote))
+	}
+	for _, a := range d.Args {
+		args = append(args, a.format(quote))
+	}
+	return "depends_on(" + strings.Join(args, ", ") + ")"
+}
+
+func typeArgument(types []string, quote byte) string {
+	if len(types) == 1 {
+		return "type=" + tokeniser.Quote(types[0], quote)
+	}
+	quoted := make([]string, len(types))
+	for i, t := range types {
+		quoted[i] = tokeniser.Quote(t, quote)
+	}
+	return "type=(" + strings.Join(quoted, ", ") + ")"
+}
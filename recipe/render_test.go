@@ -0,0 +1,360 @@
+package recipe
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+	"github.com/wtsi-hgi/uber-recipe-creator/spec"
+)
+
+func TestRenderRoundTrip(t *testing.T) {
+	for n, input := range [...]string{testdata.TestCran1, testdata.TestBioc1, testdata.TestRecipe1} {
+		r, err := parseRecipe(input, "")
+		if err != nil {
+			t.Fatalf("Test %d: %s", n+1, err)
+		}
+		if got := r.String(); got != input {
+			t.Errorf("Test %d: render incorrect, expected:\n%s\ngot:\n%s", n+1, input, got)
+		}
+	}
+}
+
+func TestRenderQuotes(t *testing.T) {
+	input := "class A(RPackage):\n\n\tversion('1.0', md5='abc00000000000000000000000000000')\n\n\tdepends_on('r@3.1:', type=('build', 'run'))\n"
+	r, err := parseRecipe(input, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Versions[0].Version != "1.0" || r.Dependencies[0].Spec.Name != "r" {
+		t.Errorf("expected decoded values, got %q and %q", r.Versions[0].Version, r.Dependencies[0].Spec.Name)
+	}
+	if got := r.String(); got != input {
+		t.Errorf("render incorrect, expected:\n%s\ngot:\n%s", input, got)
+	}
+}
+
+func TestRenderNamedEscapes(t *testing.T) {
+	input := "class A(RPackage):\n\t\"\"\"Fits models \\N{EN DASH} quickly.\"\"\"\n\n" +
+		"\tversion(\"1.0\", md5=\"abc00000000000000000000000000000\")\n\n" +
+		"\tvariant(\"x\", default=True, description=\"X \\N{EN DASH} Y\")\n" +
+		"\tvariant(\"y\", default=True, description=\"X \\\\N{EN DASH} Y\")\n"
+	r, err := parseRecipe(input, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Class.Docstring != "" {
+		t.Errorf("expected a docstring with a named escape to have no value, got %q", r.Class.Docstring)
+	}
+	x, y := r.Variants[0], r.Variants[1]
+	if expected := []Argument{{Name: "description", Value: `"X \N{EN DASH} Y"`}}; x.Description != "" || !reflect.DeepEqual(x.Args, expected) {
+		t.Errorf("expected the description to be kept as source, got %q and %+v", x.Description, x.Args)
+	}
+	if y.Description != `X \N{EN DASH} Y` {
+		t.Errorf("expected an escaped backslash to be decoded, got %q", y.Description)
+	}
+	if got := r.String(); got != input {
+		t.Errorf("render incorrect, expected:\n%s\ngot:\n%s", input, got)
+	}
+
+	r.Variants[0].Default, r.Variants[1].Default = "False", "False"
+	expected := "class A(RPackage):\n\t\"\"\"Fits models \\N{EN DASH} quickly.\"\"\"\n\n" +
+		"\tversion(\"1.0\", md5=\"abc00000000000000000000000000000\")\n\n" +
+		"\tvariant(\"x\", default=False, description=\"X \\N{EN DASH} Y\")\n" +
+		"\tvariant(\"y\", default=False, description=\"X \\\\N{EN DASH} Y\")\n"
+	if got := r.String(); got != expected {
+		t.Errorf("render incorrect, expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestRenderSpecs(t *testing.T) {
+	input := "class A(RPackage):\n\n\tversion(\"2.0\", md5=\"abc00000000000000000000000000000\")\n\n\tdepends_on(\"r-rcpp@1.0.5: +foo\", when=\"@2: %gcc\")\n"
+	r, err := parseRecipe(input, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.String(); got != input {
+		t.Errorf("render incorrect, expected:\n%s\ngot:\n%s", input, got)
+	}
+
+	_, err = parseRecipe("class A(RPackage):\n\tdepends_on(\"r-rcpp@\")\n", "")
+	if expected := `2:13: invalid spec: expected version at column 8 of "r-rcpp@"`; err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestRenderLineEndings(t *testing.T) {
+	for n, input := range [...]string{
+		strings.ReplaceAll(testdata.TestCran1, "\n", "\r\n"),
+		strings.ReplaceAll(testdata.TestRecipe1, "\n", "\r"),
+		"\uFEFF" + testdata.TestBioc1,
+	} {
+		r, err := parseRecipe(input, "")
+		if err != nil {
+			t.Fatalf("Test %d: %s", n+1, err)
+		}
+		if got := r.String(); got != input {
+			t.Errorf("Test %d: render incorrect, expected:\n%q\ngot:\n%q", n+1, input, got)
+		}
+	}
+
+	r, err := parseRecipe(strings.ReplaceAll(testdata.TestCran1, "\n", "\r\n"), "abcrf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Update([]Package{{Name: "abcrf", Version: "2.0", MD5sum: "0123456789abcdef0123456789abcdef"}})
+	if got := r.String(); strings.Count(got, "\n") != strings.Count(got, "\r\n") {
+		t.Errorf("mixed line endings after update:\n%q", got)
+	}
+}
+
+func TestRenderUpdate(t *testing.T) {
+	r, err := parseRecipe(testdata.TestCran1, "abcrf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := r.Update([]Package{{
+		Name:    "abcrf",
+		Version: "2.0",
+		Depends: []Dependency{
+			{Name: "R", Version: VersionRange{Min: "3.1"}},
+			{Name: "readr"},
+			{Name: "methods"},
+			{Name: "Rcpp", Version: VersionRange{Min: "1.0.5"}},
+			{Name: "data.table"},
+		},
+		MD5sum: "0123456789abcdef0123456789abcdef",
+	}})
+	if !updated {
+		t.Fatal("expected recipe to be updated")
+	}
+	if r.Update([]Package{{Name: "abcrf", Version: "2.0"}}) {
+		t.Error("expected second update to be a no-op")
+	}
+
+	expected := `# Copyright 2013-2023 Lawrence Livermore National Security, LLC and other
+# Spack Project Developers. See the top-level COPYRIGHT file for details.
+#
+# SPDX-License-Identifier: (Apache-2.0 OR MIT)
+
+from spack.package import *
+
+
+class RAbcrf(RPackage):
+	"""Approximate Bayesian Computation via Random Forests
+
+	Performs Approximate Bayesian Computation (ABC) model choice and parameter inference via random forests.
+  Pudlo P., Marin J.-M., Estoup A., Cornuet J.-M., Gautier M. and Robert C. P. (2016) <doi:10.1093/bioinformatics/btv684>.
+  Estoup A., Raynal L., Verdu P. and Marin J.-M. <http://journal-sfds.fr/article/view/709>.
+  Raynal L., Marin J.-M., Pudlo P., Ribatet M., Robert C. P. and Estoup A. (2019) <doi:10.1093/bioinformatics/bty867>.
+	"""
+	
+	cran = "abcrf" 
+
+	version("2.0", md5="0123456789abcdef0123456789abcdef")
+	version("1.9", md5="506f4cc36ae9d66bd174f4b65f8c3bb2")
+
+	depends_on("r@3.1:", type=("build", "run"))
+	depends_on("r-readr", type=("build", "run"))
+	depends_on("r-mass", type=("build", "run"))
+	depends_on("r-matrixstats", type=("build", "run"))
+	depends_on("r-ranger", type=("build", "run"))
+	depends_on("r-doparallel", type=("build", "run"))
+	depends_on("r-foreach", type=("build", "run"))
+	depends_on("r-stringr", type=("build", "run"))
+	depends_on("r-rcpp", type=("build", "run"), when="@:1.9")
+	depends_on("r-rcpparmadillo", type=("build", "run"))
+	depends_on("r-rcpp@1.0.5:", type=("build", "run"), when="@2.0:")
+	depends_on("r-data-table", type=("build", "run"), when="@2.0:")
+`
+	if got := r.String(); got != expected {
+		t.Errorf("render incorrect, expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestRenderVersionArgs(t *testing.T) {
+	input := "class A(Package):\n\n" +
+		"\tversion('2.0', sha256='abc0000000000000000000000000000000000000000000000000000000000000', deprecated=True, expand=False, extension='tar' '.gz')\n" +
+		"\tversion('1.0', branch='main', git='https://example.com/a.git', submodules=True, fetch_options=dict(\n\t\ttimeout=60,\n\t))\n" +
+		"\tversion('0.9', tag='v0.9', git=base +  '/a.git', extension=f'{ext}')\n" +
+		"\tversion('0.8', url='https://example.com/a-0.8.tar.gz')\n"
+	r, err := parseRecipe(input, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Argument{{"deprecated", "True", false}, {"expand", "False", false}, {"extension", "tar.gz", true}}
+	if !reflect.DeepEqual(r.Versions[0].Args, expected) {
+		t.Errorf("expected arguments %+v, got %+v", expected, r.Versions[0].Args)
+	}
+	expected = []Argument{{"git", "base + '/a.git'", false}, {"extension", "f'{ext}'", false}}
+	if !reflect.DeepEqual(r.Versions[2].Args, expected) {
+		t.Errorf("expected arguments %+v, got %+v", expected, r.Versions[2].Args)
+	}
+	rendered := []string{
+		"version('2.0', sha256='abc0000000000000000000000000000000000000000000000000000000000000', deprecated=True, expand=False, extension='tar.gz')",
+		"version('1.0', branch='main', git='https://example.com/a.git', submodules=True, fetch_options=dict(timeout=60))",
+		"version('0.9', tag='v0.9', git=base + '/a.git', extension=f'{ext}')",
+		"version('0.8', url='https://example.com/a-0.8.tar.gz')",
+	}
+	for i, v := range r.Versions {
+		if got := v.format(r.Quote); got != rendered[i] {
+			t.Errorf("render incorrect, expected:\n%s\ngot:\n%s", rendered[i], got)
+		}
+	}
+	if got := r.String(); got != input {
+		t.Errorf("expected the recipe to be printed as it was, got:\n%s", got)
+	}
+}
+
+func TestRenderVersionRefs(t *testing.T) {
+	input := "class A(Package):\n\n" +
+		"\tversion(\"1.2\", tag=\"v1.2\", commit=\"0123456789abcdef0123456789abcdef01234567\")\n" +
+		"\tversion(\"1.1\", md5=\"0123456789abcdef0123456789abcdef\", sha256=\"abc0000000000000000000000000000000000000000000000000000000000000\")\n"
+	r, err := parseRecipe(input, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"tag": "v1.2", "commit": "0123456789abcdef0123456789abcdef01234567"}; !reflect.DeepEqual(r.Versions[0].Extra, expected) {
+		t.Errorf("expected %v, got %v", expected, r.Versions[0].Extra)
+	}
+	if got := r.String(); got != input {
+		t.Errorf("render incorrect, expected:\n%s\ngot:\n%s", input, got)
+	}
+}
+
+func TestRenderDependencyArgs(t *testing.T) {
+	input := "class A(Package):\n\n" +
+		"\tdepends_on(\"b\", type=[\"test\", \"run\", \"link\", \"build\"])\n" +
+		"\tdepends_on(\"c\", \"@2:\", \"build\", patches=patch(\"fix.patch\",\n\t\twhen=\"@1\"))\n"
+	r, err := parseRecipe(input, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered := []string{
+		"depends_on(\"b\", type=(\"build\", \"link\", \"run\", \"test\"))",
+		"depends_on(\"c\", type=\"build\", when=\"@2:\", patches=patch(\"fix.patch\", when=\"@1\"))",
+	}
+	for i, d := range r.Dependencies {
+		if got := d.String(); got != rendered[i] {
+			t.Errorf("render incorrect, expected:\n%s\ngot:\n%s", rendered[i], got)
+		}
+	}
+	if got := r.String(); got != input {
+		t.Errorf("expected the recipe to be printed as it was, got:\n%s", got)
+	}
+}
+
+func TestRenderKeepsLayout(t *testing.T) {
+	input := `class RA(RPackage):
+	"""Doc."""
+
+	cran = "a"
+
+	# Newest first.
+	version("1.0", md5="aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")  # keep
+
+	depends_on("r@3:", type=("build", "run"))
+	# Needs the C++ headers.
+	depends_on("r-rcpp", type=("build", "run"))
+	with when("@1:"):
+		depends_on("r-b", type=("build", "run"))
+
+	def install(self, spec, prefix):
+		pass
+
+	version("0.9", md5="bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+`
+	r, err := parseRecipe(input, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Update([]Package{{
+		Name:    "a",
+		Version: "2.0",
+		Depends: []Dependency{
+			{Name: "R", Version: VersionRange{Min: "3"}},
+			{Name: "Rcpp", Version: VersionRange{Min: "1.0"}},
+			{Name: "b"},
+			{Name: "c"},
+		},
+		MD5sum: "cccccccccccccccccccccccccccccccc",
+	}})
+	expected := `class RA(RPackage):
+	"""Doc."""
+
+	cran = "a"
+
+	version("2.0", md5="cccccccccccccccccccccccccccccccc")
+	# Newest first.
+	version("1.0", md5="aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")  # keep
+
+	depends_on("r@3:", type=("build", "run"))
+	# Needs the C++ headers.
+	depends_on("r-rcpp", type=("build", "run"), when="@:1.0")
+	depends_on("r-rcpp@1.0:", type=("build", "run"), when="@2.0:")
+	depends_on("r-c", type=("build", "run"), when="@2.0:")
+	with when("@1:"):
+		depends_on("r-b", type=("build", "run"))
+
+	def install(self, spec, prefix):
+		pass
+
+	version("0.9", md5="bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+`
+	if got := r.String(); got != expected {
+		t.Errorf("render incorrect, expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestRenderEdits(t *testing.T) {
+	for n, test := range [...]struct {
+		input    string
+		edit     func(r *Recipe)
+		expected string
+	}{
+		{
+			"class A(Package):\n\tversion(\"1.0\")\n\n\t# Old.\n\tversion(\"2.0\")\n",
+			func(r *Recipe) { r.SortVersions() },
+			"class A(Package):\n\t# Old.\n\tversion(\"2.0\")\n\n\tversion(\"1.0\")\n",
+		},
+		{
+			"class A(Package):\n\t\"\"\"Doc.\"\"\"\n\n\tversion(\"2.0\")\n\tversion(\"1.0\")\n\n" +
+				"\twith when(\"@2:\"):\n\t\tdepends_on(\"b\")\n\tdepends_on(\"c\")\n",
+			func(r *Recipe) { r.Versions, r.Dependencies = r.Versions[1:], r.Dependencies[1:] },
+			"class A(Package):\n\t\"\"\"Doc.\"\"\"\n\n\tversion(\"1.0\")\n\n\tdepends_on(\"c\")\n",
+		},
+		{
+			"class A(Package):\n\tversion(\"1.0\")\n\n\tdef install(self):\n\t\tpass\n",
+			func(r *Recipe) { r.Dependencies = append(r.Dependencies, DependsOn{Spec: spec.Spec{Name: "b"}}) },
+			"class A(Package):\n\tversion(\"1.0\")\n\n\tdepends_on(\"b\")\n\n\tdef install(self):\n\t\tpass\n",
+		},
+		{
+			"class A(Package):\n\thomepage = \"h\"\n\n\tdef install(self):\n\t\tpass\n",
+			func(r *Recipe) { r.Versions = append(r.Versions, Version{Version: "1.0"}) },
+			"class A(Package):\n\thomepage = \"h\"\n\n\tversion(\"1.0\")\n\n\tdef install(self):\n\t\tpass\n",
+		},
+		{
+			"class A(Package):\n\tversion('1.0', md5='aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa')  # comment\n",
+			func(r *Recipe) { r.Versions[0].Extra["md5"] = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb" },
+			"class A(Package):\n\tversion('1.0', md5='bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb')  # comment\n",
+		},
+		{
+			"class A(Package):\n\twith when(\"@2:\"):\n\t\tdepends_on(\"b\")\n",
+			func(r *Recipe) {
+				block := &Block{Parent: r.Dependencies[0].Block, Contexts: []Context{{When: spec.Spec{Variants: []spec.Variant{{Name: "x", Enabled: true}}}}}}
+				r.Dependencies = append(r.Dependencies, DependsOn{Spec: spec.Spec{Name: "c"}, Block: block})
+			},
+			"class A(Package):\n\twith when(\"@2:\"):\n\t\tdepends_on(\"b\")\n\t\twith when(\"+x\"):\n\t\t\tdepends_on(\"c\")\n",
+		},
+	} {
+		r, err := parseRecipe(test.input, "")
+		if err != nil {
+			t.Fatalf("Test %d: %s", n+1, err)
+		}
+		test.edit(&r)
+		if got := r.String(); got != test.expected {
+			t.Errorf("Test %d: render incorrect, expected:\n%s\ngot:\n%s", n+1, test.expected, got)
+		}
+	}
+}
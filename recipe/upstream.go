@@ -0,0 +1,139 @@
+package recipe
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"path"
+)
+
+const (
+	CRANURL         = "https://cran.r-project.org/src/contrib"
+	BioconductorURL = "https://bioconductor.org/packages/release/bioc/src/contrib"
+)
+
+var ErrUnknownVersion = errors.New("unknown version")
+
+var checksums = [...]struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"md5", md5.New},
+	{"sha1", sha1.New},
+	{"sha224", sha256.New224},
+	{"sha256", sha256.New},
+	{"sha384", sha512.New384},
+	{"sha512", sha512.New},
+}
+
+// Release is the upstream metadata for a single version of a package, along
+// with the checksums of its source tarball, keyed by hash type.
+type Release struct {
+	Package
+	Checksums map[string]string
+}
+
+type Upstream interface {
+	Release(name, version string) (*Release, error)
+}
+
+// Repository is a CRAN-like package repository, where current sources live at
+// the root of URL and older ones under Archive/<name>/.
+type Repository struct {
+	URL    string
+	Client *http.Client
+}
+
+func (r Repository) Release(name, version string) (*Release, error) {
+	file := name + "_" + version + ".tar.gz"
+	for _, u := range [...]string{
+		r.URL + "/" + file,
+		r.URL + "/Archive/" + name + "/" + file,
+	} {
+		release, err := r.fetch(u, name)
+		if errors.Is(err, ErrUnknownVersion) {
+			continue
+		}
+		return release, err
+	}
+	return nil, ErrUnknownVersion
+}
+
+func (r Repository) fetch(url, name string) (*Release, error) {
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrUnknownVersion
+	default:
+		return nil, fmt.Errorf("fetching %s: %s", url, response.Status)
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	return readRelease(data, name)
+}
+
+func readRelease(tarball []byte, name string) (*Release, error) {
+	release := Release{Checksums: make(map[string]string)}
+	for _, c := range checksums {
+		h := c.new()
+		h.Write(tarball)
+		release.Checksums[c.name] = hex.EncodeToString(h.Sum(nil))
+	}
+	description, err := readDescription(tarball, name)
+	if err != nil {
+		return nil, err
+	}
+	packages, err := parseCranDatabase(description)
+	if err != nil {
+		return nil, err
+	}
+	release.Package = packages[0]
+	release.MD5sum = release.Checksums["md5"]
+	return &release, nil
+}
+
+func readDescription(tarball []byte, name string) (string, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(tarball))
+	if err != nil {
+		return "", err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return "", fmt.Errorf("no DESCRIPTION file found for %s", name)
+		} else if err != nil {
+			return "", err
+		}
+		if path.Clean(header.Name) != name+"/DESCRIPTION" {
+			continue
+		}
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, tr); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+}
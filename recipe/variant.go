@@ -0,0 +1,88 @@
+package recipe
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/spec"
+)
+
+// inheritedVariants are variants that packages get from Spack's build system
+// base classes rather than declaring them.
+var inheritedVariants = [...]string{"build_system", "build_type", "generator", "ipo", "dev_path", "patches"}
+
+// ValidateVariants checks the variants in the when= specs of the recipe's
+// depends_on directives, including those of the blocks they're in, against
+// the variants the recipe declares, returning an error for each one that
+// isn't declared or that has a value no declaration allows.
+func (r Recipe) ValidateVariants() []error {
+	var errs []error
+	for _, d := range r.Dependencies {
+		resolved, err := d.Resolve()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d, err))
+			continue
+		}
+		for _, v := range resolved.When.Variants {
+			if msg := r.checkVariant(v); msg != "" {
+				errs = append(errs, fmt.Errorf("%s: %s", d, msg))
+			}
+		}
+	}
+	return errs
+}
+
+func (r Recipe) checkVariant(v spec.Variant) string {
+	if slices.Contains(inheritedVariants[:], v.Name) {
+		return ""
+	}
+	var declared bool
+	for _, variant := range r.Variants {
+		if variant.Name != v.Name {
+			continue
+		}
+		declared = true
+		if variant.allows(v) {
+			return ""
+		}
+	}
+	if !declared {
+		return fmt.Sprintf("unknown variant %q", v.Name)
+	}
+	if v.Values == nil {
+		return fmt.Sprintf("variant %q is not boolean", v.Name)
+	}
+	return fmt.Sprintf("invalid value %q for variant %q", strings.Join(v.Values, ","), v.Name)
+}
+
+// allows reports whether the variant can take the value given in a spec.
+// Variants whose values aren't known allow any.
+func (v Variant) allows(s spec.Variant) bool {
+	if v.Values == nil {
+		if !v.isBoolean() {
+			return true
+		}
+		return s.Values == nil || len(s.Values) == 1 && isBooleanValue(s.Values[0])
+	}
+	if s.Values == nil || len(s.Values) > 1 && !v.Multi {
+		return false
+	}
+	for _, value := range s.Values {
+		if !slices.Contains(v.Values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// isBoolean reports whether the variant is a boolean one, which is what
+// Spack assumes when no values are given and the default is True or False.
+func (v Variant) isBoolean() bool {
+	hasValues := slices.ContainsFunc(v.Args, func(a Argument) bool { return a.Name == "values" })
+	return v.Values == nil && !hasValues && (v.Default == "True" || v.Default == "False" || v.Default == "")
+}
+
+func isBooleanValue(s string) bool {
+	return strings.EqualFold(s, "true") || strings.EqualFold(s, "false")
+}
@@ -0,0 +1,120 @@
+package recipe
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/spec"
+)
+
+const variantRecipe = `class A(Package):
+	version("1.0", sha256="abc0000000000000000000000000000000000000000000000000000000000000")
+
+	variant("x11", default=True, description="Enable X11")
+	variant(
+		"backend",
+		default="cpu",
+		description="The backend "
+		"to use",
+		values=("cpu", "gpu"),
+	)
+	variant("libs", default="shared", values=["shared", "static"], multi=True, when="@1:")
+	variant("codes", values=any_combination_of(
+		"a", "b"
+	).with_default("a"), sticky=True)
+
+	depends_on("b", when="+x11")
+`
+
+func TestReadVariants(t *testing.T) {
+	r, err := parseRecipe(variantRecipe, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Variant{
+		{Name: "x11", Default: "True", Description: "Enable X11"},
+		{Name: "backend", Default: `"cpu"`, Description: "The backend to use", Values: []string{"cpu", "gpu"}},
+		{
+			Name:    "libs",
+			Default: `"shared"`,
+			Values:  []string{"shared", "static"},
+			Multi:   true,
+			When:    spec.Spec{Versions: spec.VersionList{{Lo: "1", IsRange: true}}},
+		},
+		{Name: "codes", Args: []Argument{{Name: "values", Value: `any_combination_of("a", "b").with_default("a")`}, {Name: "sticky", Value: "True"}}},
+	}
+	if !reflect.DeepEqual(r.Variants, expected) {
+		t.Errorf("expected %+v, got %+v", expected, r.Variants)
+	}
+	if r.Header != "class A(Package):" {
+		t.Errorf("expected variants to be removed from the header, got %q", r.Header)
+	}
+
+	rendered := []string{
+		`variant("x11", default=True, description="Enable X11")`,
+		`variant("backend", default="cpu", description="The backend to use", values=("cpu", "gpu"))`,
+		`variant("libs", default="shared", values=("shared", "static"), multi=True, when="@1:")`,
+		`variant("codes", values=any_combination_of("a", "b").with_default("a"), sticky=True)`,
+	}
+	for i, v := range r.Variants {
+		if s := v.String(); s != rendered[i] {
+			t.Errorf("expected render:\n%s\ngot:\n%s", rendered[i], s)
+		}
+	}
+	if s := r.String(); s != variantRecipe {
+		t.Errorf("expected the recipe to be printed as it was, got:\n%s", s)
+	}
+
+	r.Variants[1].Default = `"gpu"`
+	changed := strings.Replace(variantRecipe, `variant(
+		"backend",
+		default="cpu",
+		description="The backend "
+		"to use",
+		values=("cpu", "gpu"),
+	)`, `variant("backend", default="gpu", description="The backend to use", values=("cpu", "gpu"))`, 1)
+	if s := r.String(); s != changed {
+		t.Errorf("expected only the changed variant to be rendered, got:\n%s", s)
+	}
+}
+
+func TestValidateVariants(t *testing.T) {
+	r, err := parseRecipe(variantRecipe, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, test := range [...]struct {
+		when     string
+		expected string
+	}{
+		{"+x11", ""},
+		{"~x11", ""},
+		{"x11=false", ""},
+		{"backend=gpu", ""},
+		{"libs=shared,static", ""},
+		{"codes=c", ""},
+		{"build_system=generic", ""},
+		{"@2: +x11 backend=cpu", ""},
+		{"+cuda", `depends_on("b", when="+cuda"): unknown variant "cuda"`},
+		{"backend=tpu", `depends_on("b", when="backend=tpu"): invalid value "tpu" for variant "backend"`},
+		{"backend=cpu,gpu", `depends_on("b", when="backend=cpu,gpu"): invalid value "cpu,gpu" for variant "backend"`},
+		{"+backend", `depends_on("b", when="+backend"): variant "backend" is not boolean`},
+		{"x11=maybe", `depends_on("b", when="x11=maybe"): invalid value "maybe" for variant "x11"`},
+	} {
+		when, err := spec.Parse(test.when)
+		if err != nil {
+			t.Fatalf("Test %d: %s", n+1, err)
+		}
+		r.Dependencies[0].When = when
+		var got string
+		if errs := r.ValidateVariants(); len(errs) > 1 {
+			t.Errorf("Test %d: expected at most one error, got %v", n+1, errs)
+		} else if len(errs) == 1 {
+			got = errs[0].Error()
+		}
+		if got != test.expected {
+			t.Errorf("Test %d: expected %q, got %q", n+1, test.expected, got)
+		}
+	}
+}
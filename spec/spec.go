@@ -0,0 +1,396 @@
+package spec
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Spec is a parsed Spack spec, such as "r-rcpp@1.0.5: +foo" in a depends_on
+// directive, or an anonymous one, with no name, such as "@2: %gcc" in a when=
+// argument.
+type Spec struct {
+	Name         string
+	Versions     VersionList
+	Variants     []Variant
+	Compiler     *Compiler
+	Platform     string
+	OS           string
+	Target       string
+	Dependencies []Spec
+}
+
+// Variant is either a boolean variant, "+name" or "~name", when it has no
+// Values, or a "name=value,..." one.
+type Variant struct {
+	Name      string
+	Values    []string
+	Enabled   bool
+	Propagate bool
+}
+
+type Compiler struct {
+	Name     string
+	Versions VersionList
+}
+
+// Error is a syntax error in a spec.
+type Error struct {
+	Spec   string
+	Offset int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at column %d of %q", e.Msg, e.Offset+1, e.Spec)
+}
+
+const versionChars = "._-=:,"
+const valueChars = "_-+*.,:=~/\\"
+
+type parser struct {
+	input string
+	pos   int
+}
+
+// Parse parses a spec, with its dependencies.
+func Parse(s string) (Spec, error) {
+	p := parser{input: s}
+	spec, err := p.node(false)
+	if err != nil {
+		return Spec{}, err
+	}
+	for p.accept('^') {
+		dep, err := p.node(true)
+		if err != nil {
+			return Spec{}, err
+		}
+		spec.Dependencies = append(spec.Dependencies, dep)
+	}
+	return spec, nil
+}
+
+// node parses a spec without dependencies, stopping at a '^' or the end of the
+// input. A dependency needs a name.
+func (p *parser) node(dependency bool) (Spec, error) {
+	var s Spec
+	for first := true; ; first = false {
+		p.skipSpace()
+		if p.pos >= len(p.input) || p.input[p.pos] == '^' {
+			break
+		}
+		start := p.pos
+		switch c := p.input[p.pos]; {
+		case dependency && first && !isNameChar(c):
+			return s, p.errorf(start, "expected package name")
+		case c == '@':
+			p.pos++
+			versions, err := p.versions()
+			if err != nil {
+				return s, err
+			}
+			if s.Versions != nil {
+				if versions = s.Versions.Intersect(versions); versions == nil {
+					return s, p.errorf(start, "versions don't overlap")
+				}
+			}
+			s.Versions = versions
+		case c == '+' || c == '~' || c == '-':
+			p.pos++
+			propagate := c != '-' && p.accept(c)
+			name := p.name()
+			if name == "" {
+				return s, p.errorf(p.pos, "expected variant name")
+			}
+			if err := s.addVariant(Variant{Name: name, Enabled: c == '+', Propagate: propagate}); err != "" {
+				return s, p.errorf(start, err)
+			}
+		case c == '%':
+			p.pos++
+			p.skipSpace()
+			if s.Compiler != nil {
+				return s, p.errorf(start, "compiler specified twice")
+			}
+			s.Compiler = &Compiler{Name: p.name()}
+			if s.Compiler.Name == "" {
+				return s, p.errorf(p.pos, "expected compiler name")
+			}
+			if p.accept('@') {
+				versions, err := p.versions()
+				if err != nil {
+					return s, err
+				}
+				s.Compiler.Versions = versions
+			}
+		case isNameChar(c):
+			name := p.name()
+			if !p.accept('=') {
+				if !first {
+					return s, p.errorf(start, "unexpected name %q", name)
+				}
+				s.Name = name
+				continue
+			}
+			propagate := p.accept('=')
+			value, err := p.value()
+			if err != nil {
+				return s, err
+			}
+			if msg := s.setPair(name, value, propagate); msg != "" {
+				return s, p.errorf(start, msg)
+			}
+		default:
+			return s, p.errorf(start, "unexpected %q", c)
+		}
+	}
+	slices.SortStableFunc(s.Variants, func(a, b Variant) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return s, nil
+}
+
+func (s *Spec) addVariant(v Variant) string {
+	for _, w := range s.Variants {
+		if w.Name == v.Name {
+			return fmt.Sprintf("variant %q specified twice", v.Name)
+		}
+	}
+	s.Variants = append(s.Variants, v)
+	return ""
+}
+
+// setPair sets a name=value pair, which is either part of the architecture or
+// a variant.
+func (s *Spec) setPair(name, value string, propagate bool) string {
+	var field *string
+	switch name {
+	case "platform":
+		field = &s.Platform
+	case "os":
+		field = &s.OS
+	case "target":
+		field = &s.Target
+	case "arch":
+		parts := strings.SplitN(value, "-", 3)
+		if len(parts) != 3 {
+			return fmt.Sprintf("invalid architecture %q", value)
+		}
+		for _, pair := range [...][2]string{{"platform", parts[0]}, {"os", parts[1]}, {"target", parts[2]}} {
+			if msg := s.setPair(pair[0], pair[1], propagate); msg != "" {
+				return msg
+			}
+		}
+		return ""
+	default:
+		return s.addVariant(Variant{Name: name, Values: strings.Split(value, ","), Propagate: propagate})
+	}
+	if *field != "" {
+		return name + " specified twice"
+	}
+	*field = value
+	return ""
+}
+
+func (p *parser) versions() (VersionList, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (isAlphanumeric(p.input[p.pos]) || strings.IndexByte(versionChars, p.input[p.pos]) >= 0) {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, p.errorf(start, "expected version")
+	}
+	versions, ok := parseVersionList(p.input[start:p.pos])
+	if !ok {
+		return nil, p.errorf(start, "invalid version list %q", p.input[start:p.pos])
+	}
+	return versions, nil
+}
+
+// value reads the value of a name=value pair, which may be quoted.
+func (p *parser) value() (string, error) {
+	start := p.pos
+	if p.pos < len(p.input) && (p.input[p.pos] == '"' || p.input[p.pos] == '\'') {
+		end := strings.IndexByte(p.input[p.pos+1:], p.input[p.pos])
+		if end < 0 {
+			return "", p.errorf(start, "unterminated quoted value")
+		}
+		p.pos += end + 2
+		return p.input[start+1 : p.pos-1], nil
+	}
+	for p.pos < len(p.input) && (isAlphanumeric(p.input[p.pos]) || strings.IndexByte(valueChars, p.input[p.pos]) >= 0) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf(start, "expected value")
+	}
+	return p.input[start:p.pos], nil
+}
+
+func (p *parser) name() string {
+	start := p.pos
+	for p.pos < len(p.input) && isNameChar(p.input[p.pos]) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *parser) accept(c byte) bool {
+	if p.pos < len(p.input) && p.input[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(offset int, format string, args ...any) error {
+	return &Error{Spec: p.input, Offset: offset, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isNameChar(c byte) bool {
+	return isAlphanumeric(c) || c == '_' || c == '-' || c == '.'
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// Constrain returns the spec satisfied by everything that satisfies both s
+// and o, as when a when= spec is used inside a with when(...) block, or an
+// error if nothing can.
+func (s Spec) Constrain(o Spec) (Spec, error) {
+	result := s
+	switch {
+	case o.Name == "":
+	case s.Name == "":
+		result.Name = o.Name
+	case s.Name != o.Name:
+		return Spec{}, fmt.Errorf("names %q and %q differ", s.Name, o.Name)
+	}
+	if len(s.Versions) > 0 && len(o.Versions) > 0 {
+		if result.Versions = s.Versions.Intersect(o.Versions); result.Versions == nil {
+			return Spec{}, fmt.Errorf("versions %s and %s don't overlap", s.Versions, o.Versions)
+		}
+	} else if len(o.Versions) > 0 {
+		result.Versions = o.Versions
+	}
+	result.Variants = slices.Clone(s.Variants)
+	for _, v := range o.Variants {
+		i := slices.IndexFunc(result.Variants, func(w Variant) bool { return w.Name == v.Name })
+		if i < 0 {
+			result.Variants = append(result.Variants, v)
+		} else if !reflect.DeepEqual(result.Variants[i], v) {
+			return Spec{}, fmt.Errorf("variant %q is constrained twice", v.Name)
+		}
+	}
+	slices.SortStableFunc(result.Variants, func(a, b Variant) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	if o.Compiler != nil {
+		if s.Compiler == nil {
+			result.Compiler = o.Compiler
+		} else if s.Compiler.Name != o.Compiler.Name {
+			return Spec{}, fmt.Errorf("compilers %q and %q differ", s.Compiler.Name, o.Compiler.Name)
+		} else if len(s.Compiler.Versions) > 0 && len(o.Compiler.Versions) > 0 {
+			versions := s.Compiler.Versions.Intersect(o.Compiler.Versions)
+			if versions == nil {
+				return Spec{}, fmt.Errorf("compiler versions %s and %s don't overlap", s.Compiler.Versions, o.Compiler.Versions)
+			}
+			result.Compiler = &Compiler{Name: s.Compiler.Name, Versions: versions}
+		} else if len(o.Compiler.Versions) > 0 {
+			result.Compiler = o.Compiler
+		}
+	}
+	for _, field := range [...]struct {
+		name         string
+		result       *string
+		theirs, ours string
+	}{
+		{"platform", &result.Platform, o.Platform, s.Platform},
+		{"os", &result.OS, o.OS, s.OS},
+		{"target", &result.Target, o.Target, s.Target},
+	} {
+		if field.ours != "" && field.theirs != "" && field.ours != field.theirs {
+			return Spec{}, fmt.Errorf("%s %q and %q differ", field.name, field.ours, field.theirs)
+		} else if field.theirs != "" {
+			*field.result = field.theirs
+		}
+	}
+	result.Dependencies = append(slices.Clone(s.Dependencies), o.Dependencies...)
+	return result, nil
+}
+
+// String returns the spec in a canonical form: the name and versions, the
+// boolean variants, the other variants, the compiler, the architecture and
+// then the dependencies, separated by spaces, with variants sorted by name.
+func (s Spec) String() string {
+	var parts []string
+	head := s.Name
+	if len(s.Versions) > 0 {
+		head += "@" + s.Versions.String()
+	}
+	if head != "" {
+		parts = append(parts, head)
+	}
+	var flags strings.Builder
+	for _, v := range s.Variants {
+		if v.Values != nil {
+			continue
+		}
+		sigil := "~"
+		if v.Enabled {
+			sigil = "+"
+		}
+		if v.Propagate {
+			sigil += sigil
+		}
+		flags.WriteString(sigil + v.Name)
+	}
+	if flags.Len() > 0 {
+		parts = append(parts, flags.String())
+	}
+	for _, v := range s.Variants {
+		if v.Values != nil {
+			parts = append(parts, pair(v.Name, strings.Join(v.Values, ","), v.Propagate))
+		}
+	}
+	if s.Compiler != nil {
+		compiler := "%" + s.Compiler.Name
+		if len(s.Compiler.Versions) > 0 {
+			compiler += "@" + s.Compiler.Versions.String()
+		}
+		parts = append(parts, compiler)
+	}
+	if s.Platform != "" && s.OS != "" && s.Target != "" {
+		parts = append(parts, pair("arch", s.Platform+"-"+s.OS+"-"+s.Target, false))
+	} else {
+		for _, p := range [...][2]string{{"platform", s.Platform}, {"os", s.OS}, {"target", s.Target}} {
+			if p[1] != "" {
+				parts = append(parts, pair(p[0], p[1], false))
+			}
+		}
+	}
+	for _, dep := range s.Dependencies {
+		parts = append(parts, "^"+dep.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+func pair(name, value string, propagate bool) string {
+	sep := "="
+	if propagate {
+		sep = "=="
+	}
+	for i := 0; i < len(value); i++ {
+		if !isAlphanumeric(value[i]) && strings.IndexByte(valueChars, value[i]) < 0 {
+			return name + sep + "\"" + value + "\""
+		}
+	}
+	return name + sep + value
+}
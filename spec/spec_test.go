@@ -0,0 +1,172 @@
+package spec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for n, test := range [...]struct {
+		input    string
+		expected Spec
+	}{
+		{
+			"r",
+			Spec{Name: "r"},
+		},
+		{
+			"r-rcpp@1.0.5: +foo",
+			Spec{
+				Name:     "r-rcpp",
+				Versions: VersionList{{Lo: "1.0.5", IsRange: true}},
+				Variants: []Variant{{Name: "foo", Enabled: true}},
+			},
+		},
+		{
+			"@2: %gcc",
+			Spec{
+				Versions: VersionList{{Lo: "2", IsRange: true}},
+				Compiler: &Compiler{Name: "gcc"},
+			},
+		},
+		{
+			"hdf5@1.10:1.12,=1.14.3~shared++mpi -fortran api=v110,v112 %gcc@9: arch=linux-rhel7-x86_64 ^zlib@1.2 +pic ^ mpi",
+			Spec{
+				Name: "hdf5",
+				Versions: VersionList{
+					{Lo: "1.10", Hi: "1.12", IsRange: true},
+					{Lo: "1.14.3", Exact: true},
+				},
+				Variants: []Variant{
+					{Name: "api", Values: []string{"v110", "v112"}},
+					{Name: "fortran"},
+					{Name: "mpi", Enabled: true, Propagate: true},
+					{Name: "shared"},
+				},
+				Compiler: &Compiler{Name: "gcc", Versions: VersionList{{Lo: "9", IsRange: true}}},
+				Platform: "linux",
+				OS:       "rhel7",
+				Target:   "x86_64",
+				Dependencies: []Spec{
+					{
+						Name:     "zlib",
+						Versions: VersionList{{Lo: "1.2"}},
+						Variants: []Variant{{Name: "pic", Enabled: true}},
+					},
+					{Name: "mpi"},
+				},
+			},
+		},
+		{
+			"target=aarch64 cflags==\"-O2 -g\"",
+			Spec{
+				Variants: []Variant{{Name: "cflags", Values: []string{"-O2 -g"}, Propagate: true}},
+				Target:   "aarch64",
+			},
+		},
+		{
+			"@:1.9 @:2.0",
+			Spec{Versions: VersionList{{Hi: "1.9", IsRange: true}}},
+		},
+		{
+			"",
+			Spec{},
+		},
+	} {
+		spec, err := Parse(test.input)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+		} else if !reflect.DeepEqual(spec, test.expected) {
+			t.Errorf("Test %d: got %+v, want %+v", n+1, spec, test.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for n, test := range [...]struct {
+		input, expected string
+	}{
+		{"r@", `expected version at column 3 of "r@"`},
+		{"r@1:2:3", `invalid version list "1:2:3" at column 3 of "r@1:2:3"`},
+		{"r +", `expected variant name at column 4 of "r +"`},
+		{"r +a ~a", `variant "a" specified twice at column 6 of "r +a ~a"`},
+		{"r s", `unexpected name "s" at column 3 of "r s"`},
+		{"r %gcc %clang", `compiler specified twice at column 8 of "r %gcc %clang"`},
+		{"r ^@1.0", `expected package name at column 4 of "r ^@1.0"`},
+		{"r arch=linux", `invalid architecture "linux" at column 3 of "r arch=linux"`},
+		{"r os=a os=b", `os specified twice at column 8 of "r os=a os=b"`},
+		{"r a=\"b", `unterminated quoted value at column 5 of "r a=\"b"`},
+		{"r a=", `expected value at column 5 of "r a="`},
+		{"r $", `unexpected '$' at column 3 of "r $"`},
+		{"@1 @2", `versions don't overlap at column 4 of "@1 @2"`},
+	} {
+		_, err := Parse(test.input)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Test %d: expected error %q, got %v", n+1, test.expected, err)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	for n, test := range [...]struct {
+		input, expected string
+	}{
+		{"r-rcpp@1.0.5: +foo", "r-rcpp@1.0.5: +foo"},
+		{"@2: %gcc", "@2: %gcc"},
+		{"r@3.1:", "r@3.1:"},
+		{"@:1.9", "@:1.9"},
+		{"hdf5~shared+cxx build_type=Release %gcc@9:11 target=x86_64 ^zlib", "hdf5 +cxx~shared build_type=Release %gcc@9:11 target=x86_64 ^zlib"},
+		{"py-numpy ++blas -lapack arch=linux-ubuntu22.04-zen2", "py-numpy ++blas~lapack arch=linux-ubuntu22.04-zen2"},
+		{"cflags='-O2 -g'", "cflags=\"-O2 -g\""},
+	} {
+		spec, err := Parse(test.input)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+			continue
+		}
+		if got := spec.String(); got != test.expected {
+			t.Errorf("Test %d: expected %q, got %q", n+1, test.expected, got)
+		} else if again, _ := Parse(got); !reflect.DeepEqual(again, spec) {
+			t.Errorf("Test %d: %q didn't round trip", n+1, got)
+		}
+	}
+}
+
+func TestConstrain(t *testing.T) {
+	for n, test := range [...]struct {
+		a, b, expected string
+	}{
+		{"@2:", "", "@2:"},
+		{"", "+x11", "+x11"},
+		{"@2:", "@:3", "@2:3"},
+		{"@2: +x11", "~cuda %gcc", "@2: ~cuda+x11 %gcc"},
+		{"+x11", "+x11", "+x11"},
+		{"%gcc", "%gcc@9:", "%gcc@9:"},
+		{"platform=linux", "target=x86_64", "platform=linux target=x86_64"},
+		{"^zlib", "^mpi", "^zlib ^mpi"},
+		{"r", "@4:", "r@4:"},
+		{"@:1", "@2:", "error: versions :1 and 2: don't overlap"},
+		{"+x11", "~x11", `error: variant "x11" is constrained twice`},
+		{"%gcc", "%clang", `error: compilers "gcc" and "clang" differ`},
+		{"os=a", "os=b", `error: os "a" and "b" differ`},
+		{"a", "b", `error: names "a" and "b" differ`},
+	} {
+		a, err := Parse(test.a)
+		if err != nil {
+			t.Fatalf("Test %d: %s", n+1, err)
+		}
+		b, err := Parse(test.b)
+		if err != nil {
+			t.Fatalf("Test %d: %s", n+1, err)
+		}
+		var got string
+		if c, err := a.Constrain(b); err != nil {
+			got = "error: " + err.Error()
+		} else {
+			got = c.String()
+		}
+		if got != test.expected {
+			t.Errorf("Test %d: expected %q, got %q", n+1, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package spec
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var infinityVersions = [...]string{"stable", "trunk", "head", "master", "main", "develop"}
+
+// VersionRange is a single version constraint: a version, which matches every
+// version it's a prefix of, an exact version, or a range whose bounds are
+// both inclusive, with the upper one also matching versions it's a prefix of.
+// Empty bounds are open.
+type VersionRange struct {
+	Lo, Hi  string
+	IsRange bool
+	Exact   bool
+}
+
+func (r VersionRange) String() string {
+	switch {
+	case r.Exact:
+		return "=" + r.Lo
+	case r.IsRange:
+		return r.Lo + ":" + r.Hi
+	}
+	return r.Lo
+}
+
+// Includes reports whether the version satisfies the constraint.
+func (r VersionRange) Includes(v string) bool {
+	if r.Exact {
+		return CompareVersions(v, r.Lo) == 0
+	}
+	lo, hi := r.bounds()
+	if lo != "" && CompareVersions(v, lo) < 0 {
+		return false
+	}
+	return hi == "" || CompareVersions(v, hi) <= 0 || versionHasPrefix(v, hi)
+}
+
+func (r VersionRange) bounds() (string, string) {
+	if r.IsRange || r.Exact {
+		return r.Lo, r.Hi
+	}
+	return r.Lo, r.Lo
+}
+
+// VersionList is a list of alternative version constraints, as written after
+// the @ of a spec.
+type VersionList []VersionRange
+
+func (l VersionList) String() string {
+	parts := make([]string, len(l))
+	for i, r := range l {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Includes reports whether the version satisfies any of the constraints. An
+// empty list includes every version.
+func (l VersionList) Includes(v string) bool {
+	if len(l) == 0 {
+		return true
+	}
+	for _, r := range l {
+		if r.Includes(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Intersect returns the constraints satisfied by versions in both lists.
+func (l VersionList) Intersect(m VersionList) VersionList {
+	if len(l) == 0 {
+		return m
+	} else if len(m) == 0 {
+		return l
+	}
+	var result VersionList
+	for _, a := range l {
+		for _, b := range m {
+			if r, ok := intersectRanges(a, b); ok {
+				result = append(result, r)
+			}
+		}
+	}
+	return result
+}
+
+func intersectRanges(a, b VersionRange) (VersionRange, bool) {
+	if a.Exact {
+		return a, b.Includes(a.Lo)
+	} else if b.Exact {
+		return b, a.Includes(b.Lo)
+	}
+	if a == b {
+		return a, true
+	}
+	alo, ahi := a.bounds()
+	blo, bhi := b.bounds()
+	lo := alo
+	if lo == "" || (blo != "" && CompareVersions(blo, lo) > 0) {
+		lo = blo
+	}
+	hi := ahi
+	if hi == "" || (bhi != "" && CompareVersions(bhi, hi) < 0) {
+		hi = bhi
+	}
+	if lo != "" && hi != "" && CompareVersions(lo, hi) > 0 && !versionHasPrefix(lo, hi) {
+		return VersionRange{}, false
+	}
+	return VersionRange{Lo: lo, Hi: hi, IsRange: true}, true
+}
+
+// parseVersionList parses the text after a spec's @, which the lexer has
+// already checked only contains version characters.
+func parseVersionList(s string) (VersionList, bool) {
+	var l VersionList
+	for _, part := range strings.Split(s, ",") {
+		var r VersionRange
+		if exact, ok := strings.CutPrefix(part, "="); ok {
+			r = VersionRange{Lo: exact, Exact: true}
+		} else if lo, hi, ok := strings.Cut(part, ":"); ok {
+			r = VersionRange{Lo: lo, Hi: hi, IsRange: true}
+		} else {
+			r = VersionRange{Lo: part}
+		}
+		if strings.Contains(r.Lo, ":") || strings.Contains(r.Hi, ":") ||
+			strings.HasPrefix(r.Lo, "=") || strings.HasPrefix(r.Hi, "=") ||
+			(!r.IsRange && r.Lo == "") {
+			return nil, false
+		}
+		l = append(l, r)
+	}
+	return l, true
+}
+
+// CompareVersions compares two Spack style version strings, returning -1, 0
+// or 1.
+func CompareVersions(a, b string) int {
+	ac, bc := versionComponents(a), versionComponents(b)
+	for i := 0; i < len(ac) && i < len(bc); i++ {
+		if c := compareComponent(ac[i], bc[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(ac) < len(bc):
+		return -1
+	case len(ac) > len(bc):
+		return 1
+	}
+	return 0
+}
+
+func versionComponents(v string) []string {
+	var components []string
+	var last int
+	for i, c := range v {
+		if c == '.' || c == '-' || c == '_' {
+			if i > last {
+				components = append(components, v[last:i])
+			}
+			last = i + 1
+		} else if i > last && unicode.IsDigit(c) != unicode.IsDigit(rune(v[i-1])) {
+			components = append(components, v[last:i])
+			last = i
+		}
+	}
+	if last < len(v) {
+		components = append(components, v[last:])
+	}
+	return components
+}
+
+func compareComponent(a, b string) int {
+	ai, aErr := strconv.Atoi(a)
+	bi, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		switch {
+		case ai < bi:
+			return -1
+		case ai > bi:
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		if infinityIndex(b) >= 0 {
+			return -1
+		}
+		return 1
+	case bErr == nil:
+		if infinityIndex(a) >= 0 {
+			return 1
+		}
+		return -1
+	}
+	if ai, bi := infinityIndex(a), infinityIndex(b); ai != bi {
+		if ai < bi {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func infinityIndex(c string) int {
+	for i, v := range infinityVersions {
+		if v == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// versionHasPrefix returns true when every component of prefix matches the
+// start of v, which is how Spack treats the upper bound of a range.
+func versionHasPrefix(v, prefix string) bool {
+	vc, pc := versionComponents(v), versionComponents(prefix)
+	if len(pc) > len(vc) {
+		return false
+	}
+	for i := range pc {
+		if compareComponent(vc[i], pc[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
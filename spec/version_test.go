@@ -0,0 +1,76 @@
+package spec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for n, test := range [...]struct {
+		a, b     string
+		expected int
+	}{
+		{"1.9", "1.9", 0},
+		{"1.9", "1.10", -1},
+		{"1.10", "1.9", 1},
+		{"1.0-56", "1.0-6", 1},
+		{"1.0", "1.0.1", -1},
+		{"2.0a", "2.0", 1},
+		{"2.0a", "2.0.1", -1},
+		{"develop", "99.0", 1},
+		{"main", "develop", -1},
+	} {
+		if got := CompareVersions(test.a, test.b); got != test.expected {
+			t.Errorf("Test %d: CompareVersions(%q, %q) = %d, want %d", n+1, test.a, test.b, got, test.expected)
+		}
+	}
+}
+
+func TestVersionListIncludes(t *testing.T) {
+	for n, test := range [...]struct {
+		versions, version string
+		included          bool
+	}{
+		{"1.9:", "1.10", true},
+		{"1.9:", "1.8", false},
+		{":1.9", "1.9.3", true},
+		{":1.9", "1.10", false},
+		{"1.2:1.4,2:", "1.5", false},
+		{"1.2:1.4,2:", "2.1", true},
+		{"1.9", "1.9.1", true},
+		{"=1.9", "1.9.1", false},
+		{"=1.9", "1.9", true},
+	} {
+		l, ok := parseVersionList(test.versions)
+		if !ok {
+			t.Fatalf("Test %d: failed to parse %q", n+1, test.versions)
+		}
+		if got := l.Includes(test.version); got != test.included {
+			t.Errorf("Test %d: %q includes %q = %v, want %v", n+1, test.versions, test.version, got, test.included)
+		}
+	}
+}
+
+func TestVersionListIntersect(t *testing.T) {
+	for n, test := range [...]struct {
+		a, b, expected string
+	}{
+		{":1.9", ":2.0", ":1.9"},
+		{"1.0:", ":2.0", "1.0:2.0"},
+		{"1.0:1.5,3:", "1.2:4", "1.2:1.5,3:4"},
+		{"=1.5", "1:", "=1.5"},
+		{"1.9", "1.9", "1.9"},
+		{"1.9", ":1", "1.9:1"},
+		{"1.9", ":1.5", ""},
+	} {
+		a, _ := parseVersionList(test.a)
+		b, _ := parseVersionList(test.b)
+		var expected VersionList
+		if test.expected != "" {
+			expected, _ = parseVersionList(test.expected)
+		}
+		if got := a.Intersect(b); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Test %d: %q intersect %q = %q, want %q", n+1, test.a, test.b, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package tokeniser
+
+const tabSize = 8
+
+type indentLevel struct {
+	col, altCol int
+}
+
+// indenter tracks the indentation of logical lines in a token stream, adding
+// Indent and Dedent tokens where it changes. Blank and comment-only lines
+// don't affect indentation, and neither do lines continued inside brackets,
+// as those produce Whitespace rather than Newline tokens.
+type indenter struct {
+	stack       []indentLevel
+	atLineStart bool
+	pending     *Token
+}
+
+func newIndenter() *indenter {
+	return &indenter{stack: []indentLevel{{}}, atLineStart: true}
+}
+
+// next returns the tokens to emit for the given one. If the indentation is
+// wrong it returns an error, along with the tokens to emit if the line's
+// indentation is to be ignored.
+func (in *indenter) next(token Token) ([]Token, *Error) {
+	if !in.atLineStart {
+		in.atLineStart = token.Type == TokenNewline
+		return []Token{token}, nil
+	}
+	switch token.Type {
+	case TokenWhitespace:
+		if in.pending == nil {
+			in.pending = &token
+			return nil, nil
+		}
+		return in.flush(token), nil
+	case TokenNewline, TokenComment:
+		return in.flush(token), nil
+	}
+	in.atLineStart = false
+
+	var whitespace string
+	if in.pending != nil {
+		whitespace = in.pending.Val
+	}
+	level := measureIndent(whitespace)
+	top := in.stack[len(in.stack)-1]
+	switch {
+	case level.col == top.col:
+		if level.altCol != top.altCol {
+			return in.flush(token), inconsistentIndent(token)
+		}
+		return in.flush(token), nil
+	case level.col > top.col:
+		if level.altCol <= top.altCol {
+			return in.flush(token), inconsistentIndent(token)
+		}
+		in.stack = append(in.stack, level)
+		indent := *in.pending
+		indent.Type = TokenIndent
+		in.pending = nil
+		return []Token{indent, token}, nil
+	}
+
+	tokens := in.flush()
+	for level.col < in.stack[len(in.stack)-1].col {
+		in.stack = in.stack[:len(in.stack)-1]
+		tokens = append(tokens, Token{Type: TokenDedent, Pos: token.Pos})
+	}
+	tokens = append(tokens, token)
+	if top := in.stack[len(in.stack)-1]; level.col != top.col {
+		return tokens, &Error{Pos: token.Pos, Msg: "unindent does not match any outer indentation level"}
+	} else if level.altCol != top.altCol {
+		return tokens, inconsistentIndent(token)
+	}
+	return tokens, nil
+}
+
+// flush returns any held back leading whitespace followed by the given
+// tokens.
+func (in *indenter) flush(tokens ...Token) []Token {
+	if in.pending == nil {
+		return tokens
+	}
+	pending := *in.pending
+	in.pending = nil
+	return append([]Token{pending}, tokens...)
+}
+
+// done closes any blocks still open at the end of the input.
+func (in *indenter) done(pos Position) []Token {
+	tokens := in.flush()
+	for len(in.stack) > 1 {
+		in.stack = in.stack[:len(in.stack)-1]
+		tokens = append(tokens, Token{Type: TokenDedent, Pos: pos})
+	}
+	return tokens
+}
+
+// measureIndent returns the width of leading whitespace, both with tabs
+// expanded to the next multiple of eight and with tabs counting as a single
+// column. Lines only agree on indentation if both widths agree.
+func measureIndent(whitespace string) indentLevel {
+	var level indentLevel
+	for _, c := range whitespace {
+		switch c {
+		case ' ':
+			level.col++
+			level.altCol++
+		case '\t':
+			level.col = (level.col/tabSize + 1) * tabSize
+			level.altCol++
+		case '\f':
+			level = indentLevel{}
+		}
+	}
+	return level
+}
+
+func inconsistentIndent(token Token) *Error {
+	return &Error{Pos: token.Pos, Msg: "inconsistent use of tabs and spaces in indentation"}
+}
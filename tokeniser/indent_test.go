@@ -0,0 +1,131 @@
+package tokeniser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
+)
+
+func TestIndents(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  string
+		Tokens []Token
+	}{
+		{ // 1
+			"class A:\n\tx = 1\n\n\tdef f():\n\t\tpass\ny\n",
+			[]Token{
+				{Val: "class", Type: TokenKeyword},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "A", Type: TokenIdentifier},
+				{Val: ":", Type: TokenDelimiter},
+				{Val: "\n", Type: TokenNewline},
+				{Val: "\t", Type: TokenIndent},
+				{Val: "x", Type: TokenIdentifier},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "=", Type: TokenDelimiter},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "1", Type: TokenNumber},
+				{Val: "\n\n", Type: TokenNewline},
+				{Val: "\t", Type: TokenWhitespace},
+				{Val: "def", Type: TokenKeyword},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "f", Type: TokenIdentifier},
+				{Val: "(", Type: TokenDelimiter},
+				{Val: ")", Type: TokenDelimiter},
+				{Val: ":", Type: TokenDelimiter},
+				{Val: "\n", Type: TokenNewline},
+				{Val: "\t\t", Type: TokenIndent},
+				{Val: "pass", Type: TokenKeyword},
+				{Val: "\n", Type: TokenNewline},
+				{Val: "", Type: TokenDedent},
+				{Val: "", Type: TokenDedent},
+				{Val: "y", Type: TokenIdentifier},
+				{Val: "\n", Type: TokenNewline},
+			},
+		},
+		{ // 2
+			"if a:\n    b(\n  c,\n)\n  # comment\n\n    \n    d\n",
+			[]Token{
+				{Val: "if", Type: TokenKeyword},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "a", Type: TokenIdentifier},
+				{Val: ":", Type: TokenDelimiter},
+				{Val: "\n", Type: TokenNewline},
+				{Val: "    ", Type: TokenIndent},
+				{Val: "b", Type: TokenIdentifier},
+				{Val: "(", Type: TokenDelimiter},
+				{Val: "\n  ", Type: TokenWhitespace},
+				{Val: "c", Type: TokenIdentifier},
+				{Val: ",", Type: TokenDelimiter},
+				{Val: "\n", Type: TokenWhitespace},
+				{Val: ")", Type: TokenDelimiter},
+				{Val: "\n", Type: TokenNewline},
+				{Val: "  ", Type: TokenWhitespace},
+				{Val: "# comment", Type: TokenComment},
+				{Val: "\n\n", Type: TokenNewline},
+				{Val: "    ", Type: TokenWhitespace},
+				{Val: "\n", Type: TokenNewline},
+				{Val: "    ", Type: TokenWhitespace},
+				{Val: "d", Type: TokenIdentifier},
+				{Val: "\n", Type: TokenNewline},
+				{Val: "", Type: TokenDedent},
+			},
+		},
+	} {
+		tokens, err := TokeniseMode(test.Input, EmitIndents)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+		} else if !reflect.DeepEqual(stripPositions(tokens), test.Tokens) {
+			t.Errorf("Test %d: got %v, want %v", n+1, tokens, test.Tokens)
+		}
+	}
+}
+
+func TestIndentErrors(t *testing.T) {
+	for n, test := range [...]struct {
+		input    string
+		expected string
+	}{
+		{"if a:\n    b\n  c\n", "3:3: unindent does not match any outer indentation level"},
+		{"if a:\n\tb\n        c\n", "3:9: inconsistent use of tabs and spaces in indentation"},
+		{"if a:\n  \tb\n\t\tc\n", "3:3: inconsistent use of tabs and spaces in indentation"},
+	} {
+		_, err := TokeniseMode(test.input, EmitIndents)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Test %d: expected error %q, got %v", n+1, test.expected, err)
+		}
+	}
+}
+
+func TestIndentsRecipe(t *testing.T) {
+	plain, err := Tokenise(testdata.TestRecipe1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := TokeniseMode(testdata.TestRecipe1, EmitIndents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var depth, maxDepth int
+	var joined, plainJoined string
+	for _, token := range tokens {
+		switch token.Type {
+		case TokenIndent:
+			depth++
+			maxDepth = max(maxDepth, depth)
+		case TokenDedent:
+			depth--
+		}
+		joined += token.Val
+	}
+	for _, token := range plain {
+		plainJoined += token.Val
+	}
+	if depth != 0 || maxDepth != 2 {
+		t.Errorf("expected balanced indentation two levels deep, got depth %d, max %d", depth, maxDepth)
+	}
+	if joined != plainJoined {
+		t.Error("indent mode changed the text of the tokens")
+	}
+}
@@ -0,0 +1,173 @@
+package tokeniser
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrNotString    = errors.New("not a string literal")
+	ErrFormatString = errors.New("f-strings have no constant value")
+	ErrNamedEscape  = errors.New(`\N{...} escapes can't be decoded without the Unicode character names`)
+)
+
+// Unquote returns the value of a Python string or bytes literal, as written in
+// the source: with any prefix, in single, double or triple quotes, and with
+// escape sequences that are interpreted unless the literal is raw. Line
+// endings inside the literal become "\n", as they do when Python reads a file.
+// A literal with a named escape, \N{...}, returns ErrNamedEscape, as its value
+// isn't known.
+func Unquote(s string) (string, error) {
+	prefixEnd := strings.IndexAny(s, "\"'")
+	if prefixEnd < 0 {
+		return "", ErrNotString
+	}
+	prefix := strings.ToLower(s[:prefixEnd])
+	if !isStringPrefix(prefix) && prefix != "" {
+		return "", ErrNotString
+	}
+	if strings.Contains(prefix, "f") {
+		return "", ErrFormatString
+	}
+	delim := s[prefixEnd : prefixEnd+1]
+	if long := strings.Repeat(delim, 3); len(s) >= prefixEnd+6 && strings.HasPrefix(s[prefixEnd:], long) {
+		delim = long
+	}
+	body, ok := strings.CutPrefix(s[prefixEnd:], delim)
+	if ok {
+		body, ok = strings.CutSuffix(body, delim)
+	}
+	if !ok {
+		return "", ErrNotString
+	}
+	body = normaliseNewlines(body)
+	bytes := strings.Contains(prefix, "b")
+	if bytes {
+		for i := 0; i < len(body); i++ {
+			if body[i] >= utf8.RuneSelf {
+				return "", errors.New("bytes can only contain ASCII literal characters")
+			}
+		}
+	}
+	if strings.Contains(prefix, "r") {
+		return body, nil
+	}
+	return unescape(body, bytes)
+}
+
+func normaliseNewlines(s string) string {
+	if !strings.Contains(s, "\r") {
+		return s
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+}
+
+var simpleEscapes = map[byte]byte{
+	'\\': '\\', '\'': '\'', '"': '"', 'a': '\a', 'b': '\b',
+	'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v',
+}
+
+// unescape interprets the escape sequences in the body of a literal. As in
+// Python, unrecognised escapes are left as they are.
+func unescape(s string, bytes bool) (string, error) {
+	var sb strings.Builder
+	for {
+		i := strings.IndexByte(s, '\\')
+		if i < 0 || i == len(s)-1 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+		sb.WriteString(s[:i])
+		c := s[i+1]
+		s = s[i+2:]
+		if e, ok := simpleEscapes[c]; ok {
+			sb.WriteByte(e)
+			continue
+		}
+		switch {
+		case c == '\n':
+		case c >= '0' && c <= '7':
+			digits := string(c)
+			for len(digits) < 3 && len(s) > 0 && s[0] >= '0' && s[0] <= '7' {
+				digits += s[:1]
+				s = s[1:]
+			}
+			v, _ := strconv.ParseUint(digits, 8, 16)
+			if err := writeCode(&sb, rune(v), bytes); err != nil {
+				return "", err
+			}
+		case c == 'x' || (!bytes && (c == 'u' || c == 'U')):
+			n := 2
+			if c == 'u' {
+				n = 4
+			} else if c == 'U' {
+				n = 8
+			}
+			var v uint64
+			var err error
+			if len(s) >= n {
+				v, err = strconv.ParseUint(s[:n], 16, 32)
+			}
+			if len(s) < n || err != nil {
+				return "", errors.New(`truncated \` + string(c) + " escape")
+			}
+			s = s[n:]
+			if err := writeCode(&sb, rune(v), bytes); err != nil {
+				return "", err
+			}
+		case c == 'N' && !bytes:
+			end := strings.IndexByte(s, '}')
+			if !strings.HasPrefix(s, "{") || end < 2 {
+				return "", errors.New(`malformed \N character escape`)
+			}
+			return "", ErrNamedEscape
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		}
+	}
+}
+
+func writeCode(sb *strings.Builder, r rune, bytes bool) error {
+	if bytes {
+		if r > 0xff {
+			return errors.New("octal escape out of range for bytes")
+		}
+		sb.WriteByte(byte(r))
+		return nil
+	}
+	if r > utf8.MaxRune {
+		return errors.New("illegal Unicode character")
+	}
+	sb.WriteRune(r)
+	return nil
+}
+
+// Quote returns s as a Python string literal in the given quote character,
+// ' or ".
+func Quote(s string, quote byte) string {
+	var sb strings.Builder
+	sb.WriteByte(quote)
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == rune(quote):
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r < ' ' || r == 0x7f:
+			sb.WriteString(`\x`)
+			sb.WriteString(strconv.FormatUint(uint64(r)|0x100, 16)[1:])
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte(quote)
+	return sb.String()
+}
@@ -0,0 +1,71 @@
+package tokeniser
+
+import "testing"
+
+func TestUnquote(t *testing.T) {
+	for n, test := range [...]struct {
+		input, value, err string
+	}{
+		{`"1.9"`, "1.9", ""},
+		{`'a"b'`, `a"b`, ""},
+		{`""`, "", ""},
+		{`""""""`, "", ""},
+		{`"""a"b""c"""`, `a"b""c`, ""},
+		{"'''a\r\nb\rc'''", "a\nb\nc", ""},
+		{`"a\tb\\c\'d\"e\nf"`, "a\tb\\c'd\"e\nf", ""},
+		{`"\x41\101\7\0é\U0001F600"`, "AA\a\x00é😀", ""},
+		{"\"a\\\nb\"", "ab", ""},
+		{`"\d\("`, `\d\(`, ""},
+		{`r"\d\n\""`, `\d\n\"`, ""},
+		{`Rb'\x41'`, `\x41`, ""},
+		{`b"\x41A"`, `AA`, ""},
+		{`u"A"`, "A", ""},
+		{`f"{a}"`, "", "f-strings have no constant value"},
+		{`abc`, "", "not a string literal"},
+		{`x"a"`, "", "not a string literal"},
+		{`"a`, "", "not a string literal"},
+		{`"\x4"`, "", `truncated \x escape`},
+		{`"\u12G4"`, "", `truncated \u escape`},
+		{`"a\N{EN DASH}b"`, "", `\N{...} escapes can't be decoded without the Unicode character names`},
+		{`"a\\N{EN DASH}b"`, `a\N{EN DASH}b`, ""},
+		{`r"a\N{EN DASH}b"`, `a\N{EN DASH}b`, ""},
+		{`b"\N{EN DASH}"`, `\N{EN DASH}`, ""},
+		{`"\N{}"`, "", `malformed \N character escape`},
+		{`"\N"`, "", `malformed \N character escape`},
+		{`b"é"`, "", "bytes can only contain ASCII literal characters"},
+		{`"\U00110000"`, "", "illegal Unicode character"},
+	} {
+		value, err := Unquote(test.input)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Test %d: expected error %q, got %v", n+1, test.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+		} else if value != test.value {
+			t.Errorf("Test %d: expected value %q, got %q", n+1, test.value, value)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for n, test := range [...]struct {
+		input string
+		quote byte
+		out   string
+	}{
+		{"1.9", '"', `"1.9"`},
+		{"1.9", '\'', `'1.9'`},
+		{`a"b'c\d`, '"', `"a\"b'c\\d"`},
+		{`a"b'c`, '\'', `'a"b\'c'`},
+		{"a\nb\tc\x00é", '"', `"a\nb\tc\x00é"`},
+		{`a\N{EN DASH}\N`, '"', `"a\\N{EN DASH}\\N"`},
+	} {
+		out := Quote(test.input, test.quote)
+		if out != test.out {
+			t.Errorf("Test %d: expected %s, got %s", n+1, test.out, out)
+		} else if value, err := Unquote(out); err != nil || value != test.input {
+			t.Errorf("Test %d: round trip gave %q, %v", n+1, value, err)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package tokeniser
 
 import (
-	"errors"
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"regexp"
 	"slices"
 	"strings"
 	"unicode"
@@ -11,12 +15,106 @@ import (
 type Token struct {
 	Val  string
 	Type TokenType
+	Pos  Position
+}
+
+// Is reports whether the token has the given type and value, regardless of
+// where it is.
+func (t Token) Is(tokenType TokenType, val string) bool {
+	return t.Type == tokenType && t.Val == val
+}
+
+// End returns the position immediately after the token.
+func (t Token) End() Position {
+	end := t.Pos
+	end.Offset += len(t.Val)
+	if lines, lineStart := lineBreaks(t.Val); lines > 0 {
+		end.Line += lines
+		end.Column = len(t.Val) - lineStart + 1
+	} else {
+		end.Column += len(t.Val)
+	}
+	return end
+}
+
+// lineBreaks counts the line breaks in s, treating "\r\n" as a single break,
+// and returns the offset of the start of the last line.
+func lineBreaks(s string) (int, int) {
+	var lines, lineStart int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\r':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+		case '\n':
+		default:
+			continue
+		}
+		lines++
+		lineStart = i + 1
+	}
+	return lines, lineStart
+}
+
+// Position is the location of a token in the input. Line and Column start at
+// 1, and Column counts bytes.
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Error is an error at a position in the input.
+type Error struct {
+	Pos Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// ErrorList is a list of errors in the order they were found.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
 }
 
 type Tokeniser struct {
-	input   string
-	pos     int
-	lastPos int
+	input       string
+	reader      *bufio.Reader
+	readErr     error
+	offset      int
+	pos         int
+	lastPos     int
+	line        int
+	lineStart   int
+	brackets    []bracket
+	state       tokenFunc
+	indenter    *indenter
+	tolerant    bool
+	cuts        []int
+	unclosed    *Position
+	diagnostics []*Error
+	queue       []Token
+	err         error
+}
+
+type bracket struct {
+	char byte
+	pos  Position
 }
 
 type tokenFunc func(*Tokeniser) (Token, tokenFunc)
@@ -43,6 +141,10 @@ func (t TokenType) String() string {
 		return "Operator"
 	case TokenDelimiter:
 		return "Delimiter"
+	case TokenIndent:
+		return "Indent"
+	case TokenDedent:
+		return "Dedent"
 	case TokenDone:
 		return "Done"
 	case TokenError:
@@ -62,66 +164,304 @@ const (
 	TokenComment
 	TokenOperator
 	TokenDelimiter
+	TokenIndent
+	TokenDedent
 	TokenDone  TokenType = -1
 	TokenError TokenType = -2
 )
 
 const whiteSpace = " \t\f"
-const newLine = "\n"
+const newLine = "\r\n"
+const byteOrderMark = "\uFEFF"
 const decimal = "0123456789"
 const hexadecimal = "0123456789abcdefABCDEF"
 const octal = "01234567"
 const binary = "01"
 
+// keywords are the hard keywords of Python 3.12. The soft keywords match,
+// case, type and _ are only keywords in some contexts, and so, as in CPython's
+// tokenize module, they are tokenised as identifiers.
 var keywords = [...]string{"False", "await", "else", "import", "pass", "None", "break", "except", "in", "raise", "True", "class", "finally", "is", "return", "and", "continue", "for", "lambda", "try", "as", "def", "from", "nonlocal", "while", "assert", "del", "global", "not", "with", "async", "elif", "if", "or", "yield"}
 
-var bracketStack []byte
+var codingPattern = regexp.MustCompile(`^[ \t\f]*#.*?coding[:=][ \t]*([-\w.]+)`)
 
 var id_start = []*unicode.RangeTable{unicode.Other_ID_Start, unicode.Lu, unicode.Ll, unicode.Lt, unicode.Lm, unicode.Lo, unicode.Nl}
 var id_continue = append(id_start, unicode.Other_ID_Continue, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc)
 
+// Mode is a set of flags that change how input is tokenised.
+type Mode uint
+
+const (
+	// EmitIndents adds Indent and Dedent tokens around indented blocks, in
+	// the way CPython's tokenize module does. The leading whitespace of a line
+	// that opens a block becomes the Indent token.
+	EmitIndents Mode = 1 << iota
+
+	// Tolerant turns the text from a syntax error to the end of its line into
+	// an Error token, records the error, and carries on from the next line,
+	// so that the whole input is tokenised. Only a failure to read is fatal.
+	Tolerant
+)
+
 func Tokenise(input string) ([]Token, error) {
-	state := stateStart
-	t := Tokeniser{input: input}
+	return TokeniseMode(input, 0)
+}
+
+// TokeniseMode tokenises the input in the given mode. In Tolerant mode it
+// returns every token, along with an ErrorList if there were any errors.
+func TokeniseMode(input string, mode Mode) ([]Token, error) {
+	t := New(input, mode)
 	var tokens []Token
 	for {
-		var token Token
-		token, state = state(&t)
-		if token.Type == TokenDone {
-			if len(bracketStack) != 0 {
-				return nil, errors.New("unmatched bracket")
-			}
-			return tokens, nil
-		} else if token.Type == TokenError {
-			return nil, errors.New(token.Val)
+		token, err := t.NextToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
 		}
 		tokens = append(tokens, token)
 	}
+	if len(t.diagnostics) > 0 {
+		return tokens, ErrorList(t.diagnostics)
+	}
+	return tokens, nil
+}
+
+func New(input string, mode Mode) *Tokeniser {
+	t := &Tokeniser{input: input, line: 1}
+	t.setMode(mode)
+	return t
+}
+
+// NewReader returns a Tokeniser that reads its input from r a line at a time,
+// as tokens are requested, without holding on to the text of tokens it has
+// already returned.
+func NewReader(r io.Reader) *Tokeniser {
+	return NewReaderMode(r, 0)
+}
+
+func NewReaderMode(r io.Reader, mode Mode) *Tokeniser {
+	t := &Tokeniser{reader: bufio.NewReader(r), line: 1}
+	t.setMode(mode)
+	return t
+}
+
+func (t *Tokeniser) setMode(mode Mode) {
+	if mode&EmitIndents != 0 {
+		t.indenter = newIndenter()
+	}
+	t.tolerant = mode&Tolerant != 0
+}
+
+// Diagnostics returns the errors found so far in Tolerant mode.
+func (t *Tokeniser) Diagnostics() []*Error {
+	return t.diagnostics
+}
+
+// CloseBracketsAt has a Tolerant tokeniser report any brackets still open at
+// each of the offsets, which are those of line endings in increasing order, as
+// unmatched and carry on from there as if they had been closed, rather than
+// taking the rest of the input to be inside them. It must be called before
+// tokenising starts.
+func (t *Tokeniser) CloseBracketsAt(offsets ...int) {
+	t.cuts = append(t.cuts, offsets...)
+}
+
+// Unclosed returns the position of the outermost bracket that was still open
+// at the end of the input, if there was one.
+func (t *Tokeniser) Unclosed() (Position, bool) {
+	if t.unclosed == nil {
+		return Position{}, false
+	}
+	return *t.unclosed, true
+}
+
+// NextToken returns the next token in the input, or io.EOF when there are no
+// more. Once an error has been returned, every later call returns it again.
+func (t *Tokeniser) NextToken() (Token, error) {
+	for len(t.queue) == 0 {
+		if t.err != nil {
+			return Token{}, t.err
+		}
+		t.advance()
+	}
+	token := t.queue[0]
+	t.queue = t.queue[1:]
+	return token, nil
+}
+
+// All returns an iterator over the remaining tokens. The iteration stops after
+// the first error.
+func (t *Tokeniser) All() iter.Seq2[Token, error] {
+	return func(yield func(Token, error) bool) {
+		for {
+			token, err := t.NextToken()
+			if err == io.EOF || !yield(token, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// advance runs the state machine until it produces a token, queueing it along
+// with any Indent or Dedent tokens, or sets the error to return. A failure to
+// read takes precedence over whatever error the truncated input caused.
+func (t *Tokeniser) advance() {
+	if t.state == nil {
+		t.state = stateStart
+		if err := t.checkEncoding(); err != nil {
+			t.err = err
+			return
+		}
+	}
+	var token Token
+	token, t.state = t.state(t)
+	if (token.Type == TokenDone || token.Type == TokenError) && t.readErr != nil && t.readErr != io.EOF {
+		t.err = t.readErr
+		return
+	}
+	switch token.Type {
+	case TokenDone:
+		if len(t.brackets) != 0 {
+			t.unclosed = &t.brackets[0].pos
+			if !t.fail(&Error{Pos: t.brackets[len(t.brackets)-1].pos, Msg: "unmatched bracket"}) {
+				return
+			}
+		}
+		if t.indenter != nil {
+			t.queue = append(t.queue, t.indenter.done(token.Pos)...)
+		}
+		t.err = io.EOF
+	case TokenError:
+		if t.fail(&Error{Pos: token.Pos, Msg: token.Val}) {
+			t.resync()
+		}
+	default:
+		t.emit(token)
+	}
+}
+
+// emit queues a token, and any Indent or Dedent tokens that go with it.
+func (t *Tokeniser) emit(token Token) {
+	if t.indenter == nil {
+		t.queue = append(t.queue, token)
+		return
+	}
+	emitted, err := t.indenter.next(token)
+	if err != nil && !t.fail(err) {
+		return
+	}
+	t.queue = append(t.queue, emitted...)
+}
+
+// fail records an error, and reports whether tokenising can carry on.
+func (t *Tokeniser) fail(err *Error) bool {
+	if !t.tolerant {
+		t.err = err
+		return false
+	}
+	t.diagnostics = append(t.diagnostics, err)
+	return true
+}
+
+// resync skips from the start of a bad token to the end of its line, which it
+// emits as an Error token, and forgets any open brackets.
+func (t *Tokeniser) resync() {
+	t.ExceptRun(newLine)
+	t.brackets = nil
+	t.state = stateStart
+	t.emit(t.token(TokenError))
+}
+
+// more reports whether there's any input left, reading another line from the
+// reader if everything read so far has been consumed.
+func (t *Tokeniser) more() bool {
+	if t.pos < len(t.input) {
+		return true
+	}
+	if t.reader == nil || t.readErr != nil {
+		return false
+	}
+	line, err := t.reader.ReadString('\n')
+	t.input += line
+	t.readErr = err
+	return t.pos < len(t.input)
+}
+
+// checkEncoding skips any UTF-8 byte order mark, and checks that a PEP 263
+// coding declaration in the first two lines, if there is one, is for UTF-8.
+func (t *Tokeniser) checkEncoding() error {
+	for line := 0; line < 2; line++ {
+		t.pos = len(t.input)
+		t.more()
+	}
+	t.pos = 0
+	if strings.HasPrefix(t.input, byteOrderMark) {
+		t.pos = len(byteOrderMark)
+		t.lastPos = t.pos
+		t.lineStart = t.pos
+	}
+	lineStart := t.pos
+	for line := 1; line <= 2 && lineStart < len(t.input); line++ {
+		text := t.input[lineStart:]
+		if end := strings.IndexAny(text, newLine); end >= 0 {
+			text = text[:end]
+		}
+		if m := codingPattern.FindStringSubmatchIndex(text); m != nil {
+			encoding := text[m[2]:m[3]]
+			if !isUTF8(encoding) {
+				return &Error{
+					Pos: Position{Offset: lineStart + m[2], Line: line, Column: m[2] + 1},
+					Msg: fmt.Sprintf("unsupported encoding %q: only UTF-8 is supported", encoding),
+				}
+			}
+			return nil
+		}
+		if trimmed := strings.TrimLeft(text, whiteSpace); trimmed != "" && trimmed[0] != '#' {
+			return nil
+		}
+		lineStart += len(text)
+		if strings.HasPrefix(t.input[lineStart:], "\r\n") {
+			lineStart += 2
+		} else {
+			lineStart++
+		}
+	}
+	return nil
+}
+
+func isUTF8(encoding string) bool {
+	encoding = strings.ReplaceAll(strings.ToLower(encoding), "_", "-")
+	return encoding == "utf-8" || encoding == "utf8" || strings.HasPrefix(encoding, "utf-8-")
 }
 
 func stateStart(t *Tokeniser) (Token, tokenFunc) {
+	if len(t.brackets) != 0 && t.atCut() {
+		t.fail(&Error{Pos: t.brackets[len(t.brackets)-1].pos, Msg: "unmatched bracket"})
+		t.brackets = nil
+	}
 	if t.Accept(whiteSpace) {
-		if len(bracketStack) == 0 {
+		if len(t.brackets) == 0 {
 			t.AcceptRun(whiteSpace)
 		} else {
-			t.AcceptRun(whiteSpace + newLine)
+			t.acceptBracketedSpace()
 		}
-		return Token{t.Get(), TokenWhitespace}, stateStart
+		return t.token(TokenWhitespace), stateStart
 	}
 	if t.Accept("\\") {
-		if t.Accept(newLine) {
-			return Token{t.Get(), TokenWhitespace}, stateStart
+		if t.acceptNewline() {
+			return t.token(TokenWhitespace), stateStart
 		} else {
 			return t.stateError("invalid backslash: no following newline")
 		}
 	}
 	if t.Accept(newLine) {
-		if len(bracketStack) == 0 {
+		if len(t.brackets) == 0 {
 			t.AcceptRun(newLine)
-			return Token{t.Get(), TokenNewline}, stateStart
+			return t.token(TokenNewline), stateStart
 		} else {
-			t.AcceptRun(whiteSpace + newLine)
-			return Token{t.Get(), TokenWhitespace}, stateStart
+			t.acceptBracketedSpace()
+			return t.token(TokenWhitespace), stateStart
 		}
 	}
 	if c := t.Peek(); t.Accept("rRuUfFbB") {
@@ -140,30 +480,33 @@ func stateStart(t *Tokeniser) (Token, tokenFunc) {
 		if strings.ContainsRune(decimal, t.Peek()) {
 			return t.float()
 		}
-		return Token{t.Get(), TokenDelimiter}, stateStart
+		if strings.HasPrefix(t.input[t.pos:], "..") {
+			t.pos += 2
+		}
+		return t.token(TokenDelimiter), stateStart
 	}
 	if c := t.Peek(); t.Accept("\"'") {
-		return t.string(c)
+		return t.string(c, "")
 	}
 	if t.Accept("#") {
-		t.ExceptRun("\n")
-		return Token{t.Get(), TokenComment}, stateStart
+		t.ExceptRun(newLine)
+		return t.token(TokenComment), stateStart
 	}
 
 	return t.operator()
 }
 
 func stateDone(t *Tokeniser) (Token, tokenFunc) {
-	return Token{"", TokenDone}, stateDone
+	return Token{Val: "", Type: TokenDone, Pos: t.position()}, stateDone
 }
 func (t *Tokeniser) stateError(err string) (Token, tokenFunc) {
-	return Token{err, TokenError}, stateDone
+	return Token{Val: err, Type: TokenError, Pos: t.position()}, stateDone
 }
 
 // Accept consumes the next rune if it's in the input string.
 // Input string is a set of (unordered) characters that are accepted.
 func (t *Tokeniser) Accept(input string) bool {
-	if t.pos >= len(t.input) {
+	if !t.more() {
 		return false
 	}
 	char, size := utf8.DecodeRuneInString(t.input[t.pos:])
@@ -181,7 +524,7 @@ func (t *Tokeniser) AcceptRun(input string) rune {
 }
 
 func (t *Tokeniser) Except(input string) bool {
-	if t.pos >= len(t.input) {
+	if !t.more() {
 		return false
 	}
 	char, size := utf8.DecodeRuneInString(t.input[t.pos:])
@@ -199,7 +542,7 @@ func (t *Tokeniser) ExceptRun(input string) rune {
 }
 
 func (t *Tokeniser) Peek() rune {
-	if t.pos >= len(t.input) {
+	if !t.more() {
 		return 0
 	}
 	char, _ := utf8.DecodeRuneInString(t.input[t.pos:])
@@ -209,11 +552,59 @@ func (t *Tokeniser) Peek() rune {
 func (t *Tokeniser) Get() string {
 	lastPos := t.lastPos
 	t.lastPos = t.pos
-	return t.input[lastPos:t.pos]
+	val := t.input[lastPos:t.pos]
+	if lines, lineStart := lineBreaks(val); lines > 0 {
+		t.line += lines
+		t.lineStart = t.offset + lastPos + lineStart
+	}
+	if t.reader != nil {
+		t.offset += t.pos
+		t.input = t.input[t.pos:]
+		t.pos, t.lastPos = 0, 0
+	}
+	return val
+}
+
+// atCut reports whether a Tolerant tokeniser is at an offset it closes
+// brackets at, forgetting those it has passed.
+func (t *Tokeniser) atCut() bool {
+	offset := t.offset + t.pos
+	for len(t.cuts) > 0 && t.cuts[0] < offset {
+		t.cuts = t.cuts[1:]
+	}
+	return t.tolerant && len(t.cuts) > 0 && t.cuts[0] == offset
+}
+
+// acceptBracketedSpace consumes whitespace and line endings inside brackets,
+// stopping at any offset that brackets are closed at.
+func (t *Tokeniser) acceptBracketedSpace() {
+	for !t.atCut() && t.Accept(whiteSpace+newLine) {
+	}
+}
+
+// acceptNewline consumes a single line ending, which may be "\n", "\r\n" or
+// "\r".
+func (t *Tokeniser) acceptNewline() bool {
+	if t.Accept("\r") {
+		t.Accept("\n")
+		return true
+	}
+	return t.Accept("\n")
+}
+
+// position returns the position of the start of the token being read.
+func (t *Tokeniser) position() Position {
+	offset := t.offset + t.lastPos
+	return Position{Offset: offset, Line: t.line, Column: offset - t.lineStart + 1}
+}
+
+func (t *Tokeniser) token(tokenType TokenType) Token {
+	pos := t.position()
+	return Token{Val: t.Get(), Type: tokenType, Pos: pos}
 }
 
 func (t *Tokeniser) Next() rune {
-	if t.pos >= len(t.input) {
+	if !t.more() {
 		return 0
 	}
 	char, size := utf8.DecodeRuneInString(t.input[t.pos:])
@@ -224,7 +615,7 @@ func (t *Tokeniser) Next() rune {
 func (t *Tokeniser) idStart() bool {
 	char := t.Peek()
 
-	if !unicode.In(char, id_start...) {
+	if char != '_' && !unicode.In(char, id_start...) {
 		return false
 	}
 	t.Next()
@@ -251,7 +642,7 @@ func (t *Tokeniser) decimalNumber() (Token, tokenFunc) {
 	if !t.exponent() {
 		return t.stateError("invalid exponent")
 	}
-	return Token{t.Get(), TokenNumber}, stateStart
+	return t.token(TokenNumber), stateStart
 }
 
 func (t *Tokeniser) number() (Token, tokenFunc) {
@@ -268,18 +659,16 @@ func (t *Tokeniser) number() (Token, tokenFunc) {
 		return t.stateError("bad number")
 	}
 	if digits == "0" {
+		t.acceptNumeric(decimal)
 		if t.Accept(".") {
 			return t.float()
 		}
-		if t.acceptNumeric(decimal) {
-			switch t.Peek() {
-			case 'e', 'E':
-				t.exponent()
-			}
+		if !t.exponent() {
+			return t.stateError("invalid exponent")
 		}
 	}
 
-	return Token{t.Get(), TokenNumber}, stateStart
+	return t.token(TokenNumber), stateStart
 }
 
 func (t *Tokeniser) acceptNumeric(digits string) bool {
@@ -300,7 +689,7 @@ func (t *Tokeniser) float() (Token, tokenFunc) {
 	if !t.exponent() {
 		return t.stateError("bad exponent")
 	}
-	return Token{t.Get(), TokenNumber}, stateStart
+	return t.token(TokenNumber), stateStart
 }
 
 func (t *Tokeniser) exponent() bool {
@@ -326,7 +715,7 @@ func (t *Tokeniser) operator() (Token, tokenFunc) {
 		}
 	case '-':
 		t.Next()
-		if t.Accept(">=") {
+		if t.Accept("=>") {
 			tokenType = TokenDelimiter
 		}
 	case '*', '/', '<', '>':
@@ -349,28 +738,28 @@ func (t *Tokeniser) operator() (Token, tokenFunc) {
 		t.Next()
 	case '(', '{', '[':
 		t.Next()
-		bracketStack = append(bracketStack, byte(c))
+		t.brackets = append(t.brackets, bracket{byte(c), t.position()})
 		tokenType = TokenDelimiter
 	case ')':
 		t.Next()
-		if len(bracketStack) == 0 || bracketStack[len(bracketStack)-1] != '(' {
+		if len(t.brackets) == 0 || t.brackets[len(t.brackets)-1].char != '(' {
 			return t.stateError("invalid bracket")
 		}
-		bracketStack = bracketStack[:len(bracketStack)-1]
+		t.brackets = t.brackets[:len(t.brackets)-1]
 		tokenType = TokenDelimiter
 	case ']':
 		t.Next()
-		if len(bracketStack) == 0 || bracketStack[len(bracketStack)-1] != '[' {
+		if len(t.brackets) == 0 || t.brackets[len(t.brackets)-1].char != '[' {
 			return t.stateError("invalid bracket")
 		}
-		bracketStack = bracketStack[:len(bracketStack)-1]
+		t.brackets = t.brackets[:len(t.brackets)-1]
 		tokenType = TokenDelimiter
 	case '}':
 		t.Next()
-		if len(bracketStack) == 0 || bracketStack[len(bracketStack)-1] != '{' {
+		if len(t.brackets) == 0 || t.brackets[len(t.brackets)-1].char != '{' {
 			return t.stateError("invalid bracket")
 		}
-		bracketStack = bracketStack[:len(bracketStack)-1]
+		t.brackets = t.brackets[:len(t.brackets)-1]
 		tokenType = TokenDelimiter
 
 	default:
@@ -380,53 +769,182 @@ func (t *Tokeniser) operator() (Token, tokenFunc) {
 
 		tokenType = TokenDelimiter
 	}
-	return Token{t.Get(), tokenType}, stateStart
+	return t.token(tokenType), stateStart
 }
 
-func (t *Tokeniser) string(d rune) (Token, tokenFunc) {
+func (t *Tokeniser) string(d rune, prefix string) (Token, tokenFunc) {
+	if err := t.scanString(d, prefix); err != "" {
+		return t.stateError(err)
+	}
+	return t.token(TokenString), stateStart
+}
+
+// scanString consumes the rest of a string whose opening quote, d, has been
+// read, and returns a description of any error. The prefix is lower case.
+func (t *Tokeniser) scanString(d rune, prefix string) string {
 	delim := string(d)
 	long := false
 	if t.Accept(delim) {
-		if t.Accept(delim) {
-			long = true
-		} else {
-			return Token{t.Get(), TokenString}, stateStart
+		if !t.Accept(delim) {
+			return ""
 		}
+		long = true
+	}
+	format := strings.Contains(prefix, "f")
+	raw := strings.Contains(prefix, "r")
+	checked := "\\" + newLine + delim
+	if format {
+		checked += "{}"
 	}
-	checked := "\\\n" + delim
-loop:
 	for {
-		c := t.ExceptRun(checked)
-		switch c {
+		switch t.ExceptRun(checked) {
 		case '\\':
 			t.Next()
-			t.Next()
-		case '\n':
+			if format && !raw && t.Accept("N") && t.Accept("{") {
+				if t.ExceptRun("}"+newLine+delim) != '}' {
+					return "invalid named escape"
+				}
+				t.Next()
+			} else if !t.acceptNewline() && !(format && strings.ContainsRune("{}", t.Peek())) {
+				t.Next()
+			}
+		case '\r', '\n':
 			if !long {
-				return t.stateError("newline in string")
+				return "newline in string"
+			}
+			t.Next()
+		case '{':
+			t.Next()
+			if !t.Accept("{") {
+				if err := t.replacementField(d, long); err != "" {
+					return err
+				}
 			}
+		case '}':
 			t.Next()
+			if !t.Accept("}") {
+				return "single '}' in f-string"
+			}
 		case d:
 			t.Next()
 			if long && (!t.Accept(delim) || !t.Accept(delim)) {
 				continue
 			}
-			break loop
+			return ""
+		default:
+			return "eof"
+		}
+	}
+}
+
+// replacementField consumes an f-string replacement field after its opening
+// '{'. As of Python 3.12 (PEP 701) the expression may contain any string,
+// including one using the same quotes as the f-string, and may span lines.
+func (t *Tokeniser) replacementField(d rune, long bool) string {
+	var depth int
+	for {
+		switch c := t.Peek(); {
+		case c == 0:
+			return "eof"
+		case c == '#':
+			t.ExceptRun(newLine)
+		case c == '"' || c == '\'':
+			t.Next()
+			if err := t.scanString(c, ""); err != "" {
+				return err
+			}
+		case t.idStart():
+			start := t.pos - utf8.RuneLen(c)
+			t.idContinue()
+			prefix := strings.ToLower(t.input[start:t.pos])
+			if q := t.Peek(); isStringPrefix(prefix) && t.Accept("\"'") {
+				if err := t.scanString(q, prefix); err != "" {
+					return err
+				}
+			}
+		case c == '(' || c == '[' || c == '{':
+			t.Next()
+			depth++
+		case c == ')' || c == ']':
+			t.Next()
+			if depth--; depth < 0 {
+				return "invalid bracket"
+			}
+		case c == '}':
+			t.Next()
+			if depth == 0 {
+				return ""
+			}
+			depth--
+		case c == '!' && depth == 0:
+			t.Next()
+			if t.Accept("=") {
+				continue
+			}
+			start := t.pos
+			t.AcceptRun("rsa")
+			if conversion := t.input[start:t.pos]; len(conversion) != 1 {
+				return "invalid conversion character"
+			}
+			if c := t.Peek(); c != ':' && c != '}' {
+				return "expected ':' or '}' after conversion"
+			}
+		case c == ':' && depth == 0:
+			t.Next()
+			return t.formatSpec(d, long)
 		default:
-			return t.stateError("eof")
+			t.Next()
 		}
 	}
-	return Token{t.Get(), TokenString}, stateStart
+}
+
+// formatSpec consumes the format specifier of a replacement field, after the
+// ':', along with the closing '}'. It may contain nested replacement fields.
+func (t *Tokeniser) formatSpec(d rune, long bool) string {
+	for {
+		switch t.ExceptRun("{}\\" + newLine + string(d)) {
+		case '{':
+			t.Next()
+			if err := t.replacementField(d, long); err != "" {
+				return err
+			}
+		case '}':
+			t.Next()
+			return ""
+		case '\\':
+			t.Next()
+			t.Next()
+		case '\r', '\n':
+			if !long {
+				return "newline in string"
+			}
+			t.Next()
+		case d:
+			if !long || strings.HasPrefix(t.input[t.pos:], strings.Repeat(string(d), 3)) {
+				return "expected '}' in f-string"
+			}
+			t.Next()
+		default:
+			return "eof"
+		}
+	}
+}
+
+func isStringPrefix(prefix string) bool {
+	switch prefix {
+	case "r", "u", "f", "b", "br", "rb", "fr", "rf":
+		return true
+	}
+	return false
 }
 
 func (t *Tokeniser) identifier() (Token, tokenFunc) {
 	t.idContinue()
-	identifier := t.Get()
 	tokenType := TokenIdentifier
-	if slices.Contains(keywords[:], identifier) {
+	if slices.Contains(keywords[:], t.input[t.lastPos:t.pos]) {
 		tokenType = TokenKeyword
 	}
-	return Token{identifier, tokenType}, stateStart
+	return t.token(tokenType), stateStart
 }
 
 func (t *Tokeniser) possibleString(c rune) (Token, tokenFunc) {
@@ -440,7 +958,7 @@ func (t *Tokeniser) possibleString(c rune) (Token, tokenFunc) {
 		t.Accept("rR")
 	}
 	if c := t.Peek(); t.Accept("\"'") {
-		return t.string(c)
+		return t.string(c, strings.ToLower(t.input[t.lastPos:t.pos-1]))
 	}
 	return t.identifier()
 }
@@ -3,8 +3,12 @@ package tokeniser
 import (
 	_ "embed"
 	"errors"
+	"io"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
 
 	"github.com/wtsi-hgi/uber-recipe-creator/internal/testdata"
 )
@@ -22,214 +26,214 @@ func TestTokeniser(t *testing.T) {
 		},
 		{ // 2
 			"a",
-			[]Token{{"a", TokenIdentifier}},
+			[]Token{{Val: "a", Type: TokenIdentifier}},
 			nil,
 		},
 		{ // 3
 			"abc",
-			[]Token{{"abc", TokenIdentifier}},
+			[]Token{{Val: "abc", Type: TokenIdentifier}},
 			nil,
 		},
 		{ // 4
 			"123",
-			[]Token{{"123", TokenNumber}},
+			[]Token{{Val: "123", Type: TokenNumber}},
 			nil,
 		},
 		{ // 5
 			"123.456",
-			[]Token{{"123.456", TokenNumber}},
+			[]Token{{Val: "123.456", Type: TokenNumber}},
 			nil,
 		},
 		{ // 6
 			"0.1_2_3",
-			[]Token{{"0.1_2_3", TokenNumber}},
+			[]Token{{Val: "0.1_2_3", Type: TokenNumber}},
 			nil,
 		},
 		{ // 7
 			"1_2_3e4",
-			[]Token{{"1_2_3e4", TokenNumber}},
+			[]Token{{Val: "1_2_3e4", Type: TokenNumber}},
 			nil,
 		},
 		{ // 8
 			"1e_3",
-			[]Token{{"1e_3", TokenNumber}},
+			[]Token{{Val: "1e_3", Type: TokenNumber}},
 			nil,
 		},
 		{ // 9
 			"2j",
-			[]Token{{"2j", TokenNumber}},
+			[]Token{{Val: "2j", Type: TokenNumber}},
 			nil,
 		},
 		{ // 10
 			"077e010",
-			[]Token{{"077e010", TokenNumber}},
+			[]Token{{Val: "077e010", Type: TokenNumber}},
 			nil,
 		},
 		{ // 11
 			"07_7e010",
-			[]Token{{"07_7e010", TokenNumber}},
+			[]Token{{Val: "07_7e010", Type: TokenNumber}},
 			nil,
 		},
 		{ // 12
 			"0e1",
-			[]Token{{"0e1", TokenNumber}},
+			[]Token{{Val: "0e1", Type: TokenNumber}},
 			nil,
 		},
 		{ // 13
 			"\"hello, world\"",
-			[]Token{{"\"hello, world\"", TokenString}},
+			[]Token{{Val: "\"hello, world\"", Type: TokenString}},
 			nil,
 		},
 		{ // 14
 			"stats.parse",
 			[]Token{
-				{"stats", TokenIdentifier},
-				{".", TokenDelimiter},
-				{"parse", TokenIdentifier},
+				{Val: "stats", Type: TokenIdentifier},
+				{Val: ".", Type: TokenDelimiter},
+				{Val: "parse", Type: TokenIdentifier},
 			},
 			nil,
 		},
 		{ // 15
 			"a = 1\nb = \"abc\"",
 			[]Token{
-				{"a", TokenIdentifier},
-				{" ", TokenWhitespace},
-				{"=", TokenDelimiter},
-				{" ", TokenWhitespace},
-				{"1", TokenNumber},
-				{"\n", TokenNewline},
-				{"b", TokenIdentifier},
-				{" ", TokenWhitespace},
-				{"=", TokenDelimiter},
-				{" ", TokenWhitespace},
-				{"\"abc\"", TokenString},
+				{Val: "a", Type: TokenIdentifier},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "=", Type: TokenDelimiter},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "1", Type: TokenNumber},
+				{Val: "\n", Type: TokenNewline},
+				{Val: "b", Type: TokenIdentifier},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "=", Type: TokenDelimiter},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "\"abc\"", Type: TokenString},
 			},
 			nil,
 		},
 		{ // 16
 			"if a in b:\n\tasync c(a)",
 			[]Token{
-				{"if", TokenKeyword},
-				{" ", TokenWhitespace},
-				{"a", TokenIdentifier},
-				{" ", TokenWhitespace},
-				{"in", TokenKeyword},
-				{" ", TokenWhitespace},
-				{"b", TokenIdentifier},
-				{":", TokenDelimiter},
-				{"\n", TokenNewline},
-				{"\t", TokenWhitespace},
-				{"async", TokenKeyword},
-				{" ", TokenWhitespace},
-				{"c", TokenIdentifier},
-				{"(", TokenDelimiter},
-				{"a", TokenIdentifier},
-				{")", TokenDelimiter},
+				{Val: "if", Type: TokenKeyword},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "a", Type: TokenIdentifier},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "in", Type: TokenKeyword},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "b", Type: TokenIdentifier},
+				{Val: ":", Type: TokenDelimiter},
+				{Val: "\n", Type: TokenNewline},
+				{Val: "\t", Type: TokenWhitespace},
+				{Val: "async", Type: TokenKeyword},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "c", Type: TokenIdentifier},
+				{Val: "(", Type: TokenDelimiter},
+				{Val: "a", Type: TokenIdentifier},
+				{Val: ")", Type: TokenDelimiter},
 			},
 			nil,
 		},
 		{ // 17
 			`"a 'string"`,
-			[]Token{{`"a 'string"`, TokenString}},
+			[]Token{{Val: `"a 'string"`, Type: TokenString}},
 			nil,
 		},
 		{ // 18
 			`a string"`,
 			nil,
-			errors.New("eof"),
+			&Error{Pos: Position{Offset: 8, Line: 1, Column: 9}, Msg: "eof"},
 		},
 		{ // 19
 			`"a string`,
 			nil,
-			errors.New("eof"),
+			&Error{Pos: Position{Offset: 0, Line: 1, Column: 1}, Msg: "eof"},
 		},
 		{ // 20
 			`r"a string"`,
-			[]Token{{`r"a string"`, TokenString}},
+			[]Token{{Val: `r"a string"`, Type: TokenString}},
 			nil,
 		},
 		{ // 21
 			`f"a string"`,
-			[]Token{{`f"a string"`, TokenString}},
+			[]Token{{Val: `f"a string"`, Type: TokenString}},
 			nil,
 		},
 		{ // 22
 			`U"a string"`,
-			[]Token{{`U"a string"`, TokenString}},
+			[]Token{{Val: `U"a string"`, Type: TokenString}},
 			nil,
 		},
 		{ // 23
 			`rF"a string"`,
-			[]Token{{`rF"a string"`, TokenString}},
+			[]Token{{Val: `rF"a string"`, Type: TokenString}},
 			nil,
 		},
 		{ // 24
 			`fR"a string"`,
-			[]Token{{`fR"a string"`, TokenString}},
+			[]Token{{Val: `fR"a string"`, Type: TokenString}},
 			nil,
 		},
 		{ // 25
 			`b"a string"`,
-			[]Token{{`b"a string"`, TokenString}},
+			[]Token{{Val: `b"a string"`, Type: TokenString}},
 			nil,
 		},
 		{ // 26
 			`BR"a string"`,
-			[]Token{{`BR"a string"`, TokenString}},
+			[]Token{{Val: `BR"a string"`, Type: TokenString}},
 			nil,
 		},
 		{ // 27
 			`'a string'`,
-			[]Token{{`'a string'`, TokenString}},
+			[]Token{{Val: `'a string'`, Type: TokenString}},
 			nil,
 		},
 		{ // 28
 			`BR'a string'`,
-			[]Token{{`BR'a string'`, TokenString}},
+			[]Token{{Val: `BR'a string'`, Type: TokenString}},
 			nil,
 		},
 		{ // 29
 			`BR"""a string"""`,
-			[]Token{{`BR"""a string"""`, TokenString}},
+			[]Token{{Val: `BR"""a string"""`, Type: TokenString}},
 			nil,
 		},
 		{ // 30
 			"BR\"\"\"a string\n\n\nhello\"\"\"",
-			[]Token{{"BR\"\"\"a string\n\n\nhello\"\"\"", TokenString}},
+			[]Token{{Val: "BR\"\"\"a string\n\n\nhello\"\"\"", Type: TokenString}},
 			nil,
 		},
 		{ // 31
 			`BR'''a string'''`,
-			[]Token{{`BR'''a string'''`, TokenString}},
+			[]Token{{Val: `BR'''a string'''`, Type: TokenString}},
 			nil,
 		},
 		{ // 32
 			`"""a string"""`,
-			[]Token{{`"""a string"""`, TokenString}},
+			[]Token{{Val: `"""a string"""`, Type: TokenString}},
 			nil,
 		},
 		{ // 33
 			`'''a string'''`,
-			[]Token{{`'''a string'''`, TokenString}},
+			[]Token{{Val: `'''a string'''`, Type: TokenString}},
 			nil,
 		},
 		{ // 34
 			`# a comment!!!!`,
-			[]Token{{`# a comment!!!!`, TokenComment}},
+			[]Token{{Val: `# a comment!!!!`, Type: TokenComment}},
 			nil,
 		},
 		{ // 35
 			"a = 2 # a comment!!!!\nb",
 			[]Token{
-				{`a`, TokenIdentifier},
-				{` `, TokenWhitespace},
-				{`=`, TokenDelimiter},
-				{` `, TokenWhitespace},
-				{`2`, TokenNumber},
-				{` `, TokenWhitespace},
-				{`# a comment!!!!`, TokenComment},
-				{"\n", TokenNewline},
-				{`b`, TokenIdentifier},
+				{Val: `a`, Type: TokenIdentifier},
+				{Val: ` `, Type: TokenWhitespace},
+				{Val: `=`, Type: TokenDelimiter},
+				{Val: ` `, Type: TokenWhitespace},
+				{Val: `2`, Type: TokenNumber},
+				{Val: ` `, Type: TokenWhitespace},
+				{Val: `# a comment!!!!`, Type: TokenComment},
+				{Val: "\n", Type: TokenNewline},
+				{Val: `b`, Type: TokenIdentifier},
 			},
 			nil,
 		},
@@ -769,11 +773,137 @@ func TestTokeniser(t *testing.T) {
 			},
 			nil,
 		},
+		{ // 88
+			"def f(a) -> int: ...",
+			[]Token{
+				{Type: TokenKeyword, Val: "def"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenIdentifier, Val: "f"},
+				{Type: TokenDelimiter, Val: "("},
+				{Type: TokenIdentifier, Val: "a"},
+				{Type: TokenDelimiter, Val: ")"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenDelimiter, Val: "->"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenIdentifier, Val: "int"},
+				{Type: TokenDelimiter, Val: ":"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenDelimiter, Val: "..."},
+			},
+			nil,
+		},
+		{ // 89
+			"a->=b",
+			[]Token{
+				{Type: TokenIdentifier, Val: "a"},
+				{Type: TokenDelimiter, Val: "->"},
+				{Type: TokenDelimiter, Val: "="},
+				{Type: TokenIdentifier, Val: "b"},
+			},
+			nil,
+		},
+		{ // 90
+			"if (n := 10) > 5:",
+			[]Token{
+				{Type: TokenKeyword, Val: "if"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenDelimiter, Val: "("},
+				{Type: TokenIdentifier, Val: "n"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenOperator, Val: ":="},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenNumber, Val: "10"},
+				{Type: TokenDelimiter, Val: ")"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenOperator, Val: ">"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenNumber, Val: "5"},
+				{Type: TokenDelimiter, Val: ":"},
+			},
+			nil,
+		},
+		{ // 91
+			"@run_after(\"install\")\n",
+			[]Token{
+				{Type: TokenOperator, Val: "@"},
+				{Type: TokenIdentifier, Val: "run_after"},
+				{Type: TokenDelimiter, Val: "("},
+				{Type: TokenString, Val: "\"install\""},
+				{Type: TokenDelimiter, Val: ")"},
+				{Type: TokenNewline, Val: "\n"},
+			},
+			nil,
+		},
+		{ // 92
+			"match case type _",
+			[]Token{
+				{Type: TokenIdentifier, Val: "match"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenIdentifier, Val: "case"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenIdentifier, Val: "type"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenIdentifier, Val: "_"},
+			},
+			nil,
+		},
+		{ // 93
+			"f\"{x[\"a\"]!r:>{width}}\"",
+			[]Token{{Type: TokenString, Val: "f\"{x[\"a\"]!r:>{width}}\""}},
+			nil,
+		},
+		{ // 94
+			"f'{a}{{b}}' + rf\"\\{c}\"",
+			[]Token{
+				{Type: TokenString, Val: "f'{a}{{b}}'"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenOperator, Val: "+"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenString, Val: "rf\"\\{c}\""},
+			},
+			nil,
+		},
+		{ // 95
+			"f\"\"\"{\nx # comment\n}\"\"\"",
+			[]Token{{Type: TokenString, Val: "f\"\"\"{\nx # comment\n}\"\"\""}},
+			nil,
+		},
+		{ // 96
+			"0j 09.5 0e1",
+			[]Token{
+				{Type: TokenNumber, Val: "0j"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenNumber, Val: "09.5"},
+				{Type: TokenWhitespace, Val: " "},
+				{Type: TokenNumber, Val: "0e1"},
+			},
+			nil,
+		},
+		{ // 97
+			"f\"\\N{EN DASH} {x!s} {y != z}\"",
+			[]Token{{Type: TokenString, Val: "f\"\\N{EN DASH} {x!s} {y != z}\""}},
+			nil,
+		},
+		{ // 98
+			"f\"{x!z}\"",
+			nil,
+			&Error{Pos: Position{Offset: 0, Line: 1, Column: 1}, Msg: "invalid conversion character"},
+		},
+		{ // 99
+			"a = f\"}\"",
+			nil,
+			&Error{Pos: Position{Offset: 4, Line: 1, Column: 5}, Msg: "single '}' in f-string"},
+		},
+		{ // 100
+			"f\"{x:a\"",
+			nil,
+			&Error{Pos: Position{Offset: 0, Line: 1, Column: 1}, Msg: "expected '}' in f-string"},
+		},
 	} {
 		tokens, err := Tokenise(test.Input)
 		if !reflect.DeepEqual(err, test.Err) {
 			t.Errorf("Test %d: input was %s, expecting error %s, got %s", n+1, test.Input, test.Err, err)
-		} else if !reflect.DeepEqual(tokens, test.Tokens) {
+		} else if !reflect.DeepEqual(stripPositions(tokens), test.Tokens) {
 			t.Errorf("Test %d: got %v, want %v", n+1, tokens, test.Tokens)
 		}
 	}
@@ -781,386 +911,387 @@ func TestTokeniser(t *testing.T) {
 
 func TestPythonFile(t *testing.T) {
 	expected := []Token{
-		{"import", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"hashlib", TokenIdentifier},
-		{"\n", TokenNewline},
-		{"import", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"requests", TokenIdentifier},
-		{"\n", TokenNewline},
-		{"import", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"pyreadr", TokenIdentifier},
-		{"\n", TokenNewline},
-		{"import", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"tempfile", TokenIdentifier},
-		{"\n", TokenNewline},
-		{"import", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"pandas", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"as", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"pd", TokenIdentifier},
-		{"\n\n", TokenNewline},
-		{"databaseurl", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"\"https://cran.r-project.org/web/packages/packages.rds\"", TokenString},
-		{"\n\n", TokenNewline},
-		{"response", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"requests", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"get", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"databaseurl", TokenIdentifier},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"allow_redirects", TokenIdentifier},
-		{"=", TokenDelimiter},
-		{"True", TokenKeyword},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"tmpfile", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"tempfile", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"NamedTemporaryFile", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"tmpfile", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"write", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"response", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"content", TokenIdentifier},
-		{")", TokenDelimiter},
-		{"\n\n", TokenNewline},
-		{"database", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"pyreadr", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"read_r", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"tmpfile", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"name", TokenIdentifier},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"database", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"database", TokenIdentifier},
-		{"[", TokenDelimiter},
-		{"None", TokenKeyword},
-		{"]", TokenDelimiter},
-		{"\n\n", TokenNewline},
-		{"pandasDatabase", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"pd", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"DataFrame", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"database", TokenIdentifier},
-		{")", TokenDelimiter},
-		{"\n\n", TokenNewline},
-		{"urlbool", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"True", TokenKeyword},
-		{"\n\n", TokenNewline},
-		{"package", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"str", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"input", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"Please enter package name: \"", TokenString},
-		{")", TokenDelimiter},
-		{")", TokenDelimiter},
-		{"\n\n", TokenNewline},
-		{"record", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"pandasDatabase", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"loc", TokenIdentifier},
-		{"[", TokenDelimiter},
-		{"pandasDatabase", TokenIdentifier},
-		{"[", TokenDelimiter},
-		{"'Package'", TokenString},
-		{"]", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"==", TokenOperator},
-		{" ", TokenWhitespace},
-		{"package", TokenIdentifier},
-		{"]", TokenDelimiter},
-		{"\n\n", TokenNewline},
-		{"name", TokenIdentifier},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"description", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"record", TokenIdentifier},
-		{"[", TokenDelimiter},
-		{"\"Title\"", TokenString},
-		{"]", TokenDelimiter},
-		{".", TokenDelimiter},
-		{"values", TokenIdentifier},
-		{"[", TokenDelimiter},
-		{"0", TokenNumber},
-		{"]", TokenDelimiter},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"record", TokenIdentifier},
-		{"[", TokenDelimiter},
-		{"\"Description\"", TokenString},
-		{"]", TokenDelimiter},
-		{".", TokenDelimiter},
-		{"values", TokenIdentifier},
-		{"[", TokenDelimiter},
-		{"0", TokenNumber},
-		{"]", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"try", TokenKeyword},
-		{":", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"    ", TokenWhitespace},
-		{"dependencies", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"record", TokenIdentifier},
-		{"[", TokenDelimiter},
-		{"\"Imports\"", TokenString},
-		{"]", TokenDelimiter},
-		{".", TokenDelimiter},
-		{"values", TokenIdentifier},
-		{"[", TokenDelimiter},
-		{"0", TokenNumber},
-		{"]", TokenDelimiter},
-		{".", TokenDelimiter},
-		{"split", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\", \"", TokenString},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"except", TokenKeyword},
-		{":", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"    ", TokenWhitespace},
-		{"dependencies", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"[", TokenDelimiter},
-		{"]", TokenDelimiter},
-		{"\n\n", TokenNewline},
-		{"try", TokenKeyword},
-		{":", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"    ", TokenWhitespace},
-		{"packageURL", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"record", TokenIdentifier},
-		{"[", TokenDelimiter},
-		{"\"URL\"", TokenString},
-		{"]", TokenDelimiter},
-		{".", TokenDelimiter},
-		{"values", TokenIdentifier},
-		{"[", TokenDelimiter},
-		{"0", TokenNumber},
-		{"]", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"except", TokenKeyword},
-		{":", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"    ", TokenWhitespace},
-		{"urlbool", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"False", TokenKeyword},
-		{"\n\n", TokenNewline},
-		{"print", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"\\\"\\\"\\\"\"", TokenString},
-		{" ", TokenWhitespace},
-		{"+", TokenOperator},
-		{" ", TokenWhitespace},
-		{"name", TokenIdentifier},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"print", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"print", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"description", TokenIdentifier},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"print", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"\\\"\\\"\\\"\"", TokenString},
-		{")", TokenDelimiter},
-		{"\n\n", TokenNewline},
-		{"print", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"if", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"urlbool", TokenIdentifier},
-		{":", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"    ", TokenWhitespace},
-		{"print", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"f\"homepage = \\\"{packageURL}\\\"\"", TokenString},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"print", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"f\"cran = \\\"{package}\\\"\"", TokenString},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"print", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{")", TokenDelimiter},
-		{"\n\n", TokenNewline},
-		{"source", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"requests", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"get", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"https://cran.r-project.org/src/contrib/\"", TokenString},
-		{" ", TokenWhitespace},
-		{"+", TokenOperator},
-		{" ", TokenWhitespace},
-		{"package", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"+", TokenOperator},
-		{" ", TokenWhitespace},
-		{"\"_\"", TokenString},
-		{" ", TokenWhitespace},
-		{"+", TokenOperator},
-		{" ", TokenWhitespace},
-		{"record", TokenIdentifier},
-		{"[", TokenDelimiter},
-		{"\"Version\"", TokenString},
-		{"]", TokenDelimiter},
-		{".", TokenDelimiter},
-		{"values", TokenIdentifier},
-		{"[", TokenDelimiter},
-		{"0", TokenNumber},
-		{"]", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"+", TokenOperator},
-		{" ", TokenWhitespace},
-		{"\".tar.gz\"", TokenString},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"allow_redirects", TokenIdentifier},
-		{"=", TokenDelimiter},
-		{"True", TokenKeyword},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"sha256_hash", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"hashlib", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"sha256", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"sha256_hash", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"update", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"source", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"content", TokenIdentifier},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"print", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"f\"version(\\\"{record['Version'].values[0]}\\\", sha256=\\\"{sha256_hash.hexdigest()}\\\")\"", TokenString},
-		{")", TokenDelimiter},
-		{"\n\n", TokenNewline},
-		{"print", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"for", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"k", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"in", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"dependencies", TokenIdentifier},
-		{":", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"    ", TokenWhitespace},
-		{"print", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"depends_on(\\\"r-\"", TokenString},
-		{" ", TokenWhitespace},
-		{"+", TokenOperator},
-		{" ", TokenWhitespace},
-		{"k", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"lower", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{")", TokenDelimiter},
-		{".", TokenDelimiter},
-		{"replace", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\".\"", TokenString},
-		{",", TokenDelimiter},
-		{"\"-\"", TokenString},
-		{")", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"+", TokenOperator},
-		{" ", TokenWhitespace},
-		{"\"\\\", type=(\\\"build\\\", \\\"run\\\"))\"", TokenString},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"print", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{")", TokenDelimiter},
-		{"\n\n", TokenNewline},
+		{Val: "import", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "hashlib", Type: TokenIdentifier},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "import", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "requests", Type: TokenIdentifier},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "import", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "pyreadr", Type: TokenIdentifier},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "import", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "tempfile", Type: TokenIdentifier},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "import", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "pandas", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "as", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "pd", Type: TokenIdentifier},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "databaseurl", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "\"https://cran.r-project.org/web/packages/packages.rds\"", Type: TokenString},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "response", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "requests", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "get", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "databaseurl", Type: TokenIdentifier},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "allow_redirects", Type: TokenIdentifier},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: "True", Type: TokenKeyword},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "tmpfile", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "tempfile", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "NamedTemporaryFile", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "tmpfile", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "write", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "response", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "content", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "database", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "pyreadr", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "read_r", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "tmpfile", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "name", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "database", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "database", Type: TokenIdentifier},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "None", Type: TokenKeyword},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "pandasDatabase", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "pd", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "DataFrame", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "database", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "urlbool", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "True", Type: TokenKeyword},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "package", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "str", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "input", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"Please enter package name: \"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "record", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "pandasDatabase", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "loc", Type: TokenIdentifier},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "pandasDatabase", Type: TokenIdentifier},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "'Package'", Type: TokenString},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "==", Type: TokenOperator},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "package", Type: TokenIdentifier},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "name", Type: TokenIdentifier},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "description", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "record", Type: TokenIdentifier},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "\"Title\"", Type: TokenString},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "values", Type: TokenIdentifier},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "0", Type: TokenNumber},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "record", Type: TokenIdentifier},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "\"Description\"", Type: TokenString},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "values", Type: TokenIdentifier},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "0", Type: TokenNumber},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "try", Type: TokenKeyword},
+		{Val: ":", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "    ", Type: TokenWhitespace},
+		{Val: "dependencies", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "record", Type: TokenIdentifier},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "\"Imports\"", Type: TokenString},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "values", Type: TokenIdentifier},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "0", Type: TokenNumber},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "split", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\", \"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "except", Type: TokenKeyword},
+		{Val: ":", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "    ", Type: TokenWhitespace},
+		{Val: "dependencies", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "try", Type: TokenKeyword},
+		{Val: ":", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "    ", Type: TokenWhitespace},
+		{Val: "packageURL", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "record", Type: TokenIdentifier},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "\"URL\"", Type: TokenString},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "values", Type: TokenIdentifier},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "0", Type: TokenNumber},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "except", Type: TokenKeyword},
+		{Val: ":", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "    ", Type: TokenWhitespace},
+		{Val: "urlbool", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "False", Type: TokenKeyword},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "print", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"\\\"\\\"\\\"\"", Type: TokenString},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "+", Type: TokenOperator},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "name", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "print", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "print", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "description", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "print", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"\\\"\\\"\\\"\"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "print", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "if", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "urlbool", Type: TokenIdentifier},
+		{Val: ":", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "    ", Type: TokenWhitespace},
+		{Val: "print", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "f\"homepage = \\\"{packageURL}\\\"\"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "print", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "f\"cran = \\\"{package}\\\"\"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "print", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "source", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "requests", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "get", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"https://cran.r-project.org/src/contrib/\"", Type: TokenString},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "+", Type: TokenOperator},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "package", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "+", Type: TokenOperator},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "\"_\"", Type: TokenString},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "+", Type: TokenOperator},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "record", Type: TokenIdentifier},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "\"Version\"", Type: TokenString},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "values", Type: TokenIdentifier},
+		{Val: "[", Type: TokenDelimiter},
+		{Val: "0", Type: TokenNumber},
+		{Val: "]", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "+", Type: TokenOperator},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "\".tar.gz\"", Type: TokenString},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "allow_redirects", Type: TokenIdentifier},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: "True", Type: TokenKeyword},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "sha256_hash", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "hashlib", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "sha256", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "sha256_hash", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "update", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "source", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "content", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "print", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "f\"version(\\\"{record['Version'].values[0]}\\\", sha256=\\\"{sha256_hash.hexdigest()}\\\")\"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "print", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "for", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "k", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "in", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "dependencies", Type: TokenIdentifier},
+		{Val: ":", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "    ", Type: TokenWhitespace},
+		{Val: "print", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"depends_on(\\\"r-\"", Type: TokenString},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "+", Type: TokenOperator},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "k", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "lower", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "replace", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\".\"", Type: TokenString},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: "\"-\"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "+", Type: TokenOperator},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "\"\\\", type=(\\\"build\\\", \\\"run\\\"))\"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "print", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n\n", Type: TokenNewline},
 	}
 
 	tokens, _ := Tokenise(testdata.TestScript1)
+	tokens = stripPositions(tokens)
 	if !reflect.DeepEqual(tokens, expected) {
 		for i, token := range tokens {
 			if token != expected[i] {
@@ -1172,223 +1303,224 @@ func TestPythonFile(t *testing.T) {
 
 func TestRecipeFile(t *testing.T) {
 	expected := []Token{
-		{"# Copyright 2013-2023 Lawrence Livermore National Security, LLC and other", TokenComment},
-		{"\n", TokenNewline},
-		{"# Spack Project Developers. See the top-level COPYRIGHT file for details.", TokenComment},
-		{"\n", TokenNewline},
-		{"#", TokenComment},
-		{"\n", TokenNewline},
-		{"# SPDX-License-Identifier: (Apache-2.0 OR MIT)", TokenComment},
-		{"\n\n", TokenNewline},
-		{"from", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"spack", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"package", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"import", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"*", TokenOperator},
-		{"\n\n\n", TokenNewline},
-		{"class", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"Nextdenovo", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\n\t", TokenWhitespace},
-		{"MakefilePackage", TokenIdentifier},
-		{"\n\t", TokenWhitespace},
-		{")", TokenDelimiter},
-		{":", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"\t", TokenWhitespace},
-		{"\"\"\"NextDenovo is a string graph-based de novo assembler for long reads.\n\tidk\n\tsomething \n\t\n\t\n\t\n\thello\"\"\"", TokenString},
-		{"\n\n", TokenNewline},
-		{"\t", TokenWhitespace},
-		{"homepage", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"\"https://nextdenovo.readthedocs.io/en/latest/index.html\"", TokenString},
-		{"\n", TokenNewline},
-		{"\t", TokenWhitespace},
-		{"url", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"\"https://github.com/Nextomics/NextDenovo/archive/refs/tags/2.5.2.tar.gz\"", TokenString},
-		{"\n\n", TokenNewline},
-		{"\t", TokenWhitespace},
-		{"version", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"2.5.2\"", TokenString},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"sha256", TokenIdentifier},
-		{"=", TokenDelimiter},
-		{"\"f1d07c9c362d850fd737c41e5b5be9d137b1ef3f1aec369dc73c637790611190\"", TokenString},
-		{")", TokenDelimiter},
-		{"\n\n", TokenNewline},
-		{"\t", TokenWhitespace},
-		{"depends_on", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"python\"", TokenString},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"type", TokenIdentifier},
-		{"=", TokenDelimiter},
-		{"\"run\"", TokenString},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"\t", TokenWhitespace},
-		{"depends_on", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"py-paralleltask\"", TokenString},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"type", TokenIdentifier},
-		{"=", TokenDelimiter},
-		{"\"run\"", TokenString},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"\t", TokenWhitespace},
-		{"depends_on", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"zlib\"", TokenString},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"type", TokenIdentifier},
-		{"=", TokenDelimiter},
-		{"(", TokenDelimiter},
-		{"\"build\"", TokenString},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"\"link\"", TokenString},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"\"run\"", TokenString},
-		{")", TokenDelimiter},
-		{")", TokenDelimiter},
-		{"\n\n", TokenNewline},
-		{"\t", TokenWhitespace},
-		{"def", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"edit", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"self", TokenIdentifier},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"spec", TokenIdentifier},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"prefix", TokenIdentifier},
-		{")", TokenDelimiter},
-		{":", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"\t\t", TokenWhitespace},
-		{"makefile", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"FileFilter", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"Makefile\"", TokenString},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"\t\t", TokenWhitespace},
-		{"makefile", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"filter", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"r\"^TOP_DIR.*\"", TokenString},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"\"TOP_DIR={0}\"", TokenString},
-		{".", TokenDelimiter},
-		{"format", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"self", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"build_directory", TokenIdentifier},
-		{")", TokenDelimiter},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"\t\t", TokenWhitespace},
-		{"runfile", TokenIdentifier},
-		{" ", TokenWhitespace},
-		{"=", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"FileFilter", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"nextDenovo\"", TokenString},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"\t\t", TokenWhitespace},
-		{"runfile", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"filter", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"r\"^SCRIPT_PATH.*\"", TokenString},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"\"SCRIPT_PATH = '{0}'\"", TokenString},
-		{".", TokenDelimiter},
-		{"format", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"prefix", TokenIdentifier},
-		{")", TokenDelimiter},
-		{")", TokenDelimiter},
-		{"\n\n", TokenNewline},
-		{"\t", TokenWhitespace},
-		{"def", TokenKeyword},
-		{" ", TokenWhitespace},
-		{"install", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"self", TokenIdentifier},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"spec", TokenIdentifier},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"prefix", TokenIdentifier},
-		{")", TokenDelimiter},
-		{":", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"\t\t", TokenWhitespace},
-		{"install_tree", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"bin\"", TokenString},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"prefix", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"bin", TokenIdentifier},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"\t\t", TokenWhitespace},
-		{"install", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"nextDenovo\"", TokenString},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"prefix", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"bin", TokenIdentifier},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
-		{"\t\t", TokenWhitespace},
-		{"install_tree", TokenIdentifier},
-		{"(", TokenDelimiter},
-		{"\"lib\"", TokenString},
-		{",", TokenDelimiter},
-		{" ", TokenWhitespace},
-		{"prefix", TokenIdentifier},
-		{".", TokenDelimiter},
-		{"lib", TokenIdentifier},
-		{")", TokenDelimiter},
-		{"\n", TokenNewline},
+		{Val: "# Copyright 2013-2023 Lawrence Livermore National Security, LLC and other", Type: TokenComment},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "# Spack Project Developers. See the top-level COPYRIGHT file for details.", Type: TokenComment},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "#", Type: TokenComment},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "# SPDX-License-Identifier: (Apache-2.0 OR MIT)", Type: TokenComment},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "from", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "spack", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "package", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "import", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "*", Type: TokenOperator},
+		{Val: "\n\n\n", Type: TokenNewline},
+		{Val: "class", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "Nextdenovo", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\n\t", Type: TokenWhitespace},
+		{Val: "MakefilePackage", Type: TokenIdentifier},
+		{Val: "\n\t", Type: TokenWhitespace},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: ":", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "\t", Type: TokenWhitespace},
+		{Val: "\"\"\"NextDenovo is a string graph-based de novo assembler for long reads.\n\tidk\n\tsomething \n\t\n\t\n\t\n\thello\"\"\"", Type: TokenString},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "\t", Type: TokenWhitespace},
+		{Val: "homepage", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "\"https://nextdenovo.readthedocs.io/en/latest/index.html\"", Type: TokenString},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "\t", Type: TokenWhitespace},
+		{Val: "url", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "\"https://github.com/Nextomics/NextDenovo/archive/refs/tags/2.5.2.tar.gz\"", Type: TokenString},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "\t", Type: TokenWhitespace},
+		{Val: "version", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"2.5.2\"", Type: TokenString},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "sha256", Type: TokenIdentifier},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: "\"f1d07c9c362d850fd737c41e5b5be9d137b1ef3f1aec369dc73c637790611190\"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "\t", Type: TokenWhitespace},
+		{Val: "depends_on", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"python\"", Type: TokenString},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "type", Type: TokenIdentifier},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: "\"run\"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "\t", Type: TokenWhitespace},
+		{Val: "depends_on", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"py-paralleltask\"", Type: TokenString},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "type", Type: TokenIdentifier},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: "\"run\"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "\t", Type: TokenWhitespace},
+		{Val: "depends_on", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"zlib\"", Type: TokenString},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "type", Type: TokenIdentifier},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"build\"", Type: TokenString},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "\"link\"", Type: TokenString},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "\"run\"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "\t", Type: TokenWhitespace},
+		{Val: "def", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "edit", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "self", Type: TokenIdentifier},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "spec", Type: TokenIdentifier},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "prefix", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: ":", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "\t\t", Type: TokenWhitespace},
+		{Val: "makefile", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "FileFilter", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"Makefile\"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "\t\t", Type: TokenWhitespace},
+		{Val: "makefile", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "filter", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "r\"^TOP_DIR.*\"", Type: TokenString},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "\"TOP_DIR={0}\"", Type: TokenString},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "format", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "self", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "build_directory", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "\t\t", Type: TokenWhitespace},
+		{Val: "runfile", Type: TokenIdentifier},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "=", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "FileFilter", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"nextDenovo\"", Type: TokenString},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "\t\t", Type: TokenWhitespace},
+		{Val: "runfile", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "filter", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "r\"^SCRIPT_PATH.*\"", Type: TokenString},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "\"SCRIPT_PATH = '{0}'\"", Type: TokenString},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "format", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "prefix", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n\n", Type: TokenNewline},
+		{Val: "\t", Type: TokenWhitespace},
+		{Val: "def", Type: TokenKeyword},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "install", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "self", Type: TokenIdentifier},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "spec", Type: TokenIdentifier},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "prefix", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: ":", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "\t\t", Type: TokenWhitespace},
+		{Val: "install_tree", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"bin\"", Type: TokenString},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "prefix", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "bin", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "\t\t", Type: TokenWhitespace},
+		{Val: "install", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"nextDenovo\"", Type: TokenString},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "prefix", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "bin", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "\t\t", Type: TokenWhitespace},
+		{Val: "install_tree", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "\"lib\"", Type: TokenString},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: " ", Type: TokenWhitespace},
+		{Val: "prefix", Type: TokenIdentifier},
+		{Val: ".", Type: TokenDelimiter},
+		{Val: "lib", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
 	}
 
 	tokens, _ := Tokenise(testdata.TestRecipe1)
+	tokens = stripPositions(tokens)
 	if !reflect.DeepEqual(tokens, expected) {
 		for i, token := range tokens {
 			if token != expected[i] {
@@ -1397,3 +1529,410 @@ func TestRecipeFile(t *testing.T) {
 		}
 	}
 }
+
+func TestTokeniseAfterError(t *testing.T) {
+	if _, err := Tokenise("f(\"unterminated"); err == nil {
+		t.Fatal("expected error")
+	}
+	tokens, err := Tokenise("a\nb")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []Token{{Val: "a", Type: TokenIdentifier}, {Val: "\n", Type: TokenNewline}, {Val: "b", Type: TokenIdentifier}}
+	if !reflect.DeepEqual(stripPositions(tokens), expected) {
+		t.Errorf("expected %v, got %v", expected, tokens)
+	}
+}
+
+func TestTokeniseConcurrently(t *testing.T) {
+	expected, err := Tokenise(testdata.TestRecipe1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				tokens, err := Tokenise(testdata.TestRecipe1)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !reflect.DeepEqual(tokens, expected) {
+					t.Error("tokens differ between concurrent calls")
+					return
+				}
+				Tokenise("(((")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func stripPositions(tokens []Token) []Token {
+	if tokens == nil {
+		return nil
+	}
+	stripped := make([]Token, len(tokens))
+	for i, token := range tokens {
+		stripped[i] = Token{Val: token.Val, Type: token.Type}
+	}
+	return stripped
+}
+
+func TestPositions(t *testing.T) {
+	tokens, err := Tokenise("a = (\n\t\"b\",\n)\nc\t# d\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Token{
+		{Val: "a", Type: TokenIdentifier, Pos: Position{Offset: 0, Line: 1, Column: 1}},
+		{Val: " ", Type: TokenWhitespace, Pos: Position{Offset: 1, Line: 1, Column: 2}},
+		{Val: "=", Type: TokenDelimiter, Pos: Position{Offset: 2, Line: 1, Column: 3}},
+		{Val: " ", Type: TokenWhitespace, Pos: Position{Offset: 3, Line: 1, Column: 4}},
+		{Val: "(", Type: TokenDelimiter, Pos: Position{Offset: 4, Line: 1, Column: 5}},
+		{Val: "\n\t", Type: TokenWhitespace, Pos: Position{Offset: 5, Line: 1, Column: 6}},
+		{Val: "\"b\"", Type: TokenString, Pos: Position{Offset: 7, Line: 2, Column: 2}},
+		{Val: ",", Type: TokenDelimiter, Pos: Position{Offset: 10, Line: 2, Column: 5}},
+		{Val: "\n", Type: TokenWhitespace, Pos: Position{Offset: 11, Line: 2, Column: 6}},
+		{Val: ")", Type: TokenDelimiter, Pos: Position{Offset: 12, Line: 3, Column: 1}},
+		{Val: "\n", Type: TokenNewline, Pos: Position{Offset: 13, Line: 3, Column: 2}},
+		{Val: "c", Type: TokenIdentifier, Pos: Position{Offset: 14, Line: 4, Column: 1}},
+		{Val: "\t", Type: TokenWhitespace, Pos: Position{Offset: 15, Line: 4, Column: 2}},
+		{Val: "# d", Type: TokenComment, Pos: Position{Offset: 16, Line: 4, Column: 3}},
+		{Val: "\n", Type: TokenNewline, Pos: Position{Offset: 19, Line: 4, Column: 6}},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		for i, token := range tokens {
+			if token != expected[i] {
+				t.Errorf("token %d: expected %+v, got %+v", i, expected[i], token)
+			}
+		}
+	}
+}
+
+func TestPositionErrors(t *testing.T) {
+	for n, test := range [...]struct {
+		input    string
+		expected string
+	}{
+		{"a = (\n\tb,\n", "1:5: unmatched bracket"},
+		{"a = 1\nb = )", "2:5: invalid bracket"},
+		{"a = 1\n\nb = \"c", "3:5: eof"},
+		{"x\n  $", "2:3: invalid delimiter"},
+	} {
+		_, err := Tokenise(test.input)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Test %d: expected error %q, got %v", n+1, test.expected, err)
+		}
+	}
+}
+
+func TestLineEndings(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  string
+		Tokens []Token
+	}{
+		{
+			"a\r\nb\r\n\r\n",
+			[]Token{
+				{Val: "a", Type: TokenIdentifier, Pos: Position{Offset: 0, Line: 1, Column: 1}},
+				{Val: "\r\n", Type: TokenNewline, Pos: Position{Offset: 1, Line: 1, Column: 2}},
+				{Val: "b", Type: TokenIdentifier, Pos: Position{Offset: 3, Line: 2, Column: 1}},
+				{Val: "\r\n\r\n", Type: TokenNewline, Pos: Position{Offset: 4, Line: 2, Column: 2}},
+			},
+		},
+		{
+			"a\rb",
+			[]Token{
+				{Val: "a", Type: TokenIdentifier, Pos: Position{Offset: 0, Line: 1, Column: 1}},
+				{Val: "\r", Type: TokenNewline, Pos: Position{Offset: 1, Line: 1, Column: 2}},
+				{Val: "b", Type: TokenIdentifier, Pos: Position{Offset: 2, Line: 2, Column: 1}},
+			},
+		},
+		{
+			"a \\\r\n b # c\r\n",
+			[]Token{
+				{Val: "a", Type: TokenIdentifier, Pos: Position{Offset: 0, Line: 1, Column: 1}},
+				{Val: " ", Type: TokenWhitespace, Pos: Position{Offset: 1, Line: 1, Column: 2}},
+				{Val: "\\\r\n", Type: TokenWhitespace, Pos: Position{Offset: 2, Line: 1, Column: 3}},
+				{Val: " ", Type: TokenWhitespace, Pos: Position{Offset: 5, Line: 2, Column: 1}},
+				{Val: "b", Type: TokenIdentifier, Pos: Position{Offset: 6, Line: 2, Column: 2}},
+				{Val: " ", Type: TokenWhitespace, Pos: Position{Offset: 7, Line: 2, Column: 3}},
+				{Val: "# c", Type: TokenComment, Pos: Position{Offset: 8, Line: 2, Column: 4}},
+				{Val: "\r\n", Type: TokenNewline, Pos: Position{Offset: 11, Line: 2, Column: 7}},
+			},
+		},
+		{
+			"f(a,\r\n\tb)",
+			[]Token{
+				{Val: "f", Type: TokenIdentifier, Pos: Position{Offset: 0, Line: 1, Column: 1}},
+				{Val: "(", Type: TokenDelimiter, Pos: Position{Offset: 1, Line: 1, Column: 2}},
+				{Val: "a", Type: TokenIdentifier, Pos: Position{Offset: 2, Line: 1, Column: 3}},
+				{Val: ",", Type: TokenDelimiter, Pos: Position{Offset: 3, Line: 1, Column: 4}},
+				{Val: "\r\n\t", Type: TokenWhitespace, Pos: Position{Offset: 4, Line: 1, Column: 5}},
+				{Val: "b", Type: TokenIdentifier, Pos: Position{Offset: 7, Line: 2, Column: 2}},
+				{Val: ")", Type: TokenDelimiter, Pos: Position{Offset: 8, Line: 2, Column: 3}},
+			},
+		},
+		{
+			"\"\"\"a\r\nb\"\"\" \"c\\\r\nd\"",
+			[]Token{
+				{Val: "\"\"\"a\r\nb\"\"\"", Type: TokenString, Pos: Position{Offset: 0, Line: 1, Column: 1}},
+				{Val: " ", Type: TokenWhitespace, Pos: Position{Offset: 10, Line: 2, Column: 5}},
+				{Val: "\"c\\\r\nd\"", Type: TokenString, Pos: Position{Offset: 11, Line: 2, Column: 6}},
+			},
+		},
+		{
+			"\uFEFFa = 1",
+			[]Token{
+				{Val: "a", Type: TokenIdentifier, Pos: Position{Offset: 3, Line: 1, Column: 1}},
+				{Val: " ", Type: TokenWhitespace, Pos: Position{Offset: 4, Line: 1, Column: 2}},
+				{Val: "=", Type: TokenDelimiter, Pos: Position{Offset: 5, Line: 1, Column: 3}},
+				{Val: " ", Type: TokenWhitespace, Pos: Position{Offset: 6, Line: 1, Column: 4}},
+				{Val: "1", Type: TokenNumber, Pos: Position{Offset: 7, Line: 1, Column: 5}},
+			},
+		},
+	} {
+		tokens, err := Tokenise(test.Input)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+		} else if !reflect.DeepEqual(tokens, test.Tokens) {
+			t.Errorf("Test %d: got %+v, want %+v", n+1, tokens, test.Tokens)
+		}
+	}
+
+	if _, err := Tokenise("a = \"b\r\nc\""); err == nil || err.Error() != "1:5: newline in string" {
+		t.Errorf("expected newline in string error, got %v", err)
+	}
+}
+
+func TestEncodingDeclaration(t *testing.T) {
+	for n, test := range [...]struct {
+		input string
+		err   string
+	}{
+		{"# -*- coding: utf-8 -*-\na = 1\n", ""},
+		{"#!/usr/bin/env python\n# vim: set fileencoding=UTF_8 :\n", ""},
+		{"\uFEFF# coding=utf-8-sig\r\n", ""},
+		{"# coding: utf8\n", ""},
+		{"# -*- coding: latin-1 -*-\n", `1:15: unsupported encoding "latin-1": only UTF-8 is supported`},
+		{"#!/usr/bin/env python\r\n  # coding: cp1252\r\n", `2:13: unsupported encoding "cp1252": only UTF-8 is supported`},
+		{"\n# coding=ascii\n", `2:10: unsupported encoding "ascii": only UTF-8 is supported`},
+		{"a = 1\n# coding: latin-1\n", ""},
+		{"\n\n# coding: latin-1\n", ""},
+	} {
+		_, err := Tokenise(test.input)
+		if test.err == "" && err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("Test %d: expected error %q, got %v", n+1, test.err, err)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	for n, test := range [...]struct {
+		input string
+		mode  Mode
+	}{
+		{testdata.TestRecipe1, 0},
+		{testdata.TestRecipe1, EmitIndents},
+		{testdata.TestScript1, 0},
+		{"\uFEFF# coding: utf-8\r\nclass A:\r\n    b = \"\"\"c\r\nd\"\"\"\r\n", EmitIndents},
+		{"a = (1,\n", 0},
+		{"# coding: latin-1\n", 0},
+		{"", 0},
+	} {
+		expected, expectedErr := TokeniseMode(test.input, test.mode)
+		var tokens []Token
+		var err error
+		for token, e := range NewReaderMode(iotest.OneByteReader(strings.NewReader(test.input)), test.mode).All() {
+			if e != nil {
+				err = e
+				break
+			}
+			tokens = append(tokens, token)
+		}
+		if !reflect.DeepEqual(err, expectedErr) {
+			t.Errorf("Test %d: expected error %v, got %v", n+1, expectedErr, err)
+		} else if err == nil && !reflect.DeepEqual(tokens, expected) {
+			t.Errorf("Test %d: got %v, want %v", n+1, tokens, expected)
+		}
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	errRead := errors.New("read failed")
+	tok := NewReader(io.MultiReader(strings.NewReader("a = 1\n"), iotest.ErrReader(errRead)))
+	for _, expected := range []string{"a", " ", "=", " ", "1", "\n"} {
+		if token, err := tok.NextToken(); err != nil || token.Val != expected {
+			t.Fatalf("expected token %q, got %q, %v", expected, token.Val, err)
+		}
+	}
+	for range 2 {
+		if _, err := tok.NextToken(); err != errRead {
+			t.Errorf("expected read error, got %v", err)
+		}
+	}
+
+	tok = NewReader(strings.NewReader("a"))
+	tok.NextToken()
+	for range 2 {
+		if _, err := tok.NextToken(); err != io.EOF {
+			t.Errorf("expected EOF, got %v", err)
+		}
+	}
+}
+
+func TestTolerant(t *testing.T) {
+	for n, test := range [...]struct {
+		input  string
+		mode   Mode
+		tokens []Token
+		errs   ErrorList
+	}{
+		{
+			"a = $b c\nd\n",
+			Tolerant,
+			[]Token{
+				{Val: "a", Type: TokenIdentifier},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "=", Type: TokenDelimiter},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "$b c", Type: TokenError},
+				{Val: "\n", Type: TokenNewline},
+				{Val: "d", Type: TokenIdentifier},
+				{Val: "\n", Type: TokenNewline},
+			},
+			ErrorList{{Pos: Position{Offset: 4, Line: 1, Column: 5}, Msg: "invalid delimiter"}},
+		},
+		{
+			"f(a, \"b\n)\nc",
+			Tolerant,
+			[]Token{
+				{Val: "f", Type: TokenIdentifier},
+				{Val: "(", Type: TokenDelimiter},
+				{Val: "a", Type: TokenIdentifier},
+				{Val: ",", Type: TokenDelimiter},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "\"b", Type: TokenError},
+				{Val: "\n", Type: TokenNewline},
+				{Val: ")", Type: TokenError},
+				{Val: "\n", Type: TokenNewline},
+				{Val: "c", Type: TokenIdentifier},
+			},
+			ErrorList{
+				{Pos: Position{Offset: 5, Line: 1, Column: 6}, Msg: "newline in string"},
+				{Pos: Position{Offset: 8, Line: 2, Column: 1}, Msg: "invalid bracket"},
+			},
+		},
+		{
+			"a = [1,\n",
+			Tolerant,
+			[]Token{
+				{Val: "a", Type: TokenIdentifier},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "=", Type: TokenDelimiter},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "[", Type: TokenDelimiter},
+				{Val: "1", Type: TokenNumber},
+				{Val: ",", Type: TokenDelimiter},
+				{Val: "\n", Type: TokenWhitespace},
+			},
+			ErrorList{{Pos: Position{Offset: 4, Line: 1, Column: 5}, Msg: "unmatched bracket"}},
+		},
+		{
+			"if a:\n    b\n  c\n",
+			Tolerant | EmitIndents,
+			[]Token{
+				{Val: "if", Type: TokenKeyword},
+				{Val: " ", Type: TokenWhitespace},
+				{Val: "a", Type: TokenIdentifier},
+				{Val: ":", Type: TokenDelimiter},
+				{Val: "\n", Type: TokenNewline},
+				{Val: "    ", Type: TokenIndent},
+				{Val: "b", Type: TokenIdentifier},
+				{Val: "\n", Type: TokenNewline},
+				{Val: "  ", Type: TokenWhitespace},
+				{Val: "", Type: TokenDedent},
+				{Val: "c", Type: TokenIdentifier},
+				{Val: "\n", Type: TokenNewline},
+			},
+			ErrorList{{Pos: Position{Offset: 14, Line: 3, Column: 3}, Msg: "unindent does not match any outer indentation level"}},
+		},
+		{
+			"a\n",
+			Tolerant,
+			[]Token{
+				{Val: "a", Type: TokenIdentifier},
+				{Val: "\n", Type: TokenNewline},
+			},
+			nil,
+		},
+	} {
+		tokens, err := TokeniseMode(test.input, test.mode)
+		if test.errs == nil && err != nil {
+			t.Errorf("Test %d: unexpected error: %s", n+1, err)
+		} else if test.errs != nil && !reflect.DeepEqual(err, test.errs) {
+			t.Errorf("Test %d: expected errors %v, got %v", n+1, test.errs, err)
+		}
+		if !reflect.DeepEqual(stripPositions(tokens), test.tokens) {
+			t.Errorf("Test %d: got %v, want %v", n+1, tokens, test.tokens)
+		}
+	}
+
+	errs := ErrorList{{Pos: Position{Line: 1, Column: 2}, Msg: "a"}, {Pos: Position{Line: 3, Column: 4}, Msg: "b"}}
+	if msg := errs.Error(); msg != "1:2: a (and 1 more errors)" {
+		t.Errorf("unexpected error list message %q", msg)
+	}
+}
+
+func TestCloseBracketsAt(t *testing.T) {
+	input := "f(a,\n  g(b\n\nc(d)\n"
+	tok := New(input, Tolerant)
+	tok.CloseBracketsAt(strings.Index(input, "\nc"))
+	var tokens []Token
+	for token, err := range tok.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+	expected := []Token{
+		{Val: "f", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "a", Type: TokenIdentifier},
+		{Val: ",", Type: TokenDelimiter},
+		{Val: "\n  ", Type: TokenWhitespace},
+		{Val: "g", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "b", Type: TokenIdentifier},
+		{Val: "\n", Type: TokenWhitespace},
+		{Val: "\n", Type: TokenNewline},
+		{Val: "c", Type: TokenIdentifier},
+		{Val: "(", Type: TokenDelimiter},
+		{Val: "d", Type: TokenIdentifier},
+		{Val: ")", Type: TokenDelimiter},
+		{Val: "\n", Type: TokenNewline},
+	}
+	if !reflect.DeepEqual(stripPositions(tokens), expected) {
+		t.Errorf("got %v, want %v", tokens, expected)
+	}
+	errs := []*Error{{Pos: Position{Offset: 8, Line: 2, Column: 4}, Msg: "unmatched bracket"}}
+	if !reflect.DeepEqual(tok.Diagnostics(), errs) {
+		t.Errorf("expected errors %v, got %v", errs, tok.Diagnostics())
+	}
+	if _, ok := tok.Unclosed(); ok {
+		t.Errorf("expected no bracket to be open at the end")
+	}
+
+	tok = New("f(a,\n  g(b\n", Tolerant)
+	for range tok.All() {
+	}
+	if pos, ok := tok.Unclosed(); !ok || pos != (Position{Offset: 1, Line: 1, Column: 2}) {
+		t.Errorf("expected the outermost bracket to be open, got %v, %v", pos, ok)
+	}
+}